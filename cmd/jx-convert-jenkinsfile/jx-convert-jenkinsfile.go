@@ -1,32 +1,187 @@
 package main
 
-//func main() {
-//
-//	//dir := flag.String("dir", ".", "the folder to look for a Jenkinsfile and to write the jenkins-x.yml. Defaults to the current directory.")
-//	//
-//	//flag.Parse()
-//	dir := "./"
-//	model, err := grammar.ParseJenkinsfileInDirectory(dir)
-//
-//	if err != nil {
-//		fmt.Println("Error parsing Jenkinsfile: ", err)
-//		os.Exit(1)
-//	}
-//
-//	asYaml, convertIssues, err := model.ToYaml()
-//	if err != nil {
-//		fmt.Println("Error converting jenkins-x.yml: ", err)
-//		os.Exit(1)
-//	}
-//	jxYmlFile := filepath.Join(dir, "jenkins-actions2.yml")
-//	err = ioutil.WriteFile(jxYmlFile, []byte(asYaml), 0644)
-//	if err != nil {
-//		fmt.Printf("Error writing to jenkins-x.yml in %s: %s\n", dir, err)
-//		os.Exit(1)
-//	}
-//
-//	fmt.Printf("Converted jenkins-x.yml for Jenkinsfile in %s:\n", dir)
-//	if convertIssues {
-//		fmt.Println("ATTENTION: Some contents of the Jenkinsfile could not be converted. Please review the jenkins-x.yml for more information.")
-//	}
-//}
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/inspirit941/convert-jenkinsfile/pkg/grammar"
+	"github.com/inspirit941/convert-jenkinsfile/pkg/logger"
+	"github.com/inspirit941/convert-jenkinsfile/pkg/remote"
+	"github.com/pkg/errors"
+)
+
+// maxJenkinsfileBytes is the largest Jenkinsfile read from a repository
+const maxJenkinsfileBytes = 10 << 20
+
+func main() {
+	logger.Setup()
+	dir := flag.String("dir", ".", "the folder to look for a Jenkinsfile and to write the jenkins-actions2.yml. Defaults to the current directory.")
+	jenkinsfileName := flag.String("jenkinsfile", "", "the file name or glob pattern of the Jenkinsfile in the folder, like Jenkinsfile.ci or ci/Jenkinsfile*. Defaults to the common names of Jenkinsfiles, matched in any case.")
+	runsOn := flag.String("runs-on", "", "the runner label jobs run on, unless the agent label or the steps call for a specific runner. Defaults to ubuntu-latest.")
+	strict := flag.Bool("strict", false, "fail instead of writing a best-effort workflow if any part of the Jenkinsfile can't be fully converted.")
+	dockerActions := flag.Bool("docker-actions", false, "convert sh steps that only build and push an image with docker commands into docker/build-push-action.")
+	stepIDs := flag.Bool("step-ids", false, "give every step an id derived from its name, so that other steps can refer to it.")
+	skipEmptyStages := flag.Bool("skip-empty-stages", false, "leave out the stages without steps, instead of converting them into jobs that do nothing.")
+	parallelStages := flag.Bool("parallel-stages", false, "run each stage as soon as the stages whose stashes or workspace files it uses are done, instead of after every earlier stage.")
+	splitCommands := flag.Bool("split-commands", false, "convert sh steps that join commands with &&, like sh 'make && make test', into a step for each command.")
+	setupActions := flag.Bool("setup-actions", false, "set up the build tools the sh steps run, like Node.js for npm, with the setup action of each and their dependencies cached.")
+	composite := flag.Bool("composite", false, "convert the Jenkinsfile into a composite action, action.yml, which runs the steps of the stages in the job using it, instead of a workflow.")
+	reusable := flag.Bool("reusable", false, "convert the Jenkinsfile into a reusable workflow, which other workflows call with its parameters as inputs and the secrets it uses.")
+	actionVersions := flag.String("action-versions", "", "pin the actions the workflow uses to other versions or commit SHAs, as a comma separated list of action=ref pairs, like actions/checkout=v4.")
+	stepMappingsFile := flag.String("step-mappings", "", "if set, convert the steps of a YAML or JSON mapping file as it describes, like the steps of a shared library. It maps each step name to an action to use or a script to run.")
+	repo := flag.String("repo", "", "if set, read the Jenkinsfile from this https Git repository instead of the folder. The repository is shallow cloned, with the token in the GIT_TOKEN environment variable if set.")
+	ref := flag.String("ref", "", "the branch or tag of the repository to read the Jenkinsfile from. Defaults to the repository's default branch.")
+	jenkinsfilePath := flag.String("path", remote.DefaultPath, "the path of the Jenkinsfile in the repository.")
+	workflowName := flag.String("workflow-name", "", "the name of the workflow, like the name of the repository or of the Jenkins job. Defaults to CI.")
+	indentWidth := flag.String("indent", "", "the number of spaces each level of the workflow is indented by, between 2 and 8. Defaults to 2.")
+	outDir := flag.String("out-dir", "", "if set, write a workflow for each trigger into this folder, pr.yml for pull requests and release.yml for pushes, instead of a single jenkins-actions2.yml. With -composite, write action.yml into it.")
+
+	flag.Parse()
+	var model *grammar.Model
+	var err error
+	if *repo != "" {
+		model, err = parseRepositoryJenkinsfile(remote.Repository{
+			URL:   *repo,
+			Ref:   *ref,
+			Path:  *jenkinsfilePath,
+			Token: os.Getenv(remote.TokenEnvVar),
+		})
+	} else {
+		model, err = grammar.ParseJenkinsfileInDirectoryNamed(*dir, *jenkinsfileName)
+	}
+
+	if err != nil {
+		fmt.Println("Error parsing Jenkinsfile: ", err)
+		os.Exit(1)
+	}
+
+	pinnedActions, err := grammar.ParseActionVersions(*actionVersions)
+	if err != nil {
+		fmt.Println("Error reading the action versions: ", err)
+		os.Exit(1)
+	}
+
+	indent, err := grammar.ParseIndentWidth(*indentWidth)
+	if err != nil {
+		fmt.Println("Error reading the indentation width: ", err)
+		os.Exit(1)
+	}
+
+	var stepMappings map[string]grammar.StepMapping
+	if *stepMappingsFile != "" {
+		stepMappings, err = readStepMappings(*stepMappingsFile)
+		if err != nil {
+			fmt.Println("Error reading the step mappings: ", err)
+			os.Exit(1)
+		}
+	}
+
+	opts := grammar.ConvertOptions{
+		RunsOn:           *runsOn,
+		Strict:           *strict,
+		DockerActions:    *dockerActions,
+		StepIDs:          *stepIDs,
+		SkipEmptyStages:  *skipEmptyStages,
+		ActionVersions:   pinnedActions,
+		ParallelStages:   *parallelStages,
+		ReusableWorkflow: *reusable,
+		StepMappings:     stepMappings,
+		SplitCommands:    *splitCommands,
+		WorkflowName:     *workflowName,
+		SetupActions:     *setupActions,
+		CompositeAction:  *composite,
+		IndentWidth:      indent,
+	}
+	if *outDir != "" {
+		writeWorkflowFiles(model, opts, *outDir)
+		return
+	}
+
+	sections, convertIssues, err := model.ToWorkflowSections(opts)
+	if err != nil {
+		fmt.Println("Error converting jenkins-x.yml: ", err)
+		os.Exit(1)
+	}
+	asYaml := strings.Join(sections.Lines(), "\n")
+	fileName := "jenkins-actions2.yml"
+	if *composite {
+		fileName = "action.yml"
+	}
+	jxYmlFile := filepath.Join(*dir, fileName)
+	err = ioutil.WriteFile(jxYmlFile, []byte(asYaml), 0644)
+	if err != nil {
+		fmt.Printf("Error writing to jenkins-x.yml in %s: %s\n", *dir, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Converted jenkins-x.yml for Jenkinsfile in %s:\n", *dir)
+	if convertIssues {
+		fmt.Println("ATTENTION: Some contents of the Jenkinsfile could not be converted. Please review the jenkins-x.yml for more information.")
+	}
+	fmt.Println(sections.Summary.String())
+}
+
+// parseRepositoryJenkinsfile fetches the Jenkinsfile of a Git repository and parses it
+func parseRepositoryJenkinsfile(repo remote.Repository) (*grammar.Model, error) {
+	jf, err := remote.FetchJenkinsfile(context.Background(), repo, maxJenkinsfileBytes)
+	if err != nil {
+		return nil, err
+	}
+	model, err := grammar.ParseText(jf)
+	if errors.Is(err, grammar.ErrNoPipelineBlock) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Jenkinsfile %s of %s cannot be parsed. It may contain code outside of the pipeline {} block, or it may not have a pipeline {} block at all.", repo.Path, repo.URL)
+	}
+	return model, nil
+}
+
+// readStepMappings reads the mappings of custom steps from a mapping file
+func readStepMappings(file string) (map[string]grammar.StepMapping, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return grammar.ParseStepMappings(data)
+}
+
+// writeWorkflowFiles writes a workflow for each trigger of the Jenkinsfile into outDir, or the composite action if
+// the options ask for one, with the summary of each
+func writeWorkflowFiles(model *grammar.Model, opts grammar.ConvertOptions, outDir string) {
+	files, convertIssues, err := model.ToWorkflowFiles(opts)
+	if err != nil {
+		fmt.Println("Error converting jenkins-x.yml: ", err)
+		os.Exit(1)
+	}
+	err = os.MkdirAll(outDir, 0755)
+	if err != nil {
+		fmt.Printf("Error creating %s: %s\n", outDir, err)
+		os.Exit(1)
+	}
+	// Written in order of their names, so the output is the same on every run
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		asYaml := strings.Join(files[name].Lines(), "\n")
+		err = ioutil.WriteFile(filepath.Join(outDir, name), []byte(asYaml), 0644)
+		if err != nil {
+			fmt.Printf("Error writing to %s in %s: %s\n", name, outDir, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Converted %s in %s\n", name, outDir)
+		fmt.Println(files[name].Summary.String())
+	}
+	if convertIssues {
+		fmt.Println("ATTENTION: Some contents of the Jenkinsfile could not be converted. Please review the workflow files for more information.")
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/inspirit941/convert-jenkinsfile
 
-go 1.17
+go 1.21
 
 require (
 	github.com/alecthomas/participle v0.7.1
@@ -1,14 +1,61 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/inspirit941/convert-jenkinsfile/pkg/logger"
 	"github.com/inspirit941/convert-jenkinsfile/pkg/router"
 )
 
+// ListenAddrEnvVar is the environment variable setting the address the server listens on. Defaults to :8000.
+const ListenAddrEnvVar = "LISTEN_ADDR"
+
+const (
+	defaultListenAddr = ":8000"
+	// shutdownTimeout is how long conversions in flight get to finish once the server is asked to stop
+	shutdownTimeout = 30 * time.Second
+)
+
 func main() {
+	logger.Setup()
 	server := gin.Default()
 	// router 세팅
 	server = router.InitRouter(server)
 
-	server.Run(":8000")
+	addr := os.Getenv(ListenAddrEnvVar)
+	if addr == "" {
+		addr = defaultListenAddr
+	}
+	httpServer := &http.Server{
+		Addr:    addr,
+		Handler: server,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error running the server", "error", err, "addr", addr)
+			os.Exit(1)
+		}
+	}()
+	slog.Info("Server started", "addr", addr)
+
+	<-ctx.Done()
+	stop()
+	slog.Info("Shutting down, waiting for requests in flight")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down the server", "error", err)
+		os.Exit(1)
+	}
 }
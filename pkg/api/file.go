@@ -1,14 +1,16 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/inspirit941/convert-jenkinsfile/pkg/grammar"
+	"github.com/inspirit941/convert-jenkinsfile/pkg/logger"
+	"github.com/inspirit941/convert-jenkinsfile/pkg/remote"
 	_ "github.com/swaggo/files"       // swagger embed files
 	_ "github.com/swaggo/gin-swagger" // gin-swagger middleware
 	"net/http"
-	"os"
-	"path/filepath"
+	"strings"
 )
 
 // ConvertFile @Summary jenkinsFile to github-action.yaml
@@ -17,32 +19,146 @@ import (
 // @Accept multipart/form-data
 // @Produce application/json
 // @Param file formData file true "jenkinsFile"
+// @Param runs-on query string false "runner label for the jobs, defaults to ubuntu-latest"
+// @Param strict query bool false "fail with the list of unsupported constructs instead of converting them best-effort"
+// @Param docker-actions query bool false "convert sh steps that only build and push an image with docker commands into docker/build-push-action"
+// @Param step-ids query bool false "give every step an id derived from its name, so that other steps can refer to it"
+// @Param skip-empty-stages query bool false "leave out the stages without steps, instead of converting them into jobs that do nothing"
+// @Param parallel-stages query bool false "run each stage as soon as the stages whose stashes or workspace files it uses are done, instead of after every earlier stage"
+// @Param split-commands query bool false "convert sh steps that join commands with &&, like sh 'make && make test', into a step for each command"
+// @Param setup-actions query bool false "set up the build tools the sh steps run, like Node.js for npm, with the setup action of each and their dependencies cached"
+// @Param reusable query bool false "convert into a reusable workflow, which other workflows call with its parameters as inputs and the secrets it uses"
+// @Param composite query bool false "convert into a composite action, which runs the steps of the stages in the job using it, with the parameters and the secrets it uses as inputs"
+// @Param action-versions query string false "pin actions to other versions or commit SHAs, as comma separated action=ref pairs, like actions/checkout=v4"
+// @Param step-mappings formData file false "YAML or JSON file mapping the names of custom steps, like those of a shared library, to an action to use or a script to run"
+// @Param workflow-name query string false "the name of the workflow, like the name of the repository or of the Jenkins job. Defaults to CI"
+// @Param indent query int false "the number of spaces each level of the workflow is indented by, between 2 and 8. Defaults to 2"
+// @Param split query bool false "return a workflow for each trigger in files, pr.yml and release.yml, instead of a single result"
+// @Param annotate query bool false "also return an annotation for each job of the result, referring it to the stage and line of the Jenkinsfile it is converted from. Not supported with split"
 // @Router /upload [POST]
-// @Success 200 {object} gin.H{message=string,result=string} "StatusOK"
-// @Failure 400 {object} gin.H{error=string} "StatusBadRequest"
+// @Success 200 {object} gin.H{message=string,result=string,summary=grammar.ConversionSummary,files=map[string]string,annotations=[]grammar.Annotation} "StatusOK"
+// @Failure 400 {object} gin.H{error=string,code=string,request_id=string} "StatusBadRequest"
+// @Failure 413 {object} gin.H{error=string,code=string} "StatusRequestEntityTooLarge"
+// @Failure 500 {object} gin.H{error=string,request_id=string} "StatusInternalServerError"
+// @Failure 503 {object} gin.H{error=string,request_id=string} "StatusServiceUnavailable"
+// @Failure 504 {object} gin.H{error=string,request_id=string} "StatusGatewayTimeout"
 func ConvertFile(c *gin.Context) {
 	// File Upload
-	file, _ := c.FormFile("file")
-	uploadPath := filepath.Join(os.TempDir(), file.Filename)
-	defer os.Remove(uploadPath)
+	filename, jf, ok := readUpload(c)
+	if !ok {
+		return
+	}
 
-	c.SaveUploadedFile(file, uploadPath)
-	model, err := grammar.ParseJenkinsfileInDirectory(uploadPath)
-	// jenkinsfile 포맷이 아닌 경우
+	ctx, cancel := context.WithTimeout(c.Request.Context(), convertTimeout())
+	defer cancel()
+	convert(ctx, c, filename, jf)
+}
+
+// ConvertURL @Summary jenkinsFile of a Git repository to github-action.yaml
+// @Tags api
+// @Description jenkinsFile of a Git repository to github-action.yaml. The repository is shallow cloned to read it.
+// @Produce application/json
+// @Param url query string true "https URL of the Git repository"
+// @Param ref query string false "branch or tag to read the Jenkinsfile from, defaults to the default branch"
+// @Param path query string false "path of the Jenkinsfile in the repository, defaults to Jenkinsfile"
+// @Param Authorization header string false "Bearer token to clone a private repository with"
+// @Param runs-on query string false "runner label for the jobs, defaults to ubuntu-latest"
+// @Param strict query bool false "fail with the list of unsupported constructs instead of converting them best-effort"
+// @Param docker-actions query bool false "convert sh steps that only build and push an image with docker commands into docker/build-push-action"
+// @Param step-ids query bool false "give every step an id derived from its name, so that other steps can refer to it"
+// @Param skip-empty-stages query bool false "leave out the stages without steps, instead of converting them into jobs that do nothing"
+// @Param parallel-stages query bool false "run each stage as soon as the stages whose stashes or workspace files it uses are done, instead of after every earlier stage"
+// @Param split-commands query bool false "convert sh steps that join commands with &&, like sh 'make && make test', into a step for each command"
+// @Param setup-actions query bool false "set up the build tools the sh steps run, like Node.js for npm, with the setup action of each and their dependencies cached"
+// @Param reusable query bool false "convert into a reusable workflow, which other workflows call with its parameters as inputs and the secrets it uses"
+// @Param composite query bool false "convert into a composite action, which runs the steps of the stages in the job using it, with the parameters and the secrets it uses as inputs"
+// @Param action-versions query string false "pin actions to other versions or commit SHAs, as comma separated action=ref pairs, like actions/checkout=v4"
+// @Param step-mappings formData file false "YAML or JSON file mapping the names of custom steps, like those of a shared library, to an action to use or a script to run"
+// @Param workflow-name query string false "the name of the workflow, like the name of the repository or of the Jenkins job. Defaults to CI"
+// @Param indent query int false "the number of spaces each level of the workflow is indented by, between 2 and 8. Defaults to 2"
+// @Param split query bool false "return a workflow for each trigger in files, pr.yml and release.yml, instead of a single result"
+// @Param annotate query bool false "also return an annotation for each job of the result, referring it to the stage and line of the Jenkinsfile it is converted from. Not supported with split"
+// @Router /upload/url [POST]
+// @Success 200 {object} gin.H{message=string,result=string,summary=grammar.ConversionSummary,files=map[string]string,annotations=[]grammar.Annotation} "StatusOK"
+// @Failure 400 {object} gin.H{error=string,code=string,request_id=string} "StatusBadRequest"
+// @Failure 500 {object} gin.H{error=string,request_id=string} "StatusInternalServerError"
+// @Failure 503 {object} gin.H{error=string,request_id=string} "StatusServiceUnavailable"
+// @Failure 504 {object} gin.H{error=string,request_id=string} "StatusGatewayTimeout"
+func ConvertURL(c *gin.Context) {
+	repo := remote.Repository{
+		URL:          c.Query("url"),
+		Ref:          c.Query("ref"),
+		Path:         c.Query("path"),
+		AllowedHosts: allowedGitHosts(),
+	}
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		repo.Token = strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), convertTimeout())
+	defer cancel()
+	jf, err := remote.FetchJenkinsfile(ctx, repo, maxUploadBytes())
 	if err != nil {
-		// todo: 에러메시지 구체화
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		logger.FromContext(c.Request.Context()).Error("Error fetching Jenkinsfile", "error", err, "url", repo.URL, "ref", repo.Ref, "path", c.FullPath(), "client", c.ClientIP())
+		respondWithError(c, err)
+		return
+	}
+	convert(ctx, c, repo.URL, jf)
+}
+
+// convert responds with the conversion of the Jenkinsfile, using the options of the request's query
+func convert(ctx context.Context, c *gin.Context, filename string, jf string) {
+	actionVersions, err := grammar.ParseActionVersions(c.Query("action-versions"))
+	if err != nil {
+		respondWithError(c, err)
+		return
 	}
 
-	asYaml, convertIssues, err := model.ToYaml()
+	stepMappings, err := readStepMappings(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	indentWidth, err := grammar.ParseIndentWidth(c.Query("indent"))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	opts := grammar.ConvertOptions{
+		RunsOn:           c.Query("runs-on"),
+		Strict:           c.Query("strict") == "true",
+		DockerActions:    c.Query("docker-actions") == "true",
+		StepIDs:          c.Query("step-ids") == "true",
+		SkipEmptyStages:  c.Query("skip-empty-stages") == "true",
+		ActionVersions:   actionVersions,
+		ParallelStages:   c.Query("parallel-stages") == "true",
+		ReusableWorkflow: c.Query("reusable") == "true",
+		StepMappings:     stepMappings,
+		SplitCommands:    c.Query("split-commands") == "true",
+		WorkflowName:     c.Query("workflow-name"),
+		SetupActions:     c.Query("setup-actions") == "true",
+		CompositeAction:  c.Query("composite") == "true",
+		IndentWidth:      indentWidth,
+	}
+	if c.Query("split") == "true" {
+		convertFileSplit(ctx, c, filename, jf, opts)
+		return
+	}
+
+	var sections *grammar.WorkflowSections
+	var convertIssues bool
+	err = runConversion(ctx, func() (err error) {
+		sections, convertIssues, err = grammar.ConvertTextToSections(jf, opts)
+		return err
+	})
 	// 변환에 실패한 경우
 	if err != nil {
-		fmt.Println("Error converting to Yaml: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		logger.FromContext(c.Request.Context()).Error("Error converting to Yaml", "error", err, "file", filename, "path", c.FullPath(), "client", c.ClientIP())
+		// todo: 에러메시지 구체화
+		respondWithError(c, err)
+		return
 	}
 
 	var convertIssuesMsg string
@@ -50,8 +166,77 @@ func ConvertFile(c *gin.Context) {
 		convertIssuesMsg = fmt.Sprintf("ATTENTION: Some contents of the Jenkinsfile could not be converted. Please review the github-action.yml for more information.")
 	}
 
+	response := gin.H{
+		"message": convertIssuesMsg,
+		"result":  strings.Join(sections.Lines(), "\n"),
+		"summary": sections.Summary,
+	}
+	if c.Query("annotate") == "true" {
+		response["annotations"] = sections.Annotations(jf)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// convertFileSplit responds with a workflow for each trigger of the Jenkinsfile, keyed by file name
+func convertFileSplit(ctx context.Context, c *gin.Context, filename string, jf string, opts grammar.ConvertOptions) {
+	var files map[string]string
+	var convertIssues bool
+	err := runConversion(ctx, func() (err error) {
+		files, convertIssues, err = grammar.ConvertTextToFiles(jf, opts)
+		return err
+	})
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Error converting to Yaml", "error", err, "file", filename, "path", c.FullPath(), "client", c.ClientIP())
+		respondWithError(c, err)
+		return
+	}
+
+	var convertIssuesMsg string
+	if convertIssues {
+		convertIssuesMsg = "ATTENTION: Some contents of the Jenkinsfile could not be converted. Please review the workflow files for more information."
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": convertIssuesMsg,
-		"result":  asYaml,
+		"files":   files,
+	})
+}
+
+// ParseFile @Summary jenkinsFile to its parsed model
+// @Tags api
+// @Description jenkinsFile to the parsed model as JSON, without converting it to github-action.yaml
+// @Accept multipart/form-data
+// @Produce application/json
+// @Param file formData file true "jenkinsFile"
+// @Router /parse [POST]
+// @Success 200 {object} gin.H{result=grammar.Model} "StatusOK"
+// @Failure 400 {object} gin.H{error=string,code=string,request_id=string} "StatusBadRequest"
+// @Failure 413 {object} gin.H{error=string,code=string} "StatusRequestEntityTooLarge"
+// @Failure 500 {object} gin.H{error=string,request_id=string} "StatusInternalServerError"
+// @Failure 503 {object} gin.H{error=string,request_id=string} "StatusServiceUnavailable"
+// @Failure 504 {object} gin.H{error=string,request_id=string} "StatusGatewayTimeout"
+func ParseFile(c *gin.Context) {
+	// File Upload
+	filename, jf, ok := readUpload(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), convertTimeout())
+	defer cancel()
+	var model *grammar.Model
+	err := runConversion(ctx, func() (err error) {
+		model, err = grammar.ParseText(jf)
+		return err
+	})
+	// jenkinsfile 포맷이 아닌 경우
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Error parsing Jenkinsfile", "error", err, "file", filename, "path", c.FullPath(), "client", c.ClientIP())
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": model,
 	})
 }
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testJenkinsfile = `pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make'
+            }
+        }
+    }
+}
+`
+
+// upload posts the file to the handler as the file field of a form, returning the response
+func upload(t *testing.T, handler gin.HandlerFunc, filename string, content string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/upload", handler)
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestConvertFileAcceptsAnyFileName(t *testing.T) {
+	for _, filename := range []string{"Jenkinsfile", "Jenkinsfile.groovy", "build.jenkinsfile"} {
+		w := upload(t, ConvertFile, filename, testJenkinsfile)
+		if w.Code != http.StatusOK {
+			t.Fatalf("uploading %s: got status %d: %s", filename, w.Code, w.Body.String())
+		}
+		var response struct {
+			Result string `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(response.Result, "run: make") {
+			t.Errorf("uploading %s: the workflow doesn't run the step of the Jenkinsfile:\n%s", filename, response.Result)
+		}
+	}
+}
+
+func TestConvertFileRejectsEmptyJenkinsfile(t *testing.T) {
+	w := upload(t, ConvertFile, "Jenkinsfile.groovy", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), noPipelineBlockCode) {
+		t.Errorf("the response doesn't have the code %s: %s", noPipelineBlockCode, w.Body.String())
+	}
+}
+
+func TestConvertFileRejectsJenkinsfileLargerThanAllowed(t *testing.T) {
+	t.Setenv(MaxUploadBytesEnvVar, "64")
+	w := upload(t, ConvertFile, "Jenkinsfile", testJenkinsfile)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusRequestEntityTooLarge, w.Body.String())
+	}
+	var response struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != uploadTooLargeCode {
+		t.Errorf("got the code %q, want %q: %s", response.Code, uploadTooLargeCode, w.Body.String())
+	}
+}
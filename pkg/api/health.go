@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/inspirit941/convert-jenkinsfile/pkg/version"
+)
+
+// Healthz @Summary health check
+// @Tags health
+// @Description reports that the server is up, along with its build information
+// @Produce application/json
+// @Router /healthz [GET]
+// @Success 200 {object} gin.H{status=string,build=map[string]string} "StatusOK"
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"build":  version.Map,
+	})
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/inspirit941/convert-jenkinsfile/pkg/grammar"
+	"github.com/inspirit941/convert-jenkinsfile/pkg/logger"
+)
+
+const (
+	// MaxUploadBytesEnvVar is the environment variable setting the largest Jenkinsfile that can be uploaded, in bytes.
+	// Defaults to 1 MiB.
+	MaxUploadBytesEnvVar = "MAX_UPLOAD_BYTES"
+	// ConvertTimeoutEnvVar is the environment variable setting how long a conversion may take, as a duration like
+	// 10s. Defaults to 10 seconds.
+	ConvertTimeoutEnvVar = "CONVERT_TIMEOUT"
+	// AllowedGitHostsEnvVar is the environment variable listing the hosts repositories can be cloned from, separated
+	// by commas, like github.com,gitlab.com. Any host is allowed if unset.
+	AllowedGitHostsEnvVar = "ALLOWED_GIT_HOSTS"
+	// MaxConversionsEnvVar is the environment variable setting how many conversions may run at once. Defaults to
+	// twice the number of CPUs.
+	MaxConversionsEnvVar = "MAX_CONVERSIONS"
+
+	defaultMaxUploadBytes = 1 << 20
+	defaultConvertTimeout = 10 * time.Second
+)
+
+// errTooBusy is the error of a request that timed out waiting for a conversion slot
+var errTooBusy = errors.New("too many Jenkinsfiles are being converted, please try again later")
+
+// conversionSlots holds a slot for each conversion running, including those whose requests timed out, until they
+// finish. Parsing can't be interrupted, so without it timed out requests could pile up conversions in the background.
+var conversionSlots = make(chan struct{}, maxConversions())
+
+func maxUploadBytes() int64 {
+	if value := os.Getenv(MaxUploadBytesEnvVar); value != "" {
+		if maxBytes, err := strconv.ParseInt(value, 10, 64); err == nil && maxBytes > 0 {
+			return maxBytes
+		}
+		slog.Warn("Ignoring invalid max upload size", "env", MaxUploadBytesEnvVar, "value", value)
+	}
+	return defaultMaxUploadBytes
+}
+
+func convertTimeout() time.Duration {
+	if value := os.Getenv(ConvertTimeoutEnvVar); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			return timeout
+		}
+		slog.Warn("Ignoring invalid conversion timeout", "env", ConvertTimeoutEnvVar, "value", value)
+	}
+	return defaultConvertTimeout
+}
+
+func maxConversions() int {
+	if value := os.Getenv(MaxConversionsEnvVar); value != "" {
+		if conversions, err := strconv.Atoi(value); err == nil && conversions > 0 {
+			return conversions
+		}
+		slog.Warn("Ignoring invalid maximum of conversions", "env", MaxConversionsEnvVar, "value", value)
+	}
+	return 2 * runtime.NumCPU()
+}
+
+// conversionPanic is a panic of a conversion, raised again in the goroutine of the request
+type conversionPanic struct {
+	value interface{}
+	stack []byte
+}
+
+// runConversion runs the conversion once a slot is free, returning errTooBusy if none frees up before the context is
+// done. The conversion keeps its slot until it finishes, even if the context is done before then, in which case its
+// result is dropped.
+func runConversion(ctx context.Context, convert func() error) error {
+	slots := conversionSlots
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return errTooBusy
+	}
+	done := make(chan error, 1)
+	panicked := make(chan conversionPanic, 1)
+	go func() {
+		defer func() { <-slots }()
+		defer func() {
+			if r := recover(); r != nil {
+				panicked <- conversionPanic{value: r, stack: debug.Stack()}
+			}
+		}()
+		done <- convert()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case p := <-panicked:
+		panic(fmt.Sprintf("%v\n%s", p.value, p.stack))
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func allowedGitHosts() []string {
+	var hosts []string
+	for _, h := range strings.Split(os.Getenv(AllowedGitHostsEnvVar), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// readUpload reads the uploaded Jenkinsfile into memory. If it can't, it responds with 413 for files larger than
+// allowed and 400 otherwise, and returns false.
+func readUpload(c *gin.Context) (string, string, bool) {
+	maxBytes := maxUploadBytes()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+
+	file, err := c.FormFile("file")
+	if err == nil && file.Size > maxBytes {
+		err = &http.MaxBytesError{Limit: maxBytes}
+	}
+	var content []byte
+	if err == nil {
+		var f io.ReadCloser
+		f, err = file.Open()
+		if err == nil {
+			content, err = io.ReadAll(f)
+			f.Close()
+		}
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			logger.FromContext(c.Request.Context()).Warn("Uploaded Jenkinsfile is too large", "limit", maxBytes, "path", c.FullPath(), "client", c.ClientIP())
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("the Jenkinsfile is larger than %d bytes", maxBytes),
+				"code":  uploadTooLargeCode,
+			})
+			return "", "", false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return "", "", false
+	}
+	return file.Filename, string(content), true
+}
+
+// readStepMappings reads the mappings of custom steps from the optional step-mappings file of the form. Requests
+// without it, including those without a form, have no mappings.
+func readStepMappings(c *gin.Context) (map[string]grammar.StepMapping, error) {
+	maxBytes := maxUploadBytes()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	file, err := c.FormFile("step-mappings")
+	if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxBytes))
+	if err != nil {
+		return nil, err
+	}
+	return grammar.ParseStepMappings(data)
+}
+
+// The code of the error for a Jenkinsfile without a pipeline block, like an empty one
+const noPipelineBlockCode = "NO_PIPELINE_BLOCK"
+
+// The code of the error for an uploaded Jenkinsfile larger than allowed
+const uploadTooLargeCode = "UPLOAD_TOO_LARGE"
+
+// respondWithError responds with 504 if the conversion took longer than allowed, and 400 otherwise. Errors callers
+// can act on also have a code, and the id of the request is included to trace the failure in the logs.
+func respondWithError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusGatewayTimeout
+	}
+	if errors.Is(err, errTooBusy) {
+		status = http.StatusServiceUnavailable
+	}
+	body := gin.H{
+		"error": err.Error(),
+	}
+	if errors.Is(err, grammar.ErrNoPipelineBlock) {
+		body["code"] = noPipelineBlockCode
+	}
+	if id := logger.RequestID(c.Request.Context()); id != "" {
+		body["request_id"] = id
+	}
+	c.JSON(status, body)
+}
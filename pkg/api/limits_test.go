@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// withConversionSlots replaces the conversion slots for the test
+func withConversionSlots(t *testing.T, slots int) {
+	saved := conversionSlots
+	conversionSlots = make(chan struct{}, slots)
+	t.Cleanup(func() { conversionSlots = saved })
+}
+
+func TestRunConversionKeepsTheSlotOfATimedOutConversion(t *testing.T) {
+	withConversionSlots(t, 1)
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := runConversion(ctx, func() error {
+		defer close(finished)
+		<-release
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the conversion to time out, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = runConversion(ctx, func() error {
+		t.Error("a conversion ran while the timed out one still held the only slot")
+		return nil
+	})
+	if !errors.Is(err, errTooBusy) {
+		t.Fatalf("expected %v, got %v", errTooBusy, err)
+	}
+
+	close(release)
+	<-finished
+	if err := runConversion(context.Background(), func() error { return nil }); err != nil {
+		t.Fatalf("expected the slot to be free once the conversion finished, got %v", err)
+	}
+}
+
+func TestRunConversionReturnsTheError(t *testing.T) {
+	withConversionSlots(t, 1)
+	failed := errors.New("failed")
+	if err := runConversion(context.Background(), func() error { return failed }); err != failed {
+		t.Fatalf("expected %v, got %v", failed, err)
+	}
+}
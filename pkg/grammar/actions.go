@@ -0,0 +1,55 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The versions of the actions the converted workflows use, unless the ActionVersions option overrides them
+var actionVersions = map[string]string{
+	"actions/checkout":                      "v3",
+	"actions/download-artifact":             "v3",
+	"actions/setup-go":                      "v3",
+	"actions/setup-java":                    "v3",
+	"actions/setup-node":                    "v3",
+	"actions/setup-python":                  "v4",
+	"actions/upload-artifact":               "v3",
+	"aws-actions/configure-aws-credentials": "v4",
+	"dawidd6/action-send-mail":              "v3",
+	"docker/build-push-action":              "v4",
+	"docker/login-action":                   "v2",
+	"dorny/test-reporter":                   "v1",
+	"dorny/paths-filter":                    "v3",
+}
+
+// action returns the reference `uses` takes for an action, at the version the options pin it to if any, or else at
+// its default version
+func (s conversionSettings) action(name string) string {
+	if ref, ok := s.ActionVersions[name]; ok && ref != "" {
+		return fmt.Sprintf("%s@%s", name, ref)
+	}
+	return fmt.Sprintf("%s@%s", name, actionVersions[name])
+}
+
+// ParseActionVersions reads the versions to pin actions to from a comma separated list of action=ref pairs, like
+// `actions/checkout=v4,actions/setup-java=0ab4596768b603586c0de567f2430c30f5b0d2b0`
+func ParseActionVersions(text string) (map[string]string, error) {
+	versions := make(map[string]string)
+	for _, pair := range strings.Split(text, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, ref, ok := strings.Cut(pair, "=")
+		name, ref = strings.TrimSpace(name), strings.TrimSpace(ref)
+		if !ok || name == "" || ref == "" {
+			return nil, errors.Errorf("the action version '%s' isn't of the form action=ref", pair)
+		}
+		if _, known := actionVersions[name]; !known {
+			return nil, errors.Errorf("the action '%s' isn't used by converted workflows", name)
+		}
+		versions[name] = ref
+	}
+	return versions, nil
+}
@@ -0,0 +1,122 @@
+package grammar
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Matches the declaration of the pipeline's post conditions, or of a stage's
+var postDeclarationRegexp = regexp.MustCompile(`(?m)^\s*post\s*\{`)
+
+// Annotation refers a job of a converted workflow back to the construct of the Jenkinsfile it is converted from, for
+// showing the two side by side
+type Annotation struct {
+	// Job is the id of the job
+	Job string `json:"job"`
+	// YamlLine is the line of the workflow the job starts on, counting from 1
+	YamlLine int `json:"yamlLine"`
+	// Construct is what the job is converted from: a stage, the pipeline's post conditions, or the changesets of the
+	// stages
+	Construct string `json:"construct"`
+	// Stage is the name of the stage the job is converted from, if any
+	Stage string `json:"stage,omitempty"`
+	// Branch is the name of the parallel branch of the stage the job runs, if any
+	Branch string `json:"branch,omitempty"`
+	// Line is the line of the Jenkinsfile the construct is declared on, counting from 1, if it can be found
+	Line int `json:"line,omitempty"`
+}
+
+// jobSource is the construct of the Jenkinsfile a job is converted from
+type jobSource struct {
+	JobID     string
+	Construct string
+	Stage     string
+	Branch    string
+}
+
+// addJobSource records the construct a job is converted from
+func (s conversionSettings) addJobSource(source jobSource) {
+	if s.jobSources == nil {
+		return
+	}
+	*s.jobSources = append(*s.jobSources, source)
+}
+
+// Annotations returns an annotation for each job of the workflow. jf is the text the model is parsed from, which the
+// annotations' lines refer to.
+func (w *WorkflowSections) Annotations(jf string) []Annotation {
+	return annotationsFor(w.jobSources, strings.Join(w.Lines(), "\n"), jf, w.indentWidth)
+}
+
+// ToAnnotatedYaml converts the Jenkinsfile model into a workflow like ToYamlWithOptions, along with an annotation for
+// each job. jf is the text the model is parsed from, which the annotations' lines refer to.
+func (m *Model) ToAnnotatedYaml(jf string, opts ConvertOptions) (string, []Annotation, bool, error) {
+	sections, conversionIssues, err := m.ToWorkflowSections(opts)
+	if err != nil {
+		return "", nil, conversionIssues, err
+	}
+	return strings.Join(sections.Lines(), "\n"), sections.Annotations(jf), conversionIssues, nil
+}
+
+// annotationsFor locates the jobs in the workflow and the constructs they are converted from in the Jenkinsfile. The
+// model is parsed from an escaped form of the Jenkinsfile, whose lines don't match the original's, so declarations
+// are looked up in the original text instead. The jobs are indented by the given width.
+func annotationsFor(sources []jobSource, asYaml string, jf string, indentWidth int) []Annotation {
+	yamlLines := strings.Split(asYaml, "\n")
+	jobsLine := 0
+	for i, l := range yamlLines {
+		if l == "jobs:" {
+			jobsLine = i
+			break
+		}
+	}
+	var annotations []Annotation
+	for _, source := range sources {
+		annotation := Annotation{
+			Job:       source.JobID,
+			Construct: source.Construct,
+			Stage:     source.Stage,
+			Branch:    source.Branch,
+		}
+		for i := jobsLine; i < len(yamlLines); i++ {
+			if yamlLines[i] == strings.Repeat(" ", indentWidth)+source.JobID+":" {
+				annotation.YamlLine = i + 1
+				break
+			}
+		}
+		switch source.Construct {
+		case "stage":
+			annotation.Line = stageDeclarationLine(jf, source.Stage, source.Branch)
+		case "post":
+			if matches := postDeclarationRegexp.FindAllStringIndex(jf, -1); len(matches) > 0 {
+				// The pipeline's post conditions follow its stages, so they are declared last
+				annotation.Line = lineAt(jf, matches[len(matches)-1][1]-1)
+			}
+		}
+		annotations = append(annotations, annotation)
+	}
+	return annotations
+}
+
+// stageDeclarationLine returns the line a stage is declared on, or the line of its parallel branch if any, or 0 if
+// the declaration can't be found
+func stageDeclarationLine(jf string, stage string, branch string) int {
+	stageRegexp := regexp.MustCompile(`stage\s*\(\s*['"]` + regexp.QuoteMeta(stage) + `['"]\s*\)`)
+	loc := stageRegexp.FindStringIndex(jf)
+	if loc == nil {
+		return 0
+	}
+	if branch != "" {
+		// A branch is either a nested stage or a key of the parallel step's map
+		branchRegexp := regexp.MustCompile(`stage\s*\(\s*['"]` + regexp.QuoteMeta(branch) + `['"]\s*\)|['"]?` + regexp.QuoteMeta(branch) + `['"]?\s*:\s*\{`)
+		if branchLoc := branchRegexp.FindStringIndex(jf[loc[1]:]); branchLoc != nil {
+			return lineAt(jf, loc[1]+branchLoc[0])
+		}
+	}
+	return lineAt(jf, loc[0])
+}
+
+// lineAt returns the line of the offset in the text, counting from 1
+func lineAt(text string, offset int) int {
+	return strings.Count(text[:offset], "\n") + 1
+}
@@ -0,0 +1,93 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	// Arguments of the junit step that map to inputs of the test reporter action
+	junitMappedArgs = []string{
+		"testResults",
+		"allowEmptyResults",
+	}
+	// Arguments of the archiveArtifacts step that map to inputs of the upload-artifact action
+	archiveArtifactsMappedArgs = []string{
+		"artifacts",
+		"excludes",
+		"allowEmptyArchive",
+	}
+)
+
+// getPatternsArg returns the comma separated file patterns a step is given, either as its only argument or as the
+// named argument
+func (m *ModelStep) getPatternsArg(key string) []string {
+	value := m.getNamedArg(key)
+	if value == "" && len(m.Args) == 1 && m.Args[0].Unnamed != nil {
+		value = m.getArg()
+	}
+	return splitPatterns(value)
+}
+
+// splitPatterns splits comma separated file patterns, like `build/*.jar, build/*.war`. Shell variables in them are
+// read from env, since action inputs aren't expanded by a shell.
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, p := range strings.Split(unescapeArg(value), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, toActionInput(p))
+		}
+	}
+	return patterns
+}
+
+// commentsForUnmappedArgs notes the named arguments of a step that the action replacing it has no input for
+func commentsForUnmappedArgs(step *ModelStep, mappedArgs []string, action string, indent int) []string {
+	var lines []string
+	for _, a := range step.Args {
+		if a.Named != nil && !isSupportedField(a.Named.Key, mappedArgs, false) {
+			lines = append(lines, indentLine(fmt.Sprintf("# The argument '%s' of the Jenkins Pipeline step %s has no equivalent in %s and is not converted.", a.Named.Key, step.Name, action), indent+2))
+		}
+	}
+	return lines
+}
+
+// linesForJunitStep converts the junit step into a test reporter action, which publishes the test results as a check
+// run of the commit
+func linesForJunitStep(step *ModelStep, indent int, settings conversionSettings) []string {
+	var stepLines []string
+	stepLines = append(stepLines, indentLine("# The test results are published as a check run, which needs the checks: write permission.", indent+2))
+	stepLines = append(stepLines, commentsForUnmappedArgs(step, junitMappedArgs, "the test reporter", indent)...)
+	stepLines = append(stepLines, indentLine("uses: "+settings.action("dorny/test-reporter"), indent+2))
+	stepLines = append(stepLines, indentLine("with:", indent+2))
+	stepLines = append(stepLines, indentLine("name: JUnit tests", indent+3))
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("path: %s", yamlQuote(strings.Join(step.getPatternsArg("testResults"), ","))), indent+3))
+	stepLines = append(stepLines, indentLine("reporter: java-junit", indent+3))
+	if step.getNamedArg("allowEmptyResults") == "true" {
+		stepLines = append(stepLines, indentLine("fail-on-empty: false", indent+3))
+	}
+	return stepLines
+}
+
+// linesForArchiveArtifacts converts the archiveArtifacts step into the upload-artifact action. Like Jenkins, the step
+// fails if no files match, unless an empty archive is allowed.
+func linesForArchiveArtifacts(step *ModelStep, indent int, settings conversionSettings) []string {
+	var stepLines []string
+	stepLines = append(stepLines, commentsForUnmappedArgs(step, archiveArtifactsMappedArgs, "actions/upload-artifact", indent)...)
+	stepLines = append(stepLines, indentLine("uses: "+settings.action("actions/upload-artifact"), indent+2))
+	stepLines = append(stepLines, indentLine("with:", indent+2))
+	stepLines = append(stepLines, indentLine("name: artifacts", indent+3))
+	stepLines = append(stepLines, indentLine("path: |", indent+3))
+	for _, p := range step.getPatternsArg("artifacts") {
+		stepLines = append(stepLines, indentLine(p, indent+4))
+	}
+	for _, p := range splitPatterns(step.getNamedArg("excludes")) {
+		stepLines = append(stepLines, indentLine("!"+p, indent+4))
+	}
+	ifNoFilesFound := "error"
+	if step.getNamedArg("allowEmptyArchive") == "true" {
+		ifNoFilesFound = "ignore"
+	}
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("if-no-files-found: %s", ifNoFilesFound), indent+3))
+	return stepLines
+}
@@ -0,0 +1,162 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const defaultBranch = "master"
+
+// Matches the branch of a single pull request in a multibranch pipeline, like PR-12
+var pullRequestNumberRegexp = regexp.MustCompile(`^PR-([0-9]+)$`)
+
+// isPullRequestBranch checks if the branch pattern matches the PR-<number> branches multibranch pipelines build pull
+// requests on
+func isPullRequestBranch(branch string) bool {
+	return strings.HasPrefix(branch, "PR-")
+}
+
+// branchCondition converts the branches of a when condition into an expression matching the same branches on
+// GitHub Actions, and comments for the patterns that can't be matched.
+func branchCondition(branches []string) (string, []string) {
+	var conditions []string
+	var comments []string
+	var names []string
+	var pullRequests []string
+	hasPullRequest := false
+	for _, b := range branches {
+		switch {
+		case pullRequestNumberRegexp.MatchString(b):
+			pullRequests = appendIfMissing(pullRequests, pullRequestNumberRegexp.FindStringSubmatch(b)[1])
+		case isPullRequestBranch(b):
+			hasPullRequest = true
+		case !strings.ContainsAny(b, "*?["):
+			names = appendIfMissing(names, b)
+		case strings.Index(b, "*") == len(b)-1 && !strings.ContainsAny(b[:len(b)-1], "*?["):
+			conditions = append(conditions, fmt.Sprintf("startsWith(github.ref_name, '%s')", strings.TrimSuffix(b, "*")))
+		default:
+			comments = append(comments, fmt.Sprintf("# The branch pattern '%s' can't be matched in a GitHub Actions expression and is ignored.", b))
+		}
+	}
+	if len(names) == 1 {
+		conditions = append([]string{fmt.Sprintf("github.ref_name == '%s'", names[0])}, conditions...)
+	} else if len(names) > 1 {
+		conditions = append([]string{fmt.Sprintf("contains(fromJSON('[\"%s\"]'), github.ref_name)", strings.Join(names, "\",\""))}, conditions...)
+	}
+	// Pull requests are built on PR-<number> branches in Jenkins, and run on the pull_request event on GitHub Actions,
+	// with their number in the event
+	if hasPullRequest {
+		conditions = append(conditions, "github.event_name == 'pull_request'")
+		comments = append(comments, "# PR-* branches are the pull requests Jenkins builds, matched by the pull_request event here.")
+	} else if len(pullRequests) > 0 {
+		for _, n := range pullRequests {
+			conditions = append(conditions, fmt.Sprintf("github.event.pull_request.number == %s", n))
+		}
+		if len(pullRequests) == 1 {
+			comments = append(comments, fmt.Sprintf("# The branch PR-%s is a pull request Jenkins builds, matched by its number here.", pullRequests[0]))
+		} else {
+			comments = append(comments, fmt.Sprintf("# The branches PR-%s are pull requests Jenkins builds, matched by their numbers here.", strings.Join(pullRequests, ", PR-")))
+		}
+	}
+	return strings.Join(conditions, " || "), comments
+}
+
+// notBranchCondition converts the branches of a `not { branch ... }` condition into an expression matching any other
+// branch, and comments for the patterns that can't be matched. Pushes to branches the workflow isn't triggered on
+// don't run the stage, unlike in a multibranch pipeline.
+func notBranchCondition(branches []string) (string, []string) {
+	condition, comments := branchCondition(branches)
+	if condition == "" {
+		return "", comments
+	}
+	comments = append(comments, "# The stage runs on every branch but the excluded ones, as far as pushes to them trigger the workflow.")
+	if len(branches) == 1 && !strings.ContainsAny(branches[0], "*?[") && !isPullRequestBranch(branches[0]) {
+		return fmt.Sprintf("github.ref != 'refs/heads/%s'", branches[0]), comments
+	}
+	return fmt.Sprintf("!(%s)", condition), comments
+}
+
+// getPushBranches returns the default branch and every other branch the stages are guarded by, deduplicated
+func (m *Model) getPushBranches() []string {
+	branches := []string{defaultBranch}
+	for _, s := range m.getStages() {
+		when := s.getWhen()
+		if when == nil {
+			continue
+		}
+		stageBranches, ok := when.getBranches()
+		if !ok {
+			continue
+		}
+		for _, b := range stageBranches {
+			if !isPullRequestBranch(b) {
+				branches = appendIfMissing(branches, b)
+			}
+		}
+	}
+	return branches
+}
+
+func appendIfMissing(values []string, value string) []string {
+	if containsString(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getTriggers returns the events the workflow runs on, driven by the branches the stages are guarded by: push for
+// stages guarded by branches, and pull_request for stages guarded by PR-* branches. Pipelines without branch guarded
+// stages run on both, as do stages excluding branches.
+func (m *Model) getTriggers() []string {
+	hasPush := false
+	hasPullRequest := false
+	for _, s := range m.getStages() {
+		when := s.getWhen()
+		if when == nil {
+			continue
+		}
+		if notBranches, ok := when.getNotBranches(); ok {
+			// Excluding branches runs the stage on both, unless pull requests are among them
+			hasPush = true
+			excludesPullRequest := false
+			for _, b := range notBranches {
+				excludesPullRequest = excludesPullRequest || isPullRequestBranch(b)
+			}
+			hasPullRequest = hasPullRequest || !excludesPullRequest
+			continue
+		}
+		branches, ok := when.getBranches()
+		if !ok {
+			continue
+		}
+		for _, b := range branches {
+			if isPullRequestBranch(b) {
+				hasPullRequest = true
+			} else {
+				hasPush = true
+			}
+		}
+	}
+	if !hasPush && !hasPullRequest {
+		return []string{"push", "pull_request"}
+	}
+
+	var triggers []string
+	if hasPush {
+		triggers = append(triggers, "push")
+	}
+	if hasPullRequest {
+		triggers = append(triggers, "pull_request")
+	}
+	return triggers
+}
@@ -0,0 +1,129 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Matches assignments like `currentBuild.result = 'UNSTABLE'`, but not comparisons
+	buildResultAssignmentRegexp = regexp.MustCompile(`currentBuild\.result\s*=\s*['"](\w+)['"]\s*;?`)
+	buildResultReferenceRegexp  = regexp.MustCompile(`currentBuild\.(result|currentResult)\b`)
+	// Matches lines that only hold control flow around the assignments, once those are removed
+	buildResultControlLineRegexp = regexp.MustCompile(`^[\s{}]*((if\s*\(.*\)|else|try|catch\s*\(.*\)|finally)[\s{}]*)*$`)
+	buildResultConditionRegexp   = regexp.MustCompile(`\b(if|catch)\b`)
+)
+
+// buildResultInScript describes how a script block uses currentBuild.result
+type buildResultInScript struct {
+	// Results assigned to currentBuild.result, in order
+	Results []string
+	// Only is set if the script does nothing but assign the result, possibly within conditions
+	Only bool
+	// Conditional is set if the assignments depend on a condition or a caught error
+	Conditional bool
+	// Referenced is set if the script reads or writes currentBuild.result
+	Referenced bool
+}
+
+// buildResultFromScript finds the currentBuild.result assignments in the escaped text of a script block
+func buildResultFromScript(escaped string) buildResultInScript {
+	script := unescapeArg(escaped)
+	br := buildResultInScript{
+		Referenced:  buildResultReferenceRegexp.MatchString(script),
+		Conditional: buildResultConditionRegexp.MatchString(script),
+	}
+	for _, match := range buildResultAssignmentRegexp.FindAllStringSubmatch(script, -1) {
+		br.Results = append(br.Results, strings.ToUpper(match[1]))
+	}
+	if len(br.Results) == 0 {
+		return br
+	}
+	br.Only = true
+	for _, l := range strings.Split(buildResultAssignmentRegexp.ReplaceAllString(script, ""), "\n") {
+		if !buildResultControlLineRegexp.MatchString(l) {
+			br.Only = false
+			break
+		}
+	}
+	return br
+}
+
+// hasResult checks if the script assigns the given result
+func (br buildResultInScript) hasResult(result string) bool {
+	for _, r := range br.Results {
+		if r == result {
+			return true
+		}
+	}
+	return false
+}
+
+// commentsForBuildResult explains how to replace a currentBuild.result assignment or reference that can't be
+// converted along with the rest of the script
+func commentsForBuildResult(br buildResultInScript, indent int) []string {
+	var stepLines []string
+	for _, r := range br.Results {
+		switch r {
+		case "UNSTABLE":
+			stepLines = append(stepLines, indentLine("# The script sets currentBuild.result to 'UNSTABLE'. GitHub Actions has no unstable result, so set 'continue-on-error: true' on the step that may fail,", indent+2))
+			stepLines = append(stepLines, indentLine("# and write a note to $GITHUB_STEP_SUMMARY to flag the run.", indent+2))
+		case "FAILURE", "ABORTED":
+			stepLines = append(stepLines, indentLine(fmt.Sprintf("# The script sets currentBuild.result to '%s'. Use 'exit 1' in a run step to fail the job instead.", r), indent+2))
+		default:
+			stepLines = append(stepLines, indentLine(fmt.Sprintf("# The script sets currentBuild.result to '%s'. The job result on GitHub Actions follows the outcome of its steps instead.", r), indent+2))
+		}
+	}
+	if len(br.Results) == 0 && br.Referenced {
+		stepLines = append(stepLines, indentLine("# The script reads currentBuild.result. Use the 'job.status' context or the success() and failure() status functions instead.", indent+2))
+	}
+	return stepLines
+}
+
+// continueOnError lets a step fail without failing the job, returning the step along with its id, which the step keeps
+// if it has one already
+func continueOnError(step string, indent int, settings conversionSettings) (string, string) {
+	idPrefix := indentLine("id: ", indent+2)
+	continuePrefix := indentLine("continue-on-error: ", indent+2)
+	id := ""
+	continues := false
+	for _, l := range strings.Split(step, "\n") {
+		if strings.HasPrefix(l, idPrefix) {
+			id = strings.TrimPrefix(l, idPrefix)
+		}
+		if strings.HasPrefix(l, continuePrefix) {
+			continues = true
+		}
+	}
+	if id == "" {
+		id = settings.stepIDs.forStep("result-check")
+		step += "\n" + indentLine(fmt.Sprintf("id: %s", id), indent+2)
+	}
+	if !continues {
+		step += "\n" + indentLine("continue-on-error: true", indent+2)
+	}
+	return step, id
+}
+
+// linesForBuildResult converts a script block that only assigns currentBuild.result into a step noting the result
+// in the job summary. If previousStepID is given, the step only runs when the step with that id failed.
+func linesForBuildResult(br buildResultInScript, previousStepID string, indent int) []string {
+	result := br.Results[len(br.Results)-1]
+	fails := br.hasResult("FAILURE") || br.hasResult("ABORTED")
+
+	var stepLines []string
+	if previousStepID != "" {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("# The Jenkinsfile sets currentBuild.result to '%s' when a condition holds, typically a failure of the previous step.", result), indent+2))
+		stepLines = append(stepLines, indentLine("# The previous step continues on error instead, and this step notes its failure in the job summary. Please check the condition matches.", indent+2))
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("if: ${{ steps.%s.outcome == 'failure' }}", previousStepID), indent+2))
+	} else {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("# The Jenkinsfile sets currentBuild.result to '%s'. GitHub Actions has no such result, so it is noted in the job summary.", result), indent+2))
+	}
+	run := fmt.Sprintf(`%s >> "$GITHUB_STEP_SUMMARY"`, toEchoCommand(fmt.Sprintf(":warning: Build result set to %s", result)))
+	if fails {
+		run += " && exit 1"
+	}
+	stepLines = append(stepLines, indentLine("run: "+toYamlScalar(run), indent+2))
+	return stepLines
+}
@@ -0,0 +1,88 @@
+package grammar
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// The GitHub Actions expressions standing in for the environment variables Jenkins sets for every build
+	jenkinsBuiltins = map[string]string{
+		"BRANCH_NAME":  "${{ github.head_ref || github.ref_name }}",
+		"BUILD_ID":     "${{ github.run_id }}",
+		"BUILD_NUMBER": "${{ github.run_number }}",
+		"BUILD_URL":    "${{ github.server_url }}/${{ github.repository }}/actions/runs/${{ github.run_id }}",
+		"GIT_COMMIT":   "${{ github.sha }}",
+		"JOB_NAME":     "${{ github.workflow }}",
+		"WORKSPACE":    "${{ github.workspace }}",
+	}
+	// The variables GitHub Actions sets that stand in for the environment variables Jenkins sets for every build, for
+	// shell commands. Unlike expressions, they can't inject anything into the command, such as a branch name would.
+	jenkinsBuiltinShellVariables = map[string]string{
+		"BRANCH_NAME":  "${GITHUB_HEAD_REF:-$GITHUB_REF_NAME}",
+		"BUILD_ID":     "${GITHUB_RUN_ID}",
+		"BUILD_NUMBER": "${GITHUB_RUN_NUMBER}",
+		"BUILD_URL":    "${GITHUB_SERVER_URL}/${GITHUB_REPOSITORY}/actions/runs/${GITHUB_RUN_ID}",
+		"GIT_COMMIT":   "${GITHUB_SHA}",
+		"JOB_NAME":     "${GITHUB_WORKFLOW}",
+		"WORKSPACE":    "${GITHUB_WORKSPACE}",
+	}
+	// Matches the references to shell variables in a line of a shell command, like `$BUILD_NUMBER` or `${WORKSPACE}`,
+	// along with those whose dollar sign is left as literalDollarPlaceholder
+	shellReferenceRegexp = regexp.MustCompile(`(\$|` + regexp.QuoteMeta(literalDollarPlaceholder) + `)(?:\{(\w+)\}|(\w+))`)
+	// Matches the interpolations of variables in a double-quoted string, like `${WORKSPACE}`, `$BUILD_NUMBER` or
+	// `${env.BRANCH_NAME}`
+	variableInterpolationRegexp = regexp.MustCompile(`\$\{(?:env\.)?(\w+)\}|\$(?:env\.)?(\w+)`)
+	// Matches GitHub Actions expressions, like `${{ github.workspace }}`
+	expressionRegexp = regexp.MustCompile(`\$\{\{[^}]*\}\}`)
+)
+
+// withGitHubBuiltins replaces the interpolations of Jenkins' built-in variables in a value with the GitHub Actions
+// expressions standing in for them. It returns false if the value still interpolates any other variable.
+func withGitHubBuiltins(value string) (string, bool) {
+	replaced := variableInterpolationRegexp.ReplaceAllStringFunc(value, func(interpolation string) string {
+		groups := variableInterpolationRegexp.FindStringSubmatch(interpolation)
+		if expression, ok := jenkinsBuiltins[groups[1]+groups[2]]; ok {
+			return expression
+		}
+		return interpolation
+	})
+	if strings.Contains(expressionRegexp.ReplaceAllString(replaced, ""), "$") {
+		return "", false
+	}
+	return replaced, true
+}
+
+// withGitHubBuiltinVariables replaces the references to Jenkins' built-in variables in the lines of a shell command
+// with the variables GitHub Actions sets instead. Variables the command sets itself are left alone, since they are
+// the command's own rather than Jenkins'.
+func withGitHubBuiltinVariables(lines []string) []string {
+	script := strings.Join(lines, "\n")
+	var replaced []string
+	for _, l := range lines {
+		replaced = append(replaced, withGitHubBuiltinVariable(l, script))
+	}
+	return replaced
+}
+
+// withGitHubBuiltinVariable replaces the references to Jenkins' built-in variables in a line of the shell command
+// with the variables GitHub Actions sets instead, unless the command sets them itself
+func withGitHubBuiltinVariable(line string, script string) string {
+	return shellReferenceRegexp.ReplaceAllStringFunc(line, func(reference string) string {
+		groups := shellReferenceRegexp.FindStringSubmatch(reference)
+		name := groups[2] + groups[3]
+		variable, ok := jenkinsBuiltinShellVariables[name]
+		if !ok || setsShellVariable(script, name) {
+			return reference
+		}
+		// Keep a literal dollar sign literal, for withLiteralDollars to turn back into a plain one
+		return groups[1] + strings.TrimPrefix(variable, "$")
+	})
+}
+
+// setsShellVariable checks if a shell command assigns the variable, like `WORKSPACE=/tmp` or `read BUILD_ID`
+func setsShellVariable(script string, name string) bool {
+	quoted := regexp.QuoteMeta(name)
+	assignmentRegexp := regexp.MustCompile(`(^|[\s;&|(])` + quoted + `=|\b(export|local|declare|readonly|read|for)\s+(-\w+\s+)*` + quoted + `\b`)
+	return assignmentRegexp.MatchString(script)
+}
@@ -0,0 +1,150 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The id of the job that detects the changes the stages' changesets match
+const changesJobID = "changes"
+
+// ModelWhenChangeset represents the changeset condition, like `changeset '**/*.js'` or
+// `changeset pattern: 'docs/**', caseSensitive: true`
+type ModelWhenChangeset struct {
+	Pattern string                  `parser:"( @(String|Char) | \"pattern\" \":\" @(String|Char) )" json:"pattern,omitempty"`
+	Options []*ModelChangesetOption `parser:"{ \",\" @@ }" json:"options,omitempty"`
+}
+
+// ModelChangesetOption represents an option of the changeset condition, like `comparator: 'REGEXP'`
+type ModelChangesetOption struct {
+	Key   string `parser:"@Ident \":\"" json:"key,omitempty"`
+	Value string `parser:"@(String|Char|Ident)" json:"value,omitempty"`
+}
+
+// getPath returns the pattern of the changeset as a path filter, and false if it is compared in a way path filters
+// can't do, like with a regular expression
+func (m *ModelWhenChangeset) getPath() (string, bool) {
+	for _, o := range m.Options {
+		if o.Key == "comparator" && strings.ToUpper(unescapeArg(o.Value)) == "REGEXP" {
+			return "", false
+		}
+	}
+	return unescapeArg(m.Pattern), true
+}
+
+// getChangesets returns the paths the condition matches changes to, and false if it depends on anything but
+// changesets
+func (m *ModelWhen) getChangesets() ([]string, bool) {
+	if len(m.Unsupported) > 0 || m.Branch != "" || m.ChangeRequest || m.Not != nil {
+		return nil, false
+	}
+	if m.Changeset != nil {
+		path, ok := m.Changeset.getPath()
+		if !ok {
+			return nil, false
+		}
+		return []string{path}, true
+	}
+	var paths []string
+	for _, c := range m.AnyOf {
+		nested, ok := c.getChangesets()
+		if !ok {
+			return nil, false
+		}
+		for _, p := range nested {
+			paths = appendIfMissing(paths, p)
+		}
+	}
+	return paths, len(paths) > 0
+}
+
+// getChangesets returns the paths the stage runs on changes to, if it is guarded by changesets
+func (m *ModelStage) getChangesets() []string {
+	when := m.getWhen()
+	if when == nil {
+		return nil
+	}
+	paths, _ := when.getChangesets()
+	return paths
+}
+
+// getWorkflowPaths returns the paths a workflow on the given triggers can be filtered on, which is when every stage it
+// runs is guarded by the same changesets
+func (m *Model) getWorkflowPaths(onTrigger []string) []string {
+	var paths []string
+	for _, s := range m.getStages() {
+		when := s.getWhen()
+		if when == nil {
+			return nil
+		}
+		if branches, ok := when.getBranches(); ok {
+			for _, b := range branches {
+				if (isPullRequestBranch(b) && containsString(onTrigger, "pull_request")) || (!isPullRequestBranch(b) && containsString(onTrigger, "push")) {
+					return nil
+				}
+			}
+			continue
+		}
+		if _, ok := when.getNotBranches(); ok {
+			return nil
+		}
+		stagePaths, ok := when.getChangesets()
+		if !ok {
+			// The stage isn't converted
+			continue
+		}
+		if paths != nil && strings.Join(paths, "\n") != strings.Join(stagePaths, "\n") {
+			return nil
+		}
+		paths = stagePaths
+	}
+	return paths
+}
+
+// linesForWorkflowPaths filters a trigger of the workflow on the paths the stages' changesets match
+func linesForWorkflowPaths(paths []string, indent int) []string {
+	var lines []string
+	lines = append(lines, indentLine("paths:", indent))
+	for _, p := range paths {
+		lines = append(lines, indentLine(fmt.Sprintf("- %s", yamlQuote(p)), indent+1))
+	}
+	return lines
+}
+
+// changesetFilter is the paths filter of a job that runs only when files matching its stage's changesets change
+type changesetFilter struct {
+	JobID string
+	Paths []string
+}
+
+// condition returns the expression checking the changes job found changes to the filter's paths
+func (f changesetFilter) condition() string {
+	return fmt.Sprintf("needs.%s.outputs.%s == 'true'", changesJobID, f.JobID)
+}
+
+// linesForChangesJob detects the files changed among the paths the stages' changesets match, so that the jobs of those
+// stages can be skipped when none of theirs changed
+func linesForChangesJob(filters []changesetFilter, runsOn string, indent int, settings conversionSettings) []string {
+	var lines []string
+	lines = append(lines, indentLine(fmt.Sprintf("%s:", changesJobID), indent))
+	lines = append(lines, indentLine("# Some stages only run when files matching their changeset change, and the stages don't share a changeset,", indent+1))
+	lines = append(lines, indentLine(fmt.Sprintf("# so the workflow can't be filtered on paths. This job detects the changes with %s instead.", settings.action("dorny/paths-filter")), indent+1))
+	lines = append(lines, indentLine(fmt.Sprintf("runs-on: %s", runsOn), indent+1))
+	lines = append(lines, indentLine("outputs:", indent+1))
+	for _, f := range filters {
+		lines = append(lines, indentLine(fmt.Sprintf("%s: ${{ steps.filter.outputs.%s }}", f.JobID, f.JobID), indent+2))
+	}
+	lines = append(lines, indentLine("steps:", indent+1))
+	lines = append(lines, linesForDefaultCheckout(false, indent+2, settings)...)
+	lines = append(lines, indentLine("- uses: "+settings.action("dorny/paths-filter"), indent+2))
+	lines = append(lines, indentLine("id: filter", indent+3))
+	lines = append(lines, indentLine("with:", indent+3))
+	lines = append(lines, indentLine("filters: |", indent+4))
+	for _, f := range filters {
+		lines = append(lines, indentLine(fmt.Sprintf("%s:", f.JobID), indent+5))
+		for _, p := range f.Paths {
+			lines = append(lines, indentLine(fmt.Sprintf("- %s", yamlQuote(p)), indent+6))
+		}
+	}
+	return lines
+}
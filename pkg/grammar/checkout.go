@@ -0,0 +1,50 @@
+package grammar
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Matches commands that read the git history or tags, which a shallow clone doesn't have
+var gitHistoryRegexp = regexp.MustCompile(`\bgit\s+(log|describe|tag|rev-list|shortlog|merge-base)\b|\b(gitversion|semantic-release|setuptools[-_]scm|jgitver|standard-version)\b`)
+
+// usesGitHistory checks if any command run by the converted steps reads the git history
+func usesGitHistory(steps []string) bool {
+	for _, step := range steps {
+		for _, l := range strings.Split(step, "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(l), "#") && gitHistoryRegexp.MatchString(l) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// linesForDefaultCheckout emits the checkout step every job starts with. If fullHistory is set, the whole history is
+// fetched instead of the latest commit only.
+func linesForDefaultCheckout(fullHistory bool, indent int, settings conversionSettings) []string {
+	var lines []string
+	lines = append(lines, indentLine("# Checks-out your repository under $GITHUB_WORKSPACE, so your job can access it", indent))
+	if fullHistory {
+		lines = append(lines, indentLine("# The whole history is fetched, since the job reads it.", indent))
+	}
+	lines = append(lines, indentLine("- uses: "+settings.action("actions/checkout"), indent))
+	if fullHistory {
+		lines = append(lines, indentLine("with:", indent+1))
+		lines = append(lines, indentLine("fetch-depth: 0", indent+2))
+	}
+	return lines
+}
+
+// withFullHistory makes the converted checkout steps fetch the whole history instead of the latest commit only
+func withFullHistory(steps []string, indent int, settings conversionSettings) []string {
+	uses := indentLine("uses: "+settings.action("actions/checkout"), indent+2)
+	var result []string
+	for _, step := range steps {
+		if strings.HasSuffix(step, uses) {
+			step = strings.Join([]string{step, indentLine("with:", indent+2), indentLine("fetch-depth: 0", indent+3)}, "\n")
+		}
+		result = append(result, step)
+	}
+	return result
+}
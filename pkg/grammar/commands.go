@@ -0,0 +1,92 @@
+package grammar
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Commands that change the state of the shell they run in, which the commands after them in another step wouldn't see
+var shellStateCommands = []string{
+	"cd",
+	"pushd",
+	"popd",
+	"export",
+	"unset",
+	"source",
+	".",
+	"set",
+	"shopt",
+	"alias",
+	"ulimit",
+	"umask",
+	"eval",
+	"exec",
+}
+
+// Matches a command that only assigns shell variables, like `VERSION=1.0`
+var shellAssignmentRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=\S*$`)
+
+// splitCommands splits a one-line script, as returned by getJxArg, into the commands it joins with &&, so that each
+// can run as a step of its own. Operators in quotes, subshells, command substitutions, expressions and braces don't
+// count. The script is kept whole if it has any other top level operator than &&, like || or ;, which would run
+// commands after a failing one, or if a command other than the last changes the state of the shell, like cd.
+func splitCommands(jxArgs []string) [][]string {
+	whole := [][]string{jxArgs}
+	if len(jxArgs) != 1 {
+		return whole
+	}
+	script := jxArgs[0]
+	var commands []string
+	var quote byte
+	depth := 0
+	start := 0
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			// Skip the escaped character
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(' || c == '{' || c == '[':
+			depth++
+		case c == ')' || c == '}' || c == ']':
+			depth--
+		case depth > 0:
+		case c == '&' && i+1 < len(script) && script[i+1] == '&':
+			commands = append(commands, strings.TrimSpace(script[start:i]))
+			i++
+			start = i + 1
+		case c == '&' && (i > 0 && script[i-1] == '>' || i+1 < len(script) && script[i+1] == '>'):
+			// A redirection like 2>&1 or &> out.log
+		case c == '&' || c == ';' || c == '#' || c == '|' && i+1 < len(script) && script[i+1] == '|':
+			return whole
+		}
+	}
+	if quote != 0 || depth != 0 || len(commands) == 0 {
+		return whole
+	}
+	commands = append(commands, strings.TrimSpace(script[start:]))
+
+	var split [][]string
+	for i, command := range commands {
+		if command == "" {
+			return whole
+		}
+		if i < len(commands)-1 && changesShellState(command) {
+			return whole
+		}
+		split = append(split, []string{command})
+	}
+	return split
+}
+
+// changesShellState checks if a command changes the state of the shell it runs in, like the directory or variables
+func changesShellState(command string) bool {
+	name := strings.Fields(command)[0]
+	return containsString(shellStateCommands, name) || shellAssignmentRegexp.MatchString(command)
+}
@@ -0,0 +1,297 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The file name composite actions are read from
+const compositeActionFileName = "action.yml"
+
+// compositeActionSections converts the pipeline into a composite action, which runs the steps of every stage in order,
+// followed by the post conditions, as steps of the job using it. There are no jobs in a composite action, so the
+// stages run one after the other on the caller's runner, and the caller checks out the repository. Parameters become
+// inputs, and so do the secrets the steps read, since composite actions can't read secrets.
+func (m *Model) compositeActionSections(sections *WorkflowSections, settings conversionSettings) (*WorkflowSections, bool, error) {
+	conversionIssues := false
+	issues := settings.issues
+	stepIndent := 1
+	// The steps of every stage are in the same action, so their ids are unique across all of them
+	settings.stepIDs = make(jobIDs)
+
+	name := settings.WorkflowName
+	if name == "" {
+		name = defaultWorkflowName
+	}
+	sections.Header = []string{
+		fmt.Sprintf("name: %s", toYamlScalar(name)),
+		"description: Runs the steps of the Jenkins pipeline it is converted from.",
+		"",
+	}
+
+	var comments []string
+	for _, u := range m.getUnsupported() {
+		conversionIssues = true
+		settings.addIssue("the %s directive", u.Name)
+		settings.countUnsupportedDirective()
+		comments = append(comments, fmt.Sprintf("# The Jenkinsfile contains the %s directive for its pipeline. This is not converted.", u.Name))
+	}
+	for _, o := range m.getOptions() {
+		if o.Name == "skipDefaultCheckout" {
+			continue
+		}
+		conversionIssues = true
+		settings.addIssue("the option %s", o.Name)
+		settings.countUnsupportedDirective()
+		comments = append(comments, fmt.Sprintf("# The option %s isn't converted, since a composite action has no job to set it on.", o.Name))
+	}
+	if m.getAgent().getLabel() != "" || m.getAgent().getPodYaml() != "" || m.getAgent() != nil && m.getAgent().Docker != nil {
+		comments = append(comments, "# The agent of the pipeline isn't converted. The steps run on the runner of the job using the action.")
+	}
+
+	var steps []string
+	envLines, err := toEnvYamlLines(m.getCompositeEnvironment(), m)
+	if err != nil {
+		return nil, conversionIssues, err
+	}
+	if len(envLines) > 0 {
+		steps = append(steps, strings.Join(linesForActionEnv(envLines, stepIndent), "\n"))
+	}
+
+	for _, stage := range m.getStages() {
+		for _, s := range stage.toParallelJobs() {
+			stageSettings := settings
+			stageSettings.stage = s.Name
+			stageSteps, stageIssues := m.compositeStageSteps(s, stepIndent, stageSettings)
+			if stageIssues {
+				conversionIssues = true
+			}
+			steps = append(steps, stageSteps...)
+		}
+	}
+	postSteps, postIssues := linesForPost(m.getPost(), false, stepIndent, settings)
+	if postIssues {
+		conversionIssues = true
+	}
+	steps = append(steps, postSteps...)
+
+	// Every run step of a composite action names its shell
+	runPrefix := indentLine("run: ", stepIndent+2)
+	shellPrefix := indentLine("shell: ", stepIndent+2)
+	for i, step := range steps {
+		if strings.Contains("\n"+step, "\n"+runPrefix) && !strings.Contains("\n"+step, "\n"+shellPrefix) {
+			steps[i] = step + "\n" + indentLine("shell: "+defaultShell, stepIndent+2)
+		}
+	}
+
+	var runs []string
+	runs = append(runs, comments...)
+	runs = append(runs, "runs:")
+	runs = append(runs, indentLine("using: composite", 1))
+	runs = append(runs, indentLine("steps:", 1))
+	if len(steps) == 0 {
+		conversionIssues = true
+		settings.addIssue("no stages were found that will be run")
+		runs = append(runs, indentLine("# No stages were found that will be run.", 2))
+		steps = append(steps, indentLine("run: echo 'No stages found, failing' && exit 1", stepIndent+2)+"\n"+indentLine("shell: "+defaultShell, stepIndent+2))
+	}
+	runs = append(runs, namedStepLines(steps, stepIndent+1, settings)...)
+
+	// Composite actions can't read secrets, so the caller passes them as inputs
+	secrets := getSecretNames(runs)
+	for i, l := range runs {
+		l = strings.ReplaceAll(l, "${{ secrets.GITHUB_TOKEN }}", "${{ github.token }}")
+		runs[i] = secretReferenceRegexp.ReplaceAllString(l, "${{ inputs.$1 }}")
+	}
+	inputLines, inputIssues := linesForActionInputs(m.getParameters(), secrets, 0, settings)
+	if inputIssues {
+		conversionIssues = true
+	}
+	sections.On = inputLines
+	sections.Jobs = runs
+	sections.Summary.Issues = *issues
+
+	if settings.Strict && len(*issues) > 0 {
+		return nil, conversionIssues, errors.Errorf("the Jenkinsfile contains constructs that are not fully converted:\n- %s", strings.Join(*issues, "\n- "))
+	}
+	return sections, conversionIssues, nil
+}
+
+// getCompositeEnvironment returns the environment the steps of a composite action run with: the pipeline's, and the
+// parameters the steps read as variables
+func (m *Model) getCompositeEnvironment() []*ModelEnvironmentEntry {
+	parameterEnv, _ := m.getParameterEnv()
+	return append(parameterEnv, m.getEnvironment()...)
+}
+
+// compositeStageSteps converts the steps of a stage, and its post conditions, into steps of a composite action. The
+// branches a stage runs on, or the file it checks for, become the condition of each of its steps, and stages with
+// other when conditions are left out.
+func (m *Model) compositeStageSteps(s *ModelStage, indent int, settings conversionSettings) ([]string, bool) {
+	conversionIssues := false
+	var steps []string
+	var comments []string
+	comments = append(comments, indentLine(fmt.Sprintf("# The steps of the stage '%s'.", s.Name), indent+1))
+
+	condition := ""
+	fileCheck, checksFile := s.getWhen().getFileExists()
+	if when := s.getWhen(); when != nil && !checksFile {
+		var branchComments []string
+		if notBranches, ok := when.getNotBranches(); ok {
+			condition, branchComments = notBranchCondition(notBranches)
+		} else if branches, ok := when.getBranches(); ok {
+			condition, branchComments = branchCondition(branches)
+		} else {
+			settings.addIssue("the when condition of the stage, which the steps of a composite action can't check")
+			settings.countStage(false)
+			return []string{indentLine(fmt.Sprintf("# The stage '%s' has a when condition other than branches, which the steps of a composite action can't check. It is not converted.", s.Name), indent+1)}, true
+		}
+		for _, c := range branchComments {
+			comments = append(comments, indentLine(c, indent+1))
+		}
+	}
+	for _, u := range s.getUnsupported() {
+		conversionIssues = true
+		settings.addIssue("the %s directive", u.Name)
+		settings.countUnsupportedDirective()
+		comments = append(comments, indentLine(fmt.Sprintf("# The Jenkinsfile contains the %s directive for the stage '%s'. This is not converted.", u.Name, s.Name), indent+1))
+	}
+	if agent := s.getAgent(); agent != nil {
+		comments = append(comments, indentLine("# The agent of the stage isn't converted. Its steps run on the runner of the job using the action.", indent+1))
+	}
+	if len(s.getOptions()) > 0 {
+		conversionIssues = true
+		settings.addIssue("the options of the stage, which a composite action has no job to set on")
+		comments = append(comments, indentLine("# The options of the stage aren't converted, since a composite action has no job to set them on.", indent+1))
+	}
+	if len(s.getEnvironment()) > 0 {
+		envLines, err := toEnvYamlLines(s.getEnvironment(), m)
+		if err == nil && len(envLines) > 0 {
+			comments = append(comments, indentLine("# The environment of the stage is set for the rest of the action's steps, not only those of the stage.", indent+1))
+			steps = append(steps, strings.Join(linesForActionEnv(envLines, indent), "\n"))
+		}
+	}
+
+	_, stageSteps, stageIssues := s.toImageAndSteps(indent, settings)
+	postSteps, postIssues := linesForPost(s.getPost(), false, indent, settings)
+	if stageIssues || postIssues {
+		conversionIssues = true
+	}
+	steps = append(steps, stageSteps...)
+	steps = append(steps, postSteps...)
+	if checksFile {
+		// The steps of every stage are in the same job
+		fileCheck.StepID = fmt.Sprintf("%s-%s", fileExistsStepID, jobIDs{}.forName(s.Name))
+		steps = withFileExistsCheck(steps, fileCheck, indent, settings)
+	}
+	if condition != "" {
+		for i, step := range steps {
+			if !isCommentOnly(step) {
+				steps[i] = withStepCondition(step, condition, indent)
+			}
+		}
+	}
+	settings.countStage(true)
+	return append([]string{strings.Join(comments, "\n")}, steps...), conversionIssues
+}
+
+// linesForActionEnv sets environment variables for the steps after it, which is how a composite action, having no env
+// of its own, sets them. The values are given as the env of the step, so that their expressions are evaluated.
+func linesForActionEnv(envYamlLines []string, indent int) []string {
+	var stepLines []string
+	var names []string
+	stepLines = append(stepLines, indentLine("name: Set the environment", indent+2))
+	var envLines []string
+	for _, l := range envYamlLines {
+		if strings.HasPrefix(l, "#") {
+			stepLines = append(stepLines, indentLine(l, indent+2))
+			continue
+		}
+		l = strings.TrimPrefix(l, "- ")
+		if key := strings.SplitN(l, ":", 2)[0]; !strings.HasPrefix(l, " ") {
+			names = append(names, key)
+		}
+		envLines = append(envLines, indentLine(l, indent+3))
+	}
+	if len(names) == 0 {
+		return stepLines[1:]
+	}
+	stepLines = append(stepLines, indentLine("env:", indent+2))
+	stepLines = append(stepLines, envLines...)
+	stepLines = append(stepLines, indentLine("run: |", indent+2))
+	for _, n := range names {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf(`echo "%s=$%s" >> "$GITHUB_ENV"`, n, n), indent+3))
+	}
+	return stepLines
+}
+
+// linesForActionInputs converts the pipeline's parameters, and the secrets the steps read, into the inputs of a
+// composite action. Action inputs are always strings, so booleans are 'true' or 'false', and choices aren't checked.
+func linesForActionInputs(parameters []*ModelParameter, secrets []string, indent int, settings conversionSettings) ([]string, bool) {
+	conversionIssues := false
+	var lines []string
+	var inputLines []string
+	for _, p := range parameters {
+		name := p.getNamedString("name")
+		if name == "" {
+			conversionIssues = true
+			settings.addIssue("the parameter %s without a name", p.Type)
+			lines = append(lines, indentLine(fmt.Sprintf("# The parameter %s has no name and is not converted.", p.Type), indent))
+			continue
+		}
+		if p.Type == passwordParameterType {
+			// Read from the secret standing in for it, which is an input below
+			continue
+		}
+		if p.isFileParameter() {
+			conversionIssues = true
+			settings.addIssue("the file parameter '%s'", name)
+			lines = append(lines, commentForFileParameter(name, indent))
+			continue
+		}
+		description := p.getNamedString("description")
+		if description == "" {
+			description = fmt.Sprintf("The Jenkins parameter %s", name)
+		}
+		defaultValue := p.getNamedString("defaultValue")
+		switch p.Type {
+		case "string", "text":
+		case "booleanParam":
+			defaultValue = "false"
+			if v := p.getNamedValue("defaultValue"); v != nil && v.Bool != nil {
+				defaultValue = fmt.Sprintf("%t", bool(*v.Bool))
+			}
+			inputLines = append(inputLines, indentLine(fmt.Sprintf("# The boolean parameter '%s' is 'true' or 'false'. Compare it with == 'true' in conditions, since both are strings.", name), indent+1))
+		case "choice":
+			choices := p.getChoices()
+			if len(choices) > 0 && defaultValue == "" {
+				defaultValue = choices[0]
+			}
+			inputLines = append(inputLines, indentLine(fmt.Sprintf("# The choice parameter '%s' takes any string, since action inputs have no choices. Its choices are: %s.", name, strings.Join(choices, ", ")), indent+1))
+		default:
+			conversionIssues = true
+			settings.addIssue("the parameter %s '%s'", p.Type, name)
+			lines = append(lines, indentLine(fmt.Sprintf("# The parameter %s '%s' has no equivalent input and is not converted.", p.Type, name), indent))
+			continue
+		}
+		inputLines = append(inputLines, indentLine(fmt.Sprintf("%s:", name), indent+1))
+		inputLines = append(inputLines, indentLine(fmt.Sprintf("description: %s", toYamlScalar(description)), indent+2))
+		inputLines = append(inputLines, indentLine("required: false", indent+2))
+		inputLines = append(inputLines, indentLine(fmt.Sprintf("default: %s", yamlQuote(defaultValue)), indent+2))
+	}
+	for _, s := range secrets {
+		inputLines = append(inputLines, indentLine(fmt.Sprintf("%s:", s), indent+1))
+		inputLines = append(inputLines, indentLine(fmt.Sprintf("description: The secret %s, since composite actions can't read secrets", s), indent+2))
+		inputLines = append(inputLines, indentLine("required: true", indent+2))
+	}
+	if len(inputLines) > 0 {
+		lines = append(lines, indentLine("inputs:", indent))
+		lines = append(lines, inputLines...)
+	}
+	if len(lines) > 0 {
+		lines = append(lines, "")
+	}
+	return lines, conversionIssues
+}
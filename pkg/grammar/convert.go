@@ -0,0 +1,45 @@
+package grammar
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ConvertText parses the text of a Jenkinsfile and converts it into a workflow
+func ConvertText(jf string, opts ConvertOptions) (string, bool, error) {
+	model, err := parseTextForConversion(jf)
+	if err != nil {
+		return "", false, err
+	}
+	return model.ToYamlWithOptions(opts)
+}
+
+// ConvertTextToSections parses the text of a Jenkinsfile and converts it into the sections of a workflow, like
+// ToWorkflowSections
+func ConvertTextToSections(jf string, opts ConvertOptions) (*WorkflowSections, bool, error) {
+	model, err := parseTextForConversion(jf)
+	if err != nil {
+		return nil, false, err
+	}
+	return model.ToWorkflowSections(opts)
+}
+
+// ConvertTextToFiles parses the text of a Jenkinsfile and converts it into a workflow for each trigger, like
+// ToYamlFiles
+func ConvertTextToFiles(jf string, opts ConvertOptions) (map[string]string, bool, error) {
+	model, err := parseTextForConversion(jf)
+	if err != nil {
+		return nil, false, err
+	}
+	return model.ToYamlFiles(opts)
+}
+
+func parseTextForConversion(jf string) (*Model, error) {
+	model, err := ParseText(jf)
+	if errors.Is(err, ErrNoPipelineBlock) || errors.Is(err, ErrNotText) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Jenkinsfile cannot be parsed. It may contain code outside of the pipeline {} block, or it may not have a pipeline {} block at all.")
+	}
+	return model, nil
+}
@@ -0,0 +1,87 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Matches the characters that aren't allowed in the name of a GitHub secret
+var invalidSecretNameRegexp = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// toSecretName turns the id of a Jenkins credential into the name of the GitHub secret standing in for it, like
+// DOCKER_HUB for docker-hub. Secret names can't start with a digit or GITHUB_.
+func toSecretName(credentialID string) string {
+	name := strings.ToUpper(strings.Trim(invalidSecretNameRegexp.ReplaceAllString(credentialID, "_"), "_"))
+	if name == "" || unicode.IsDigit(rune(name[0])) || strings.HasPrefix(name, "GITHUB_") {
+		name = "JENKINS_" + name
+	}
+	return name
+}
+
+// referencesVariable checks if any step or environment variable of the pipeline refers to the variable
+func (m *Model) referencesVariable(name string) bool {
+	return m.referencesMatch(regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`))
+}
+
+// referencesShellVariable checks if any step or environment variable of the pipeline reads the variable the way a
+// shell or a Groovy interpolation does, like `$VERSION` or `${VERSION}`, rather than as `${params.VERSION}`
+func (m *Model) referencesShellVariable(name string) bool {
+	return m.referencesMatch(regexp.MustCompile(`\$\{?` + regexp.QuoteMeta(name) + `\b`))
+}
+
+// referencesMatch checks if the text of any step or environment variable of the pipeline matches the expression
+func (m *Model) referencesMatch(variableRegexp *regexp.Regexp) bool {
+	var steps []*ModelStep
+	for _, p := range m.getPost() {
+		steps = append(steps, p.Steps...)
+	}
+	envs := m.getEnvironment()
+	for _, stage := range m.getStages() {
+		for _, s := range stage.toParallelJobs() {
+			steps = append(steps, s.getSteps()...)
+			for _, p := range s.getPost() {
+				steps = append(steps, p.Steps...)
+			}
+			envs = append(envs, s.getEnvironment()...)
+		}
+	}
+	for _, s := range steps {
+		if variableRegexp.MatchString(s.toOriginalGroovy()) {
+			return true
+		}
+	}
+	for _, e := range envs {
+		if e.Value != nil && variableRegexp.MatchString(e.Value.ToString()) {
+			return true
+		}
+	}
+	return false
+}
+
+// toCredentialEnv sets an environment variable from a credentials() value the way Jenkins does, from GitHub secrets
+// named after the credential. A username and password credential sets the variable to username:password, and also
+// sets <variable>_USR and <variable>_PSW to each. Which kind the credential is can't be told from the Jenkinsfile, so
+// it is taken to be a username and password if the pipeline refers to either of these, and a secret text otherwise.
+func (m *ModelEnvironmentEntry) toCredentialEnv(model *Model) ([]string, []map[string]string) {
+	credentialID := *m.Value.Credential
+	secret := toSecretName(credentialID)
+	if model.referencesVariable(m.Key+"_USR") || model.referencesVariable(m.Key+"_PSW") {
+		username := fmt.Sprintf("${{ secrets.%s_USR }}", secret)
+		password := fmt.Sprintf("${{ secrets.%s_PSW }}", secret)
+		return []string{
+			fmt.Sprintf("# The variable '%s' is set from the username and password credential '%s'. Add its parts as the secrets %s_USR and %s_PSW.", m.Key, credentialID, secret, secret),
+		}, []map[string]string{
+			{m.Key: username + ":" + password},
+			{m.Key + "_USR": username},
+			{m.Key + "_PSW": password},
+		}
+	}
+	return []string{
+		fmt.Sprintf("# The variable '%s' is set from the credential '%s'. Add it as the secret %s.", m.Key, credentialID, secret),
+		fmt.Sprintf("# If it is a username and password, Jenkins also sets %s_USR and %s_PSW. Set them from the secrets %s_USR and %s_PSW then.", m.Key, m.Key, secret, secret),
+	}, []map[string]string{
+		{m.Key: fmt.Sprintf("${{ secrets.%s }}", secret)},
+	}
+}
@@ -0,0 +1,243 @@
+package grammar
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	// Steps that set up credentials of a service for the steps they wrap
+	credentialWrappers = []string{
+		"withAWS",
+		"withDockerRegistry",
+		"withSonarQubeEnv",
+	}
+	// Arguments of withAWS that map to inputs of the configure-aws-credentials action
+	withAWSMappedArgs = []string{
+		"credentials",
+		"region",
+		"role",
+		"roleAccount",
+		"roleSessionName",
+		"duration",
+		"externalId",
+	}
+	// Arguments of withDockerRegistry that map to inputs of the login action
+	withDockerRegistryMappedArgs = []string{
+		"credentialsId",
+		"url",
+	}
+	// Arguments of withSonarQubeEnv that map to the secrets the variables are set from
+	withSonarQubeEnvMappedArgs = []string{
+		"installationName",
+		"credentialsId",
+	}
+	// The hosts of Docker Hub, which the login action logs into unless given another registry
+	dockerHubHosts = []string{
+		"docker.io",
+		"index.docker.io",
+		"registry.hub.docker.com",
+		"registry-1.docker.io",
+	}
+)
+
+func isCredentialWrapper(step *ModelStep) bool {
+	return containsString(credentialWrappers, step.Name)
+}
+
+// getWrapperValue returns the value of a named argument of a wrapper, given either on its own or in a map like the
+// `[credentialsId: 'hub', url: 'https://registry.example.com']` of withDockerRegistry
+func (m *ModelStep) getWrapperValue(key string) *Value {
+	for _, a := range m.Args {
+		if a.Named != nil && a.Named.Key == key {
+			return a.Named.Value
+		}
+		if a.Unnamed == nil {
+			continue
+		}
+		for _, i := range a.Unnamed.List {
+			if i.Arg != nil && i.Arg.Named != nil && i.Arg.Named.Key == key {
+				return i.Arg.Named.Value
+			}
+		}
+	}
+	return nil
+}
+
+// getWrapperArg returns the text of a named argument of a wrapper, if it is a string, a number or a boolean
+func (m *ModelStep) getWrapperArg(key string) string {
+	v := m.getWrapperValue(key)
+	switch {
+	case v == nil:
+		return ""
+	case v.String != nil:
+		return unescapeArg(*v.String)
+	case v.Int != nil, v.Number != nil, v.Bool != nil:
+		return v.ToString()
+	}
+	return ""
+}
+
+// commentsForUnmappedWrapperArgs notes the named arguments of a wrapper that the step replacing it has no equivalent
+// for, including those given in a map
+func commentsForUnmappedWrapperArgs(step *ModelStep, mappedArgs []string, replacement string, indent int) []string {
+	var keys []string
+	for _, a := range step.Args {
+		if a.Named != nil {
+			keys = append(keys, a.Named.Key)
+		} else if a.Unnamed != nil {
+			for _, i := range a.Unnamed.List {
+				if i.Arg != nil && i.Arg.Named != nil {
+					keys = append(keys, i.Arg.Named.Key)
+				}
+			}
+		}
+	}
+	var lines []string
+	for _, k := range keys {
+		if !isSupportedField(k, mappedArgs, false) {
+			lines = append(lines, indentLine(fmt.Sprintf("# The argument '%s' of the Jenkins Pipeline step %s has no equivalent in %s and is not converted.", k, step.Name, replacement), indent+2))
+		}
+	}
+	return lines
+}
+
+// linesForCredentialWrapper emits the step setting up the credentials of a credential wrapper. The wrapped steps are
+// converted separately. Unlike in Jenkins, the credentials stay set up for the rest of the job.
+func linesForCredentialWrapper(step *ModelStep, indent int, settings conversionSettings) []string {
+	switch step.Name {
+	case "withAWS":
+		return linesForWithAWS(step, indent, settings)
+	case "withDockerRegistry":
+		return linesForWithDockerRegistry(step, indent, settings)
+	default:
+		return linesForWithSonarQubeEnv(step, indent, settings)
+	}
+}
+
+// linesForWithAWS converts withAWS into the configure-aws-credentials action. Credentials are read from secrets named
+// after the Jenkins credential, and a role without credentials is assumed with OpenID Connect.
+func linesForWithAWS(step *ModelStep, indent int, settings conversionSettings) []string {
+	var stepLines []string
+	var withLines []string
+	stepLines = append(stepLines, indentLine("# The AWS credentials of withAWS stay set up for the rest of the job, not only for the steps it wraps.", indent+2))
+	stepLines = append(stepLines, commentsForUnmappedWrapperArgs(step, withAWSMappedArgs, "aws-actions/configure-aws-credentials", indent)...)
+
+	credentialID := step.getWrapperArg("credentials")
+	role := step.getWrapperArg("role")
+	secret := "AWS"
+	if credentialID != "" {
+		secret = toSecretName(credentialID)
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("# Add the access key of the AWS credential '%s' as the secrets %s_ACCESS_KEY_ID and %s_SECRET_ACCESS_KEY.", credentialID, secret, secret), indent+2))
+	} else if role == "" {
+		stepLines = append(stepLines, indentLine("# withAWS uses the credentials of the Jenkins agent, which GitHub runners don't have. Add an access key as the secrets AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.", indent+2))
+	}
+	if credentialID != "" || role == "" {
+		withLines = append(withLines, indentLine(fmt.Sprintf("aws-access-key-id: ${{ secrets.%s_ACCESS_KEY_ID }}", secret), indent+3))
+		withLines = append(withLines, indentLine(fmt.Sprintf("aws-secret-access-key: ${{ secrets.%s_SECRET_ACCESS_KEY }}", secret), indent+3))
+	}
+
+	if region := step.getWrapperArg("region"); region != "" {
+		withLines = append(withLines, indentLine(fmt.Sprintf("aws-region: %s", yamlQuote(toActionInput(region))), indent+3))
+	} else {
+		stepLines = append(stepLines, indentLine("# withAWS has no region, which the action needs. Set the AWS_REGION variable of the repository to the region to use.", indent+2))
+		withLines = append(withLines, indentLine("aws-region: ${{ vars.AWS_REGION }}", indent+3))
+	}
+
+	if role != "" {
+		if credentialID == "" {
+			stepLines = append(stepLines, indentLine("# The role is assumed with OpenID Connect, which needs the id-token: write permission and GitHub as an identity provider in AWS.", indent+2))
+		}
+		if !strings.HasPrefix(role, "arn:") {
+			account := step.getWrapperArg("roleAccount")
+			if account == "" {
+				stepLines = append(stepLines, indentLine("# withAWS has no roleAccount, so the role is looked up in the account the AWS_ACCOUNT_ID variable of the repository is set to.", indent+2))
+				account = "${{ vars.AWS_ACCOUNT_ID }}"
+			}
+			role = fmt.Sprintf("arn:aws:iam::%s:role/%s", account, role)
+		}
+		withLines = append(withLines, indentLine(fmt.Sprintf("role-to-assume: %s", yamlQuote(toActionInput(role))), indent+3))
+		if name := step.getWrapperArg("roleSessionName"); name != "" {
+			withLines = append(withLines, indentLine(fmt.Sprintf("role-session-name: %s", yamlQuote(toActionInput(name))), indent+3))
+		}
+		if duration := step.getWrapperArg("duration"); duration != "" {
+			withLines = append(withLines, indentLine(fmt.Sprintf("role-duration-seconds: %s", duration), indent+3))
+		}
+		if externalID := step.getWrapperArg("externalId"); externalID != "" {
+			withLines = append(withLines, indentLine(fmt.Sprintf("role-external-id: %s", yamlQuote(toActionInput(externalID))), indent+3))
+		}
+	}
+
+	stepLines = append(stepLines, indentLine("uses: "+settings.action("aws-actions/configure-aws-credentials"), indent+2))
+	stepLines = append(stepLines, indentLine("with:", indent+2))
+	return append(stepLines, withLines...)
+}
+
+// registryHost returns the host of a registry URL like https://registry.example.com, or nothing for Docker Hub, which
+// the login action logs into by default
+func registryHost(registryURL string) string {
+	host := registryURL
+	if u, err := url.Parse(registryURL); err == nil && u.Host != "" {
+		host = u.Host
+	} else {
+		host = strings.SplitN(host, "/", 2)[0]
+	}
+	if containsString(dockerHubHosts, host) {
+		return ""
+	}
+	return host
+}
+
+// linesForWithDockerRegistry converts withDockerRegistry into the login action, with the username and password of
+// the credential read from secrets named after it
+func linesForWithDockerRegistry(step *ModelStep, indent int, settings conversionSettings) []string {
+	var stepLines []string
+	stepLines = append(stepLines, commentsForUnmappedWrapperArgs(step, withDockerRegistryMappedArgs, "docker/login-action", indent)...)
+	credentialID := step.getWrapperArg("credentialsId")
+	if credentialID == "" {
+		return append(stepLines, indentLine("# The step withDockerRegistry is left out, since it has no credentialsId to log into the registry with.", indent+2))
+	}
+	secret := toSecretName(credentialID)
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("# The registry login of withDockerRegistry stays for the rest of the job. Add the username and password of the credential '%s'", credentialID), indent+2))
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("# as the secrets %s_USR and %s_PSW.", secret, secret), indent+2))
+	stepLines = append(stepLines, indentLine("uses: "+settings.action("docker/login-action"), indent+2))
+	stepLines = append(stepLines, indentLine("with:", indent+2))
+	if registry := registryHost(step.getWrapperArg("url")); registry != "" {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("registry: %s", yamlQuote(toActionInput(registry))), indent+3))
+	}
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("username: ${{ secrets.%s_USR }}", secret), indent+3))
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("password: ${{ secrets.%s_PSW }}", secret), indent+3))
+	return stepLines
+}
+
+// linesForWithSonarQubeEnv replaces withSonarQubeEnv, which has no action to convert into, with a step setting the
+// variables it sets from secrets. They are written to $GITHUB_ENV, so that the wrapped steps have them.
+func linesForWithSonarQubeEnv(step *ModelStep, indent int, settings conversionSettings) []string {
+	installation := step.getWrapperArg("installationName")
+	if installation == "" && len(step.Args) == 1 && step.Args[0].Unnamed != nil && step.Args[0].Unnamed.String != nil {
+		installation = unescapeArg(*step.Args[0].Unnamed.String)
+	}
+	tokenSecret := "SONAR_TOKEN"
+	if credentialID := step.getWrapperArg("credentialsId"); credentialID != "" {
+		tokenSecret = toSecretName(credentialID)
+	}
+
+	var stepLines []string
+	if installation != "" {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("# withSonarQubeEnv sets the server of the SonarQube installation '%s' for the steps it wraps.", installation), indent+2))
+	} else {
+		stepLines = append(stepLines, indentLine("# withSonarQubeEnv sets the server of the SonarQube installation for the steps it wraps.", indent+2))
+	}
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("# There's no action for it, so the variables are set from the secrets SONAR_HOST_URL and %s for the rest of the job instead.", tokenSecret), indent+2))
+	stepLines = append(stepLines, commentsForUnmappedWrapperArgs(step, withSonarQubeEnvMappedArgs, "the variables set", indent)...)
+	stepLines = append(stepLines, indentLine("env:", indent+2))
+	stepLines = append(stepLines, indentLine("SONAR_HOST_URL: ${{ secrets.SONAR_HOST_URL }}", indent+3))
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("SONAR_AUTH_TOKEN: ${{ secrets.%s }}", tokenSecret), indent+3))
+	stepLines = append(stepLines, indentLine("run: |", indent+2))
+	stepLines = append(stepLines, indentLine(`echo "SONAR_HOST_URL=$SONAR_HOST_URL" >> "$GITHUB_ENV"`, indent+3))
+	stepLines = append(stepLines, indentLine(`echo "SONAR_AUTH_TOKEN=$SONAR_AUTH_TOKEN" >> "$GITHUB_ENV"`, indent+3))
+	// Newer scanners read the token from SONAR_TOKEN
+	stepLines = append(stepLines, indentLine(`echo "SONAR_TOKEN=$SONAR_AUTH_TOKEN" >> "$GITHUB_ENV"`, indent+3))
+	return stepLines
+}
@@ -0,0 +1,108 @@
+package grammar
+
+import (
+	"sort"
+)
+
+// stepsNamed returns the steps of the stage and its post conditions with the given name, including nested steps
+func (m *ModelStage) stepsNamed(name string) []*ModelStep {
+	steps := m.getSteps()
+	for _, p := range m.getPost() {
+		steps = append(steps, p.Steps...)
+	}
+	var named []*ModelStep
+	for _, step := range steps {
+		for _, s := range step.nestedStepsWithDirAndImage("", "") {
+			if s.step.Name == name {
+				named = append(named, s.step)
+			}
+		}
+	}
+	return named
+}
+
+// jobDependencies keeps track of the jobs of earlier stages that stash each stash, write each path of the workspace and
+// set each environment variable in a script block, so that a stage's job only needs the jobs it takes files or values
+// from
+type jobDependencies struct {
+	// The jobs of each stage, by stage name
+	jobs map[string][]string
+	// The jobs that stash each stash, by name
+	stashedBy map[string][]string
+	// The job that last set each environment variable in a script block, by name
+	setBy map[string]string
+}
+
+func newJobDependencies() jobDependencies {
+	return jobDependencies{
+		jobs:      make(map[string][]string),
+		stashedBy: make(map[string][]string),
+		setBy:     make(map[string]string),
+	}
+}
+
+// add records the job of a stage, the stashes it stashes and the environment variables it sets in script blocks
+func (j jobDependencies) add(stage *ModelStage, jobID string) {
+	j.jobs[stage.Name] = append(j.jobs[stage.Name], jobID)
+	for _, s := range stage.stepsNamed("stash") {
+		if name := s.getStashName(); name != "" {
+			j.stashedBy[name] = appendIfMissing(j.stashedBy[name], jobID)
+		}
+	}
+	for name := range stage.scriptOutputs() {
+		j.setBy[name] = jobID
+	}
+}
+
+// outputsUsedBy returns the environment variables earlier stages set in script blocks that the stage uses, with the
+// jobs it takes them from
+func (j jobDependencies) outputsUsedBy(stage *ModelStage) []jobOutput {
+	var outputs []jobOutput
+	for name, jobID := range j.setBy {
+		if stage.usesVariable(name) {
+			outputs = append(outputs, jobOutput{Name: name, JobID: jobID})
+		}
+	}
+	sort.Slice(outputs, func(a, b int) bool {
+		return outputs[a].Name < outputs[b].Name
+	})
+	return outputs
+}
+
+// neededBy returns the jobs of earlier stages whose stashes the stage unstashes, whose files it reads from the
+// workspace, or whose environment variables it uses
+func (j jobDependencies) neededBy(stage *ModelStage, writes workspaceWrites) []string {
+	var needs []string
+	for _, s := range stage.stepsNamed("unstash") {
+		for _, jobID := range j.stashedBy[s.getStashName()] {
+			needs = appendIfMissing(needs, jobID)
+		}
+	}
+	for _, p := range writes.readBy(stage) {
+		for _, jobID := range j.jobs[writes[p]] {
+			needs = appendIfMissing(needs, jobID)
+		}
+	}
+	for _, o := range j.outputsUsedBy(stage) {
+		needs = appendIfMissing(needs, o.JobID)
+	}
+	sort.Strings(needs)
+	return needs
+}
+
+// stageNeeds returns the jobs the job of a stage needs. Unless stages run in parallel, it needs the jobs of every
+// earlier stage, like Jenkins runs them one after another. Otherwise it only needs the jobs it takes files from, and
+// a stage waiting for input still needs every earlier job, since it is there to hold up what comes after it.
+func (j jobDependencies) stageNeeds(stage *ModelStage, writes workspaceWrites, earlierJobs []string, settings conversionSettings) ([]string, []string) {
+	if !settings.ParallelStages || stage.getInput() != nil || len(earlierJobs) == 0 {
+		return earlierJobs, nil
+	}
+	needs := j.neededBy(stage, writes)
+	if len(needs) == len(earlierJobs) {
+		return needs, nil
+	}
+	if len(needs) == 0 {
+		return nil, []string{"# The stage runs alongside the earlier stages, since it doesn't use what they stash or write."}
+	}
+	return needs, []string{"# The stage only waits for the jobs whose stashes or files it uses, instead of every earlier stage."}
+}
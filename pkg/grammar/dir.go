@@ -0,0 +1,38 @@
+package grammar
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// joinDir returns the folder a dir step changes to, relative to the workspace unless it is absolute. Like in Jenkins,
+// a nested dir step is relative to the folder of the enclosing one.
+func joinDir(baseDir string, dir string) string {
+	if path.IsAbs(dir) {
+		return path.Clean(dir)
+	}
+	joined := path.Join(baseDir, dir)
+	if joined == "." {
+		return ""
+	}
+	return joined
+}
+
+// workingDirectory returns the working-directory of a run step in the folder of a dir step. Variables in it are read
+// from the env context, since it isn't expanded by a shell.
+func workingDirectory(dir string) string {
+	if !path.IsAbs(dir) && !strings.HasPrefix(dir, "../") {
+		dir = "./" + dir
+	}
+	return toActionInput(dir)
+}
+
+// commentsForDirWithoutSteps explains that a dir step without nested steps changes nothing. Unlike cd in a shell,
+// the folder only applies to the steps nested in the dir step, not to the steps after it.
+func commentsForDirWithoutSteps(step *ModelStep, indent int) []string {
+	return []string{
+		indentLine(fmt.Sprintf("# The dir step '%s' has no nested steps, so it is left out. Jenkins runs only the steps nested in a dir step in its folder,", step.getArg()), indent+2),
+		indentLine("# not the steps after it. Nest the steps meant to run in the folder, or set working-directory on them.", indent+2),
+	}
+}
@@ -0,0 +1,137 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Separates the commands of a shell script
+	shellCommandSeparatorRegexp = regexp.MustCompile(`\s*(?:&&|;|\n)\s*`)
+	// Matches shell variables, like `$VERSION` or `${VERSION}`
+	shellVariableRegexp = regexp.MustCompile(`\$\{?(\w+)\}?`)
+)
+
+// dockerBuild is an image built, and optionally pushed, by docker commands in a sh step
+type dockerBuild struct {
+	Context   string
+	File      string
+	Tags      []string
+	BuildArgs []string
+	Push      bool
+}
+
+// dockerBuildFromScript recognizes a script that only builds an image with `docker build`, and optionally pushes
+// its tags with `docker push`. Scripts with any other command, or flags that have no build-push-action input, aren't
+// recognized, since running them as they are is always safe.
+func dockerBuildFromScript(script string) (dockerBuild, bool) {
+	var build dockerBuild
+	hasBuild := false
+	for _, command := range shellCommandSeparatorRegexp.Split(strings.TrimSpace(script), -1) {
+		fields := strings.Fields(command)
+		switch {
+		case len(fields) == 0:
+			continue
+		case strings.Contains(command, "$(") || strings.Contains(command, "`"):
+			// Command substitutions can't be evaluated in action inputs
+			return dockerBuild{}, false
+		case len(fields) > 2 && fields[0] == "docker" && fields[1] == "build" && !hasBuild:
+			hasBuild = true
+			args := fields[2:]
+			for i := 0; i < len(args); i++ {
+				flag := args[i]
+				if !strings.HasPrefix(flag, "-") {
+					if build.Context != "" {
+						return dockerBuild{}, false
+					}
+					build.Context = flag
+					continue
+				}
+				if i+1 == len(args) {
+					return dockerBuild{}, false
+				}
+				i++
+				switch flag {
+				case "-t", "--tag":
+					build.Tags = append(build.Tags, args[i])
+				case "-f", "--file":
+					build.File = args[i]
+				case "--build-arg":
+					build.BuildArgs = append(build.BuildArgs, args[i])
+				default:
+					return dockerBuild{}, false
+				}
+			}
+		case len(fields) == 3 && fields[0] == "docker" && fields[1] == "push" && hasBuild:
+			if !isSupportedField(fields[2], build.Tags, false) {
+				return dockerBuild{}, false
+			}
+			build.Push = true
+		default:
+			return dockerBuild{}, false
+		}
+	}
+	return build, hasBuild && build.Context != "" && len(build.Tags) > 0
+}
+
+// registry returns the registry the image is pushed to, if it isn't Docker Hub
+func (b dockerBuild) registry() string {
+	parts := strings.SplitN(b.Tags[0], "/", 2)
+	if len(parts) == 2 && strings.ContainsAny(parts[0], ".:") {
+		return parts[0]
+	}
+	return ""
+}
+
+// toActionInput turns shell variables into the env context, since action inputs aren't expanded by a shell. Groovy
+// interpolations of env and params, like `${env.VERSION}`, are read from the env and inputs contexts as well.
+func toActionInput(value string) string {
+	value = paramsInterpolationRegexp.ReplaceAllString(value, "$${{ inputs.$1$2 }}")
+	value = envInterpolationRegexp.ReplaceAllString(value, "$${$1$2}")
+	return shellVariableRegexp.ReplaceAllString(value, "${{ env.$1 }}")
+}
+
+// linesForDockerBuild emits docker/build-push-action for the docker commands of a sh step, preceded by
+// docker/login-action if the image is pushed. Each step is returned on its own.
+func linesForDockerBuild(build dockerBuild, indent int, settings conversionSettings) []string {
+	var steps []string
+	if build.Push {
+		var loginLines []string
+		loginLines = append(loginLines, indentLine("# The docker push is converted into docker/build-push-action, which needs to log into the registry first.", indent+2))
+		loginLines = append(loginLines, indentLine("# Please set the DOCKER_USERNAME and DOCKER_PASSWORD secrets of the repository to the registry credentials.", indent+2))
+		loginLines = append(loginLines, indentLine("uses: "+settings.action("docker/login-action"), indent+2))
+		loginLines = append(loginLines, indentLine("with:", indent+2))
+		if registry := build.registry(); registry != "" {
+			loginLines = append(loginLines, indentLine(fmt.Sprintf("registry: %s", registry), indent+3))
+		}
+		loginLines = append(loginLines, indentLine("username: ${{ secrets.DOCKER_USERNAME }}", indent+3))
+		loginLines = append(loginLines, indentLine("password: ${{ secrets.DOCKER_PASSWORD }}", indent+3))
+		steps = append(steps, strings.Join(loginLines, "\n"))
+	}
+
+	var buildLines []string
+	buildLines = append(buildLines, indentLine("# The docker commands are converted into docker/build-push-action. Shell variables in its inputs are read from env.", indent+2))
+	buildLines = append(buildLines, indentLine("uses: "+settings.action("docker/build-push-action"), indent+2))
+	buildLines = append(buildLines, indentLine("with:", indent+2))
+	buildLines = append(buildLines, indentLine(fmt.Sprintf("context: %s", toYamlScalar(toActionInput(build.Context))), indent+3))
+	if build.File != "" {
+		buildLines = append(buildLines, indentLine(fmt.Sprintf("file: %s", toYamlScalar(toActionInput(build.File))), indent+3))
+	}
+	buildLines = append(buildLines, indentLine("tags: |", indent+3))
+	for _, t := range build.Tags {
+		buildLines = append(buildLines, indentLine(toActionInput(t), indent+4))
+	}
+	if len(build.BuildArgs) > 0 {
+		buildLines = append(buildLines, indentLine("build-args: |", indent+3))
+		for _, a := range build.BuildArgs {
+			buildLines = append(buildLines, indentLine(toActionInput(a), indent+4))
+		}
+	}
+	buildLines = append(buildLines, indentLine(fmt.Sprintf("push: %t", build.Push), indent+3))
+	if !build.Push {
+		// Images that aren't pushed are loaded into the local images, for the steps that use them
+		buildLines = append(buildLines, indentLine("load: true", indent+3))
+	}
+	return append(steps, strings.Join(buildLines, "\n"))
+}
@@ -0,0 +1,138 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Options of a docker agent that the job's container has an equivalent for, or that need no equivalent
+var mappedDockerAgentOptions = []string{
+	"image",
+	"args",
+	"label",
+	"registryUrl",
+	"registryCredentialsId",
+	"reuseNode",
+	"alwaysPull",
+}
+
+// ModelDockerAgent represents a docker agent, given either as just its image, like `docker 'maven:3'`, or as a block
+// of options, like `docker { image 'maven:3'; args '-v /tmp:/tmp' }`
+type ModelDockerAgent struct {
+	Image   string                    `parser:"  @(String|Char|RawString)" json:"image,omitempty"`
+	Options []*ModelDockerAgentOption `parser:"| \"{\" { @@ } \"}\"" json:"options,omitempty"`
+}
+
+// ModelDockerAgentOption represents an option of a docker agent, like `image 'maven:3'` or `reuseNode true`
+type ModelDockerAgentOption struct {
+	Key   string `parser:"@Ident" json:"key,omitempty"`
+	Value *Value `parser:"@@" json:"value,omitempty"`
+}
+
+// ToString converts the model to a rough string form
+func (m *ModelDockerAgent) ToString() string {
+	if m.Image != "" {
+		return fmt.Sprintf("docker %s", m.Image)
+	}
+	var options []string
+	for _, o := range m.Options {
+		options = append(options, fmt.Sprintf("%s %s", o.Key, o.Value.ToString()))
+	}
+	return fmt.Sprintf("docker { %s }", strings.Join(options, "; "))
+}
+
+// getOption returns the value of an option of the docker agent
+func (m *ModelDockerAgent) getOption(key string) *Value {
+	for _, o := range m.Options {
+		if o.Key == key {
+			return o.Value
+		}
+	}
+	return nil
+}
+
+// getString returns an option of the docker agent given as a string
+func (m *ModelDockerAgent) getString(key string) string {
+	if key == "image" && m.Image != "" {
+		return unescapeArg(m.Image)
+	}
+	if v := m.getOption(key); v != nil && v.String != nil {
+		return strings.TrimSpace(unescapeArg(*v.String))
+	}
+	return ""
+}
+
+// isSet checks if a flag of the docker agent, like reuseNode, is true
+func (m *ModelDockerAgent) isSet(key string) bool {
+	v := m.getOption(key)
+	return v != nil && v.Bool != nil && bool(*v.Bool)
+}
+
+// getImage returns the image of the docker agent, prefixed with the host of its registry unless that's Docker Hub
+func (m *ModelDockerAgent) getImage() string {
+	image := m.getString("image")
+	if image == "" {
+		return ""
+	}
+	if registry := registryHost(m.getString("registryUrl")); registry != "" && !strings.HasPrefix(image, registry+"/") {
+		image = registry + "/" + image
+	}
+	return image
+}
+
+// getDockerAgent returns the docker agent the stage runs on, which is the stage's own agent if it has one, or else the
+// pipeline's
+func (m *ModelStage) getDockerAgent(pipelineAgent *ModelAgent) *ModelDockerAgent {
+	if agent := m.getAgent(); agent != nil {
+		return agent.Docker
+	}
+	if pipelineAgent == nil {
+		return nil
+	}
+	return pipelineAgent.Docker
+}
+
+// linesForDockerAgent runs the job in the container of the docker agent. The options the job's container has no
+// equivalent for are noted, and those that only matter on Jenkins, like reuseNode, are left out with a comment.
+func linesForDockerAgent(agent *ModelDockerAgent, runsOn string, indent int, settings conversionSettings) ([]string, bool) {
+	var lines []string
+	image := agent.getImage()
+	if image == "" {
+		settings.addIssue("the docker agent, which has no image")
+		lines = append(lines, indentLine("# WARNING: The docker agent has no image, so the job doesn't run in a container. Please add it from the original Jenkinsfile.", indent))
+		return lines, true
+	}
+	issues := false
+	if isWindowsRunner(runsOn) {
+		settings.addIssue("the docker agent on the runner '%s', which can't run jobs in containers", runsOn)
+		lines = append(lines, indentLine(fmt.Sprintf("# WARNING: Only Linux runners can run jobs in containers, so the job can't run in the image '%s' of the docker agent on '%s'.", image, runsOn), indent))
+		return lines, true
+	}
+	for _, o := range agent.Options {
+		if !containsString(mappedDockerAgentOptions, o.Key) {
+			settings.addIssue("the option %s of the docker agent", o.Key)
+			lines = append(lines, indentLine(fmt.Sprintf("# The option %s of the docker agent can't be converted and is left out. Please check it in the original Jenkinsfile.", o.Key), indent))
+			issues = true
+		}
+	}
+	if agent.getOption("reuseNode") != nil {
+		lines = append(lines, indentLine("# The option reuseNode of the docker agent is left out, since the container always runs on the job's runner, in its workspace.", indent))
+	}
+	if agent.isSet("alwaysPull") {
+		lines = append(lines, indentLine("# The option alwaysPull of the docker agent is left out, since the runner pulls the image of the container for every job.", indent))
+	}
+	lines = append(lines, indentLine("# The job runs in the container of the Jenkins docker agent.", indent))
+	lines = append(lines, indentLine("container:", indent))
+	lines = append(lines, indentLine(fmt.Sprintf("image: %s", toYamlScalar(image)), indent+1))
+	if args := agent.getString("args"); args != "" {
+		lines = append(lines, indentLine(fmt.Sprintf("options: %s", toYamlScalar(args)), indent+1))
+	}
+	if credentialID := agent.getString("registryCredentialsId"); credentialID != "" {
+		secret := toSecretName(credentialID)
+		lines = append(lines, indentLine(fmt.Sprintf("# Add the username and password of the registry credential '%s' as the secrets %s_USR and %s_PSW.", credentialID, secret, secret), indent+1))
+		lines = append(lines, indentLine("credentials:", indent+1))
+		lines = append(lines, indentLine(fmt.Sprintf("username: ${{ secrets.%s_USR }}", secret), indent+2))
+		lines = append(lines, indentLine(fmt.Sprintf("password: ${{ secrets.%s_PSW }}", secret), indent+2))
+	}
+	return lines, issues
+}
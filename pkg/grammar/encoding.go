@@ -0,0 +1,73 @@
+package grammar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotText is returned for a Jenkinsfile that can't be decoded as text, like a binary file
+var ErrNotText = errors.New("The Jenkinsfile isn't text in UTF-8, UTF-16 or Windows-1252, so it can't be read.")
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// The characters of the bytes 0x80 to 0x9F in Windows-1252, which Latin-1 leaves to control characters. The bytes
+// Windows-1252 doesn't use are kept as those control characters.
+var windows1252Runes = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+// decodeJenkinsfile returns the text of a Jenkinsfile as UTF-8, without a byte order mark. Files with a UTF-16 byte
+// order mark are decoded from UTF-16, and files that aren't valid UTF-8, like those saved by older Windows editors,
+// from Windows-1252.
+func decodeJenkinsfile(jf string) (string, error) {
+	data := []byte(jf)
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		data = data[len(utf8BOM):]
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return decodeUTF16(data[len(utf16LEBOM):], binary.LittleEndian)
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return decodeUTF16(data[len(utf16BEBOM):], binary.BigEndian)
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", ErrNotText
+	}
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+	var decoded strings.Builder
+	for _, b := range data {
+		if b >= 0x80 && b <= 0x9F {
+			decoded.WriteRune(windows1252Runes[b-0x80])
+		} else {
+			decoded.WriteRune(rune(b))
+		}
+	}
+	return decoded.String(), nil
+}
+
+// decodeUTF16 decodes UTF-16 text with the given byte order
+func decodeUTF16(data []byte, order binary.ByteOrder) (string, error) {
+	if len(data)%2 != 0 {
+		return "", ErrNotText
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	decoded := string(utf16.Decode(units))
+	if strings.ContainsRune(decoded, 0) {
+		return "", ErrNotText
+	}
+	return decoded, nil
+}
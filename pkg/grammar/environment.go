@@ -0,0 +1,87 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ModelEnvironmentCommand represents an environment variable set from the output of a shell command, such as
+// `sh(script: 'git rev-parse HEAD', returnStdout: true).trim()`
+type ModelEnvironmentCommand struct {
+	Args    []*ModelStepArg `parser:"\"sh\" \"(\" ( @@ { \",\" @@ } )? \")\"" json:"args,omitempty"`
+	Methods []string        `parser:"{ \".\" @Ident \"(\" \")\" }" json:"methods,omitempty"`
+}
+
+// ToString converts the model to a rough string form
+func (m *ModelEnvironmentCommand) ToString() string {
+	var args []string
+	for _, a := range m.Args {
+		if a.Named != nil {
+			args = append(args, fmt.Sprintf("%s: %s", a.Named.Key, a.Named.Value.ToString()))
+		} else {
+			args = append(args, a.ToString())
+		}
+	}
+	value := fmt.Sprintf("sh(%s)", strings.Join(args, ", "))
+	for _, method := range m.Methods {
+		value += fmt.Sprintf(".%s()", method)
+	}
+	return value
+}
+
+// getScript returns the shell command whose output is the value, and false if the value can't be computed the same
+// way in a run step
+func (m *ModelEnvironmentCommand) getScript() (string, bool) {
+	script := ""
+	returnsStdout := false
+	for _, a := range m.Args {
+		switch {
+		case a.Unnamed != nil && a.Unnamed.String != nil:
+			script = *a.Unnamed.String
+		case a.Named != nil && a.Named.Key == "script" && a.Named.Value.String != nil:
+			script = *a.Named.Value.String
+		case a.Named != nil && a.Named.Key == "returnStdout" && a.Named.Value.Bool != nil:
+			returnsStdout = bool(*a.Named.Value.Bool)
+		case a.Named != nil && a.Named.Key == "label":
+			// Only used for display in Jenkins
+		default:
+			return "", false
+		}
+	}
+	for _, method := range m.Methods {
+		// Command substitution strips trailing newlines, and leading whitespace isn't expected in command output,
+		// so trimming needs nothing else
+		if method != "trim" {
+			return "", false
+		}
+	}
+	if script == "" || !returnsStdout {
+		return "", false
+	}
+	return unescapeArg(removeQuotesAndTrim(script)), true
+}
+
+// linesForComputedEnv emits a step writing the environment variables computed by shell commands to $GITHUB_ENV, so
+// the following steps of the job can use them
+func linesForComputedEnv(entries []*ModelEnvironmentEntry, indent int) []string {
+	var commands []string
+	for _, e := range entries {
+		if e.Value == nil || e.Value.Command == nil {
+			continue
+		}
+		if script, ok := e.Value.Command.getScript(); ok {
+			commands = append(commands, linesForCapturedOutput(e.Key, script, "$GITHUB_ENV")...)
+		}
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+
+	var stepLines []string
+	stepLines = append(stepLines, indentLine("# The Jenkinsfile sets these environment variables from shell commands, so they're computed for the job here.", indent+2))
+	stepLines = append(stepLines, indentLine("run: |", indent+2))
+	for _, c := range commands {
+		stepLines = append(stepLines, indentLine(c, indent+3))
+	}
+	return stepLines
+}
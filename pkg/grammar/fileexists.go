@@ -0,0 +1,76 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The id of the step checking the file the when condition of a stage looks for
+const fileExistsStepID = "file-exists"
+
+// Matches an expression condition that only checks if a file exists, like `return fileExists('pom.xml')` or
+// `!fileExists 'package.json'`
+var fileExistsExpressionRegexp = regexp.MustCompile(`^(?:return\s+)?(!?)\s*fileExists\s*\(?\s*['"]([^'"$]+)['"]\s*\)?\s*;?$`)
+
+// fileExistsCheck is an expression condition checking if a file exists in the workspace
+type fileExistsCheck struct {
+	Path string
+	// Negated is set for conditions checking that the file doesn't exist
+	Negated bool
+	// StepID is the id of the step checking the file, unique among the steps it is checked for
+	StepID string
+}
+
+// getFileExists returns the file checked by a when condition that is only an expression calling fileExists, and false
+// for any other condition
+func (m *ModelWhen) getFileExists() (fileExistsCheck, bool) {
+	if m == nil || len(m.Unsupported) != 1 || m.Unsupported[0].Name != "expression" {
+		return fileExistsCheck{}, false
+	}
+	expression := strings.TrimSpace(unescapeArg(m.Unsupported[0].Value))
+	match := fileExistsExpressionRegexp.FindStringSubmatch(expression)
+	// The path is checked in double quotes, where backticks and backslashes aren't literal
+	if match == nil || strings.ContainsAny(match[2], "`\\") {
+		return fileExistsCheck{}, false
+	}
+	return fileExistsCheck{Path: match[2], Negated: match[1] == "!", StepID: fileExistsStepID}, true
+}
+
+// condition returns the condition the steps of the stage run on, given the output of the step checking the file
+func (c fileExistsCheck) condition() string {
+	value := "true"
+	if c.Negated {
+		value = "false"
+	}
+	return fmt.Sprintf("steps.%s.outputs.exists == '%s'", c.StepID, value)
+}
+
+// withFileExistsCheck guards the steps of a stage, including its post conditions, by a step checking the file its
+// when condition looks for. The file is in the checked out repository, which the job has only once it runs, so the
+// check is a step of the job instead of a condition on it.
+func withFileExistsCheck(steps []string, check fileExistsCheck, indent int, settings conversionSettings) []string {
+	var checkLines []string
+	if check.Negated {
+		checkLines = append(checkLines, indentLine(fmt.Sprintf("# The stage runs only if the file '%s' doesn't exist, which this step checks for the steps after it.", check.Path), indent+2))
+	} else {
+		checkLines = append(checkLines, indentLine(fmt.Sprintf("# The stage runs only if the file '%s' exists, which this step checks for the steps after it.", check.Path), indent+2))
+	}
+	checkLines = append(checkLines, indentLine(fmt.Sprintf("id: %s", check.StepID), indent+2))
+	checkLines = append(checkLines, indentLine("run: |", indent+2))
+	checkLines = append(checkLines, indentLine(fmt.Sprintf(`if [ -e "%s" ]; then`, check.Path), indent+3))
+	checkLines = append(checkLines, indentLine(`  echo "exists=true" >> "$GITHUB_OUTPUT"`, indent+3))
+	checkLines = append(checkLines, indentLine("else", indent+3))
+	checkLines = append(checkLines, indentLine(`  echo "exists=false" >> "$GITHUB_OUTPUT"`, indent+3))
+	checkLines = append(checkLines, indentLine("fi", indent+3))
+
+	guarded := []string{strings.Join(checkLines, "\n")}
+	for _, step := range steps {
+		if isCommentOnly(step) {
+			guarded = append(guarded, step)
+		} else {
+			guarded = append(guarded, withStepCondition(step, check.condition(), indent))
+		}
+	}
+	return guarded
+}
@@ -0,0 +1,154 @@
+package grammar
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "write the converted workflows of the golden files instead of comparing them")
+
+// goldenOptions are the options a golden file is converted with, read from the .json file next to it
+type goldenOptions struct {
+	ConvertOptions
+	// Split converts the Jenkinsfile into a workflow file for each trigger, each compared with NAME.FILE
+	Split bool
+}
+
+// TestGoldenFiles converts each test_data/NAME.groovy Jenkinsfile and compares the workflow with test_data/NAME.yml,
+// or the error with test_data/NAME.err if the conversion fails. Run with -update to write them instead. Each
+// conversion is done twice, and must give the same workflow both times.
+func TestGoldenFiles(t *testing.T) {
+	jenkinsfiles, err := filepath.Glob(filepath.Join("test_data", "*.groovy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jenkinsfiles) == 0 {
+		t.Fatal("no golden files in test_data")
+	}
+	for _, jenkinsfile := range jenkinsfiles {
+		base := strings.TrimSuffix(jenkinsfile, ".groovy")
+		t.Run(filepath.Base(base), func(t *testing.T) {
+			opts := readGoldenOptions(t, base+".json")
+			outputs := convertGolden(t, jenkinsfile, opts)
+			if again := convertGolden(t, jenkinsfile, opts); !equalOutputs(outputs, again) {
+				t.Errorf("converting %s twice gives different results", jenkinsfile)
+			}
+			for _, suffix := range sortedKeys(outputs) {
+				compareGolden(t, base+suffix, outputs[suffix])
+			}
+		})
+	}
+}
+
+// readGoldenOptions reads the options of a golden file, which are the default ones if there is no options file
+func readGoldenOptions(t *testing.T, path string) goldenOptions {
+	var opts goldenOptions
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return opts
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &opts); err != nil {
+		t.Fatalf("reading the options %s: %v", path, err)
+	}
+	return opts
+}
+
+// convertGolden converts a golden Jenkinsfile, returning the text of each expected file by the suffix of its name
+func convertGolden(t *testing.T, jenkinsfile string, opts goldenOptions) map[string]string {
+	data, err := ioutil.ReadFile(jenkinsfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, err := ParseText(string(data))
+	if err != nil {
+		return map[string]string{".err": err.Error() + "\n"}
+	}
+	if opts.Split {
+		files, _, err := model.ToYamlFiles(opts.ConvertOptions)
+		if err != nil {
+			return map[string]string{".err": err.Error() + "\n"}
+		}
+		outputs := make(map[string]string)
+		for name, asYaml := range files {
+			outputs["."+name] = asYaml + "\n"
+		}
+		return outputs
+	}
+	asYaml, _, err := model.ToYamlWithOptions(opts.ConvertOptions)
+	if err != nil {
+		return map[string]string{".err": err.Error() + "\n"}
+	}
+	return map[string]string{".yml": asYaml + "\n"}
+}
+
+// compareGolden compares a converted workflow with the golden file it is expected to match, or writes it to the file
+// with -update
+func compareGolden(t *testing.T, path string, actual string) {
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading the golden file %s, which -update writes: %v", path, err)
+	}
+	if string(expected) != actual {
+		t.Errorf("the conversion doesn't match %s:\n%s", path, lineDiff(string(expected), actual))
+	}
+}
+
+// lineDiff describes the first lines at which the expected and actual texts differ
+func lineDiff(expected string, actual string) string {
+	expectedLines := strings.Split(expected, "\n")
+	actualLines := strings.Split(actual, "\n")
+	var diff []string
+	for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+		e, a := "", ""
+		if i < len(expectedLines) {
+			e = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			a = actualLines[i]
+		}
+		if e != a {
+			diff = append(diff, fmt.Sprintf("line %d:\n- %s\n+ %s", i+1, e, a))
+			if len(diff) == 5 {
+				break
+			}
+		}
+	}
+	return strings.Join(diff, "\n")
+}
+
+func equalOutputs(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
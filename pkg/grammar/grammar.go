@@ -3,8 +3,11 @@ package grammar
 import (
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/alecthomas/participle"
@@ -13,7 +16,6 @@ import (
 )
 
 const (
-	indent                          = "  "
 	newlinePlaceholder              = "^^NEWLINE^^"
 	backtickPlaceholder             = "^^BACKTICK^^"
 	doubleQuotePlaceholder          = "^^DOUBLEQUOTE^^"
@@ -23,6 +25,11 @@ const (
 )
 
 var (
+	// Matches the `checkout scm` step on a line of its own, since `scm` isn't a value the grammar can parse
+	checkoutScmRegexp = regexp.MustCompile(`(?m)^(\s*)checkout\s+scm\s*$`)
+	// Matches plain YAML scalars that are read as something other than a string, like booleans, null and numbers
+	nonStringScalarRegexp = regexp.MustCompile(`(?i)^(true|false|yes|no|null|~|[-+]?(\.inf|\.nan|[0-9][0-9_]*(\.[0-9_]*)?([e][-+]?[0-9]+)?|\.[0-9]+)|0x[0-9a-f]+|0o[0-7]+)$`)
+
 	// Fields that are allowed but not translated in given contexts, resulting in warnings if used.
 	unusedTopLevelFields = []string{
 		"post",
@@ -34,10 +41,9 @@ var (
 	// Fields that are explicitly unsupported in given contexts, resulting in errors if used.
 	unsupportedTopLevelFields = []string{
 		"triggers",
-		"options",
-		"parameters",
 		"tools",
 		"libraries",
+		"properties",
 	}
 	unsupportedStageFields = []string{
 		"stages",
@@ -45,7 +51,6 @@ var (
 		"matrix",
 		"tools",
 		"input",
-		"options",
 	}
 	unsupportedAgentFields = []string{
 		"kubernetes",
@@ -54,12 +59,24 @@ var (
 	// Fields that are explicitly supported in given contexts. Any other fields used in these contexts results in an error.
 	supportedWhenFields = []string{
 		"branch",
+		"anyOf",
+		"not",
 	}
 	supportedSteps = []string{
 		"sh",
 		"dir",
 		"container", // https://www.jenkins.io/doc/pipeline/steps/kubernetes/#-container-run-build-steps-in-a-container
 		"withMaven",
+		"withGradle",
+		"withAWS",
+		"withDockerRegistry",
+		"withSonarQubeEnv",
+		"lock",
+		"timestamps",
+		"ansiColor",
+		"timeout",
+		parallelMapStep,
+		parallelBranchStep,
 	}
 
 	// Environment variables to remove from the Jenkinsfile
@@ -82,9 +99,107 @@ var (
 	}
 )
 
+// conversionSettings holds everything that affects how stages and steps are converted, beyond the stages themselves
+type conversionSettings struct {
+	ConvertOptions
+	// skipDefaultCheckout is set when the pipeline has the skipDefaultCheckout option, so jobs only check out the
+	// repository where the Jenkinsfile does so explicitly
+	skipDefaultCheckout bool
+	// stage is the name of the stage being converted, if any
+	stage string
+	// retries is how many times the retry option of the stage runs its sh steps, if it has one
+	retries int64
+	// podContainers are the containers of the kubernetes agent the stage runs on, if any
+	podContainers []podContainer
+	// pathsFiltered is set when the workflow only runs on changes to the paths the stages' changesets match, so the
+	// stages don't need to check for them
+	pathsFiltered bool
+	// events are the events the workflow runs on, which are up to the calling workflows for a reusable workflow
+	events []string
+	// issues collects the constructs that aren't fully converted
+	issues *[]string
+	// librarySteps collects the names of the steps that are probably steps of a shared library
+	librarySteps *[]string
+	// jobSources collects the constructs of the Jenkinsfile each job is converted from
+	jobSources *[]jobSource
+	// ownRunner is set when the job runs on a runner that isn't GitHub-hosted, which keeps the workspace between jobs
+	ownRunner bool
+	// stepIDs are the ids given to the steps of the job being converted, so that each step's is unique within the job
+	stepIDs jobIDs
+	// secretParameters are the names of the password parameters, which steps read from secrets
+	secretParameters []string
+	// stashes are the folders the stashes of the pipeline are stored relative to, by name
+	stashes map[string]string
+	// stashRetentionDays is how many days stashes are kept for
+	stashRetentionDays int64
+	// summary counts what is converted and what is left out
+	summary *ConversionSummary
+}
+
+// addIssue records a construct that isn't fully converted, along with the stage it is in
+func (s conversionSettings) addIssue(format string, args ...interface{}) {
+	if s.issues == nil {
+		return
+	}
+	context := "pipeline"
+	if s.stage != "" {
+		context = fmt.Sprintf("stage '%s'", s.stage)
+	}
+	*s.issues = append(*s.issues, fmt.Sprintf("%s: %s", context, fmt.Sprintf(format, args...)))
+}
+
+// ConvertOptions controls how the Jenkinsfile model is converted
+type ConvertOptions struct {
+	// RunsOn is the runner label jobs run on when neither the agent label nor the steps call for a specific runner.
+	// Defaults to ubuntu-latest.
+	RunsOn string
+	// Strict makes the conversion fail with an error listing every construct that isn't fully converted, instead of
+	// emitting a best-effort workflow.
+	Strict bool
+	// DockerActions converts sh steps that only build and push an image with docker commands into
+	// docker/build-push-action, instead of running the commands as they are.
+	DockerActions bool
+	// StepIDs gives every step an id derived from its name, unique within its job, so that other steps can refer to
+	// it. Steps whose outputs are used have an id either way.
+	StepIDs bool
+	// SkipEmptyStages leaves out the stages without steps, instead of converting them into jobs that do nothing.
+	SkipEmptyStages bool
+	// ActionVersions overrides the versions of the actions the workflow uses, by action name, like actions/checkout to
+	// v4 or to the SHA of an audited commit.
+	ActionVersions map[string]string
+	// ParallelStages runs the job of a stage as soon as the jobs whose stashes or workspace files it uses are done,
+	// instead of after the jobs of every earlier stage. Stages waiting for input still run after every earlier stage.
+	ParallelStages bool
+	// ReusableWorkflow converts the pipeline into a reusable workflow, which other workflows call with its parameters as
+	// inputs and the secrets it uses, instead of a workflow triggered by pushes and pull requests.
+	ReusableWorkflow bool
+	// StepMappings converts the steps the converter doesn't know, like those of a shared library, as described by
+	// their mapping, keyed by step name. Mapped steps are converted this way instead of being left to fix.
+	StepMappings map[string]StepMapping
+	// SplitCommands converts sh steps that join commands with &&, like `sh 'make && make test'`, into a step for each
+	// command, so that each has its own log. Scripts that also use other operators, or change directory or variables
+	// for the commands after, stay a single step.
+	SplitCommands bool
+	// WorkflowName is the name of the workflow, like the name of the repository or of the Jenkins job. Defaults to CI.
+	// Workflows split by trigger add the trigger to it.
+	WorkflowName string
+	// SetupActions adds the setup action of the build tools the sh steps of a job run before the first of them, like
+	// actions/setup-node for npm, with their dependencies cached.
+	SetupActions bool
+	// CompositeAction converts the pipeline into a composite action instead of a workflow, which runs the steps of the
+	// stages one after the other in the job using it, with the parameters and the secrets it reads as inputs.
+	CompositeAction bool
+	// IndentWidth is the number of spaces each level of the workflow is indented by, between 2 and 8. Defaults to 2.
+	// The scripts of run steps keep their own indentation.
+	IndentWidth int
+}
+
+// defaultWorkflowName is the name of workflows the options don't name
+const defaultWorkflowName = "CI"
+
 // Model is the base for the entire pipeline model
 type Model struct {
-	Pipeline []*ModelPipelineEntry `"pipeline" "{" { @@ } "}"`
+	Pipeline []*ModelPipelineEntry `parser:"\"pipeline\" \"{\" { @@ } \"}\"" json:"pipeline,omitempty"`
 }
 
 func (m *Model) getPost() []*ModelPostEntry {
@@ -96,6 +211,34 @@ func (m *Model) getPost() []*ModelPostEntry {
 	return nil
 }
 
+func (m *Model) getAgent() *ModelAgent {
+	for _, e := range m.Pipeline {
+		if e.Agent != nil {
+			return e.Agent
+		}
+	}
+	return nil
+}
+
+func (m *Model) getOptions() []*ModelOption {
+	for _, e := range m.Pipeline {
+		if len(e.Options) > 0 {
+			return e.Options
+		}
+	}
+	return nil
+}
+
+// hasOption checks if the pipeline sets the given option
+func (m *Model) hasOption(name string) bool {
+	for _, o := range m.getOptions() {
+		if o.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *Model) getEnvironment() []*ModelEnvironmentEntry {
 	for _, e := range m.Pipeline {
 		if len(e.Environment) > 0 {
@@ -115,12 +258,11 @@ func (m *Model) getStages() []*ModelStage {
 }
 
 func (m *Model) getUnsupported() []*UnsupportedModelBlock {
+	var unsupported []*UnsupportedModelBlock
 	for _, e := range m.Pipeline {
-		if len(e.Unsupported) > 0 {
-			return e.Unsupported
-		}
+		unsupported = append(unsupported, e.Unsupported...)
 	}
-	return nil
+	return unsupported
 }
 
 func containsRealEnvLines(lines []string) bool {
@@ -132,19 +274,139 @@ func containsRealEnvLines(lines []string) bool {
 	return false
 }
 
+// toYamlScalar quotes a value if it would otherwise not be read back as the same plain YAML string
+func toYamlScalar(value string) string {
+	if value == "" || strings.TrimSpace(value) != value || strings.ContainsAny(value[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(value, ": ") || strings.Contains(value, " #") || strings.HasSuffix(value, ":") ||
+		strings.Contains(value, "\t#") || nonStringScalarRegexp.MatchString(value) {
+		return yamlQuote(value)
+	}
+	return value
+}
+
+// yamlQuote quotes a value as a single-quoted YAML string
+func yamlQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// isCommentOnly checks if every line of a converted step is a comment, i.e. the step is commented out
+func isCommentOnly(step string) bool {
+	for _, l := range strings.Split(step, "\n") {
+		if strings.TrimSpace(l) != "" && !strings.HasPrefix(strings.TrimSpace(l), "#") {
+			return false
+		}
+	}
+	return true
+}
+
 // ToYaml converts the Jenkinsfile model into jenkins-x.yml
 func (m *Model) ToYaml() (string, bool, error) {
+	return m.ToYamlWithOptions(ConvertOptions{})
+}
+
+// ToYamlWithOptions converts the Jenkinsfile model into jenkins-x.yml, using the given options
+func (m *Model) ToYamlWithOptions(opts ConvertOptions) (string, bool, error) {
+	return m.workflowAsYAML(m.getTriggers(), false, opts)
+}
+
+// WorkflowSections holds the lines of each top level section of a converted workflow
+type WorkflowSections struct {
+	// Header holds the workflow name and the pipeline's environment
+	Header []string
+	// On holds the triggers of the workflow
+	On []string
+	// Jobs holds a job for each converted stage, along with comments on what isn't converted
+	Jobs []string
+	// Summary counts what is converted and what is left out
+	Summary ConversionSummary
+	// jobSources are the constructs of the Jenkinsfile the jobs are converted from
+	jobSources []jobSource
+	// indentWidth is the number of spaces each level of the workflow is indented by
+	indentWidth int
+}
+
+// Lines returns the lines of the whole workflow
+func (w *WorkflowSections) Lines() []string {
 	var lines []string
+	lines = append(lines, w.Header...)
+	lines = append(lines, w.On...)
+	return append(lines, w.Jobs...)
+}
+
+// ToWorkflowSections converts the Jenkinsfile model into the sections of a single workflow, using the given options
+func (m *Model) ToWorkflowSections(opts ConvertOptions) (*WorkflowSections, bool, error) {
+	sections, conversionIssues, err := m.workflowSections(m.getTriggers(), false, opts)
+	if err != nil {
+		return nil, conversionIssues, err
+	}
+	return sections, conversionIssues, nil
+}
+
+// workflowAsYAML converts the stages running on any of the given triggers into a workflow. If split is set, the
+// workflow is one of several, one for each trigger.
+func (m *Model) workflowAsYAML(onTrigger []string, split bool, opts ConvertOptions) (string, bool, error) {
+	sections, conversionIssues, err := m.workflowSections(onTrigger, split, opts)
+	if err != nil {
+		return "", conversionIssues, err
+	}
+	return strings.Join(sections.Lines(), "\n"), conversionIssues, nil
+}
+
+// workflowSections converts the stages running on any of the given triggers into the sections of a workflow, indented
+// by the width of the options
+func (m *Model) workflowSections(onTrigger []string, split bool, opts ConvertOptions) (*WorkflowSections, bool, error) {
+	if err := checkIndentWidth(opts.IndentWidth); err != nil {
+		return nil, false, err
+	}
+	sections, conversionIssues, err := m.buildWorkflowSections(onTrigger, split, opts)
+	if err != nil {
+		return nil, conversionIssues, err
+	}
+	sections.reindent(opts.indentWidth())
+	return sections, conversionIssues, nil
+}
+
+// buildWorkflowSections builds the sections of a workflow with the default indentation width
+func (m *Model) buildWorkflowSections(onTrigger []string, split bool, opts ConvertOptions) (*WorkflowSections, bool, error) {
+	var lines []string
+	sections := &WorkflowSections{}
 	conversionIssues := false
+	var issues []string
+	var librarySteps []string
+	var jobSources []jobSource
+	settings := conversionSettings{
+		ConvertOptions:      opts,
+		skipDefaultCheckout: m.hasOption("skipDefaultCheckout"),
+		issues:              &issues,
+		librarySteps:        &librarySteps,
+		jobSources:          &jobSources,
+		secretParameters:    m.getSecretParameters(),
+		stashes:             m.getStashRoots(),
+		stashRetentionDays:  m.getStashRetentionDays(),
+		summary:             &sections.Summary,
+	}
+	if opts.CompositeAction {
+		return m.compositeActionSections(sections, settings)
+	}
 
 	pipelineIndent := 0
-	lines = append(lines, indentLine("name: github-action.yaml file Created by m2ga", pipelineIndent))
+	workflowName := opts.WorkflowName
+	if workflowName == "" {
+		workflowName = defaultWorkflowName
+	}
+	if split {
+		workflowName = fmt.Sprintf("%s (%s)", workflowName, strings.Join(onTrigger, ", "))
+	}
+	lines = append(lines, indentLine(fmt.Sprintf("name: %s", toYamlScalar(workflowName)), pipelineIndent))
 
 	// env
-	envLines, err := toEnvYamlLines(m.getEnvironment())
+	parameterEnv, parameterComments := m.getParameterEnv()
+	envLines, err := toEnvYamlLines(append(parameterEnv, m.getEnvironment()...), m)
 	if err != nil {
-		return "", conversionIssues, err
+		return nil, conversionIssues, err
 	}
+	envLines = append(parameterComments, envLines...)
+	envLines = append(envLines, m.getGenericTriggerEnv()...)
 	if len(envLines) > 0 {
 		realEnvLines := containsRealEnvLines(envLines)
 		envLineIndent := 0
@@ -158,167 +420,474 @@ func (m *Model) ToYaml() (string, bool, error) {
 			lines = append(lines, indentLine(envLine, envLineIndent))
 		}
 	}
+	lines = append(lines, indentLine("# Jenkins runs sh steps with a POSIX shell, so run steps use bash on every runner.", pipelineIndent))
+	if m.runsOnWindows(opts) {
+		lines = append(lines, indentLine("# Windows runners have bash too, and the steps converted from bat and powershell set their own shell.", pipelineIndent))
+	}
+	lines = append(lines, linesForDefaultShell(pipelineIndent)...)
 	// <br>
 	lines = append(lines, indentLine("", pipelineIndent))
+	sections.Header = lines
 
 	// on
-	lines = append(lines, indentLine("# setting github branch triggers: default-branch.", pipelineIndent))
-	lines = append(lines, indentLine("# for customizing: please check https://docs.github.com/en/actions/using-workflows/workflow-syntax-for-github-actions#on", pipelineIndent))
-	lines = append(lines, indentLine("on:", pipelineIndent))
-	var onTrigger = []string{"push", "pull_request"}
-	for _, trigger := range onTrigger {
-		lines = append(lines, indentLine(fmt.Sprintf("%s:", trigger), pipelineIndent+1))
-		lines = append(lines, indentLine("branches:", pipelineIndent+2))
-		lines = append(lines, indentLine("- master", pipelineIndent+3))
+	lines = nil
+	if !opts.ReusableWorkflow {
+		lines = append(lines, indentLine("# setting github branch triggers: default-branch.", pipelineIndent))
+		lines = append(lines, indentLine("# for customizing: please check https://docs.github.com/en/actions/using-workflows/workflow-syntax-for-github-actions#on", pipelineIndent))
+		if split {
+			lines = append(lines, indentLine(fmt.Sprintf("# This workflow holds the stages that run on %s.", strings.Join(onTrigger, ", ")), pipelineIndent))
+		} else if len(onTrigger) == 1 && onTrigger[0] == "push" {
+			lines = append(lines, indentLine("# Only push triggers the workflow, since stages are guarded by branches but none by a PR-* branch.", pipelineIndent))
+		} else if len(onTrigger) == 1 {
+			lines = append(lines, indentLine("# Only pull_request triggers the workflow, since stages are only guarded by PR-* branches.", pipelineIndent))
+		}
+		paths := m.getWorkflowPaths(onTrigger)
+		if len(paths) > 0 {
+			settings.pathsFiltered = true
+			lines = append(lines, indentLine("# The stages only run when files matching their changeset change, so the workflow is filtered on those paths.", pipelineIndent))
+		}
+		lines = append(lines, indentLine("on:", pipelineIndent))
+		for _, trigger := range onTrigger {
+			branches := []string{defaultBranch}
+			if trigger == "push" {
+				branches = m.getPushBranches()
+			}
+			lines = append(lines, indentLine(fmt.Sprintf("%s:", trigger), pipelineIndent+1))
+			lines = append(lines, indentLine("branches:", pipelineIndent+2))
+			for _, b := range branches {
+				lines = append(lines, indentLine(fmt.Sprintf("- %s", toYamlScalar(b)), pipelineIndent+3))
+			}
+			if len(paths) > 0 {
+				lines = append(lines, linesForWorkflowPaths(paths, pipelineIndent+2)...)
+			}
+		}
+		if triggers, ok := m.getTriggerDirectives(); ok && len(triggers) > 0 && (!split || containsString(onTrigger, "push")) {
+			triggerLines, triggerIssues := linesForTriggers(triggers, pipelineIndent+1, settings)
+			if triggerIssues {
+				conversionIssues = true
+			}
+			lines = append(lines, triggerLines...)
+		}
+		if parameters := m.getParameters(); len(parameters) > 0 {
+			parameterLines, parameterIssues := linesForParameters(parameters, pipelineIndent+1, settings)
+			if parameterIssues {
+				conversionIssues = true
+			}
+			lines = append(lines, parameterLines...)
+		}
+
+		sections.On = lines
+		settings.events = workflowEvents(lines, pipelineIndent+1)
 	}
 
 	// jobs
+	lines = nil
 	lines = append(lines, indentLine("jobs:", pipelineIndent))
-	post := m.getPost()
-	if len(post) > 1 || (len(post) == 1 && !post[0].isDefaultCleanWs()) {
-		conversionIssues = true
-		lines = append(lines, indentLine("# The Jenkinsfile contains a post directive for its pipeline. This is not converted.", pipelineIndent+1))
-		//lines = append(lines, indentLine("# There is no equivalent behavior in Jenkins X pipelines.", pipelineIndent+1))
-	}
 	for _, u := range m.getUnsupported() {
+		if u.Name == "triggers" {
+			if _, ok := m.getTriggerDirectives(); ok {
+				// The triggers are converted along with the events the workflow runs on
+				continue
+			}
+		}
 		conversionIssues = true
+		if u.Name == "properties" {
+			lines = append(lines, linesForProperties(u, pipelineIndent+1, settings)...)
+			continue
+		}
+		settings.addIssue("the %s directive", u.Name)
+		settings.countUnsupportedDirective()
 		lines = append(lines, indentLine(fmt.Sprintf("# The Jenkinsfile contains the %s directive for its pipeline. This is not converted.", u.Name), pipelineIndent+1))
 		//lines = append(lines, indentLine("# There is no equivalent behavior in Jenkins X pipelines.", pipelineIndent+1))
 	}
+	for _, o := range m.getOptions() {
+		optionLines, optionIssues := linesForOption(o, pipelineIndent+1, settings)
+		if optionIssues {
+			conversionIssues = true
+			settings.addIssue("the option %s", o.Name)
+			settings.countUnsupportedDirective()
+		}
+		lines = append(lines, optionLines...)
+	}
 
+	// Stages running on pull requests and on pushes to branches, and the stages running on any of the workflow's
+	// triggers
 	var releaseStages []*ModelStage
 	var prStages []*ModelStage
+	var workflowStages []*ModelStage
 	allStages := m.getStages()
 
 	for _, s := range allStages {
+		stageSettings := settings
+		stageSettings.stage = s.Name
 		when := s.getWhen()
 		if when == nil {
 			releaseStages = append(releaseStages, s)
 			prStages = append(prStages, s)
-		} else if when.Branch == "master" {
+		} else if branches, ok := when.getBranches(); ok {
+			// Branch guarded stages are converted with a condition on the job
+			for _, b := range branches {
+				if isPullRequestBranch(b) {
+					prStages = appendStageIfMissing(prStages, s)
+				} else {
+					releaseStages = appendStageIfMissing(releaseStages, s)
+				}
+			}
+		} else if _, ok := when.getChangesets(); ok {
+			// Changeset guarded stages run on any trigger, filtered on the paths they match
+			releaseStages = append(releaseStages, s)
+			prStages = append(prStages, s)
+		} else if _, ok := when.getNotBranches(); ok {
+			// Stages excluding branches run on any trigger, with a condition on the job
 			releaseStages = append(releaseStages, s)
-		} else if strings.HasPrefix(when.Branch, "PR-") {
 			prStages = append(prStages, s)
-		} else if len(when.Unsupported) > 0 {
-			for _, u := range when.Unsupported {
-				lines = append(lines, indentLine(fmt.Sprintf("# This Jenkinsfile contains the unsupported when condition '%s' on stage '%s'. The stage containing it will not be converted.", u.Name, s.Name), 2))
+		} else if _, ok := when.getFileExists(); ok {
+			// Stages checking for a file run on any trigger, with a condition on their steps
+			releaseStages = append(releaseStages, s)
+			prStages = append(prStages, s)
+		} else if triggeredBy, ok := when.getTriggeredBy(); ok {
+			if _, mapped := triggeredBy.event(); mapped {
+				// Stages matching the cause of the build run on any trigger, with a condition on the job's event
+				releaseStages = append(releaseStages, s)
+				prStages = append(prStages, s)
+			} else {
+				conversionIssues = true
+				stageSettings.countStage(false)
+				stageSettings.addIssue("the when condition triggeredBy '%s'", triggeredBy.Cause)
+				lines = append(lines, indentLine(fmt.Sprintf("# This Jenkinsfile runs the stage '%s' only on builds triggered by %s, which no event of a workflow run stands for. The stage containing it will not be converted.", s.Name, triggeredBy.Cause), pipelineIndent+1))
 			}
-		}
-
-		post := s.getPost()
-		if len(post) > 0 {
+		} else {
 			conversionIssues = true
-			lines = append(lines, indentLine(fmt.Sprintf("# The Jenkinsfile contains a post directive for the stage '%s'. This is not converted.", s.Name), 2))
-			//lines = append(lines, indentLine("# There is no equivalent behavior in Jenkins X pipelines.", 2))
+			stageSettings.countStage(false)
+			unsupported := when.getUnsupported()
+			for _, u := range unsupported {
+				stageSettings.addIssue("the when condition '%s'", u.Name)
+				lines = append(lines, indentLine(fmt.Sprintf("# This Jenkinsfile contains the unsupported when condition '%s' on stage '%s'. The stage containing it will not be converted.", u.Name, s.Name), pipelineIndent+1))
+			}
+			if len(unsupported) == 0 {
+				stageSettings.addIssue("the when condition combining branches and changesets, or matching a changeset with a regular expression")
+				lines = append(lines, indentLine(fmt.Sprintf("# This Jenkinsfile contains a when condition on stage '%s' that combines branches and changesets, or matches a changeset with a regular expression. The stage containing it will not be converted.", s.Name), pipelineIndent+1))
+			}
 		}
 
 		for _, u := range s.getUnsupported() {
+			if u.Name == "input" && s.getInput() != nil {
+				// The input the stage waits for is described on its job
+				continue
+			}
 			conversionIssues = true
-			lines = append(lines, indentLine(fmt.Sprintf("# The Jenkinsfile contains the %s directive for the stage '%s'. This is not converted.", u.Name, s.Name), 2))
-			//lines = append(lines, indentLine("# There is no equivalent behavior in Jenkins X pipelines.", 2))
+			stageSettings.addIssue("the %s directive", u.Name)
+			stageSettings.countUnsupportedDirective()
+			lines = append(lines, indentLine(fmt.Sprintf("# The Jenkinsfile contains the %s directive for the stage '%s'. This is not converted.", u.Name, s.Name), pipelineIndent+1))
+			//lines = append(lines, indentLine("# There is no equivalent behavior in Jenkins X pipelines.", pipelineIndent+1))
+		}
+
+		for _, trigger := range onTrigger {
+			if (trigger == "push" && containsStage(releaseStages, s)) || (trigger == "pull_request" && containsStage(prStages, s)) {
+				workflowStages = appendStageIfMissing(workflowStages, s)
+			}
 		}
 	}
 
-	prLines, hasIssuesInPr, err := prOrReleasePipelineAsYAML(prStages, false)
+	isRelease := len(onTrigger) == 1 && onTrigger[0] == "push"
+	prLines, hasIssuesInPr, err := m.prOrReleasePipelineAsYAML(workflowStages, isRelease, settings)
 	if err != nil {
-		return "", conversionIssues, err
+		return nil, conversionIssues, err
 	}
-	//releaseLines, hasIssuesInRelease, err := prOrReleasePipelineAsYAML(releaseStages, true)
-	//if err != nil {
-	//	return "", conversionIssues, err
-	//}
 	if hasIssuesInPr {
 		conversionIssues = true
 	}
-	lines = append(lines, prLines)
+	lines = append(lines, commentsForLibrarySteps(librarySteps, pipelineIndent+1)...)
+	sections.Jobs = append(lines, prLines...)
+	if opts.ReusableWorkflow {
+		// Declares the secrets the jobs use, so it is built once they are
+		onLines, onIssues := m.linesForWorkflowCall(append(sections.Header, sections.Jobs...), pipelineIndent, settings)
+		if onIssues {
+			conversionIssues = true
+		}
+		sections.On = onLines
+	}
+	sections.jobSources = jobSources
+	sections.Summary.Issues = issues
 
-	return strings.Join(lines, "\n"), conversionIssues, nil
+	if opts.Strict && len(issues) > 0 {
+		return nil, conversionIssues, errors.Errorf("the Jenkinsfile contains constructs that are not fully converted:\n- %s", strings.Join(issues, "\n- "))
+	}
+
+	return sections, conversionIssues, nil
 }
 
-func prOrReleasePipelineAsYAML(stages []*ModelStage, isRelease bool) (string, bool, error) {
+func (m *Model) prOrReleasePipelineAsYAML(stages []*ModelStage, isRelease bool, settings conversionSettings) ([]string, bool, error) {
 	var lines []string
 	conversionIssues := false
 
-	envVars := make(map[string]*ModelEnvironmentEntry)
 	var stepLines []string
 
 	pipelineIndent := 0
 	//lines = append(lines, indentLine("convert-to-github-action:", pipelineIndent))
 
-	var needsPhase []string
-	for idx, s := range stages {
-		// stage 이름을 하나의 문자열로 인식할 수 있게 변경
-		s.Name = strings.ReplaceAll(s.Name, " ", "_")
-		lines = append(lines, indentLine(fmt.Sprintf("%s:", s.Name), pipelineIndent+1))
-		lines = append(lines, indentLine("runs-on: ubuntu-latest", pipelineIndent+2))
-		if idx != 0 {
-			needsPhase = append(needsPhase, stages[idx-1].Name)
-			lines = append(lines, indentLine("if: ${{ always() }}", pipelineIndent+2))
-			lines = append(lines, indentLine(fmt.Sprintf("needs: [%s]", strings.Join(needsPhase, ", ")), pipelineIndent+2))
+	postRunsOn, _ := (&ModelStage{}).runsOn(m.getAgent(), settings.ConvertOptions)
+	post := getPostToConvert(m.getPost(), !isGitHubHostedRunner(postRunsOn))
+	ids := make(jobIDs)
+	if len(post) > 0 {
+		ids.reserve("post")
+	}
+	// Stages guarded by changesets the workflow isn't filtered on check for changes in a job of their own
+	var filters []changesetFilter
+	if !settings.pathsFiltered {
+		for _, s := range stages {
+			if len(s.getChangesets()) > 0 {
+				ids.reserve(changesJobID)
+				break
+			}
 		}
-		lines = append(lines, indentLine("steps: ", pipelineIndent+2))
+	}
 
-		lines = append(lines, indentLine("# Checks-out your repository under $GITHUB_WORKSPACE, so your job can access it", pipelineIndent+3))
-		lines = append(lines, indentLine("- uses: actions/checkout@v3", pipelineIndent+3))
+	var needsPhase []string
+	var previousJobs []string
+	var jobs []string
+	// Every job of the workflow, with the jobs it needs, to check they fit together once all are converted
+	var workflowJobs []workflowJob
+	// The paths earlier stages wrote to the workspace, which the jobs of later stages don't see
+	writes := make(workspaceWrites)
+	earlierJobs := newJobDependencies()
+	for i, stage := range stages {
+		// Jobs split from the same stage run concurrently, after the jobs of the previous stage
+		stageJobs := stage.toParallelJobs()
+		needsPhase = append(needsPhase, previousJobs...)
+		previousJobs = nil
+		var previousStages []*ModelStage
+		for _, s := range stageJobs {
+			if body := s.getUnsupportedBody(); body != "" {
+				// The directive itself is noted with the other directives of the stage that aren't converted
+				lines = append(lines, indentLine(fmt.Sprintf("# The stage '%s' has the %s directive in place of steps, so it is not converted.", s.Name, body), pipelineIndent+1))
+				settings.countStage(false)
+				continue
+			}
+			stageSettings := settings
+			stageSettings.stage = s.Name
+			stageSettings.stepIDs = make(jobIDs)
+			stageSettings.podContainers = s.getPodContainers(m.getAgent())
+			stageSettings.skipDefaultCheckout = settings.skipDefaultCheckout || s.hasOption("skipDefaultCheckout")
+			runsOn, runsOnComments := s.runsOn(m.getAgent(), settings.ConvertOptions)
+			stageSettings.ownRunner = !isGitHubHostedRunner(runsOn)
+			if settings.SkipEmptyStages && s.isEmpty(stageSettings) {
+				lines = append(lines, indentLine(fmt.Sprintf("# The stage '%s' has no steps and is left out.", s.Name), pipelineIndent+1))
+				settings.countStage(false)
+				continue
+			}
+			// stage 이름을 job id로 쓸 수 있게 변경
+			jobID := ids.forName(s.Name)
+			previousJobs = append(previousJobs, jobID)
+			previousStages = append(previousStages, s)
+			jobs = append(jobs, jobID)
+			settings.addJobSource(jobSource{JobID: jobID, Construct: "stage", Stage: stage.Name, Branch: s.parallelBranch})
+
+			// Only the steps of the stage are retried, not its post conditions
+			stepSettings := stageSettings
+			stepSettings.retries = s.getRetryCount()
+			image, stageSteps, stageIssues := s.toImageAndSteps(pipelineIndent+2, stepSettings)
+			computedEnv := append(append([]*ModelEnvironmentEntry{}, m.getEnvironment()...), s.getEnvironment()...)
+			if envStep := linesForComputedEnv(computedEnv, pipelineIndent+2); len(envStep) > 0 {
+				stageSteps = append([]string{strings.Join(envStep, "\n")}, stageSteps...)
+			}
+			postSteps, postIssues := linesForPost(s.getPost(), false, pipelineIndent+2, stageSettings)
+			stageSteps = append(stageSteps, postSteps...)
+			if check, ok := s.getWhen().getFileExists(); ok {
+				stageSteps = withFileExistsCheck(stageSteps, check, pipelineIndent+2, settings)
+			}
 
-		_, stageSteps, stageIssues := s.toImageAndSteps(pipelineIndent + 2)
+			if stageIssues || postIssues {
+				conversionIssues = true
+			}
 
-		if stageIssues {
-			conversionIssues = true
-		}
-		// Deduplicate env vars
-		for _, env := range s.getEnvironment() {
-			if _, ok := envVars[env.Key]; !ok && env.Key != "" {
-				envVars[env.Key] = env
+			lines = append(lines, indentLine(fmt.Sprintf("%s:", jobID), pipelineIndent+1))
+			if jobID != s.Name {
+				lines = append(lines, indentLine(fmt.Sprintf("name: %s", toYamlScalar(s.Name)), pipelineIndent+2))
 			}
-		}
-		stepCount := 1
-		for _, l := range stageSteps {
-			lines = append(lines, indentLine(fmt.Sprintf("- name: step%d", stepCount), pipelineIndent+3))
-			if strings.HasPrefix(l, "|") {
-				fmt.Println(l)
+			if s.parallelBranch != "" {
+				lines = append(lines, indentLine(fmt.Sprintf("# The parallel branch '%s' of the stage '%s' runs as a job of its own, alongside the other branches.", s.parallelBranch, stage.Name), pipelineIndent+2))
+				if stageIssues {
+					lines = append(lines, indentLine("# WARNING: This branch uses steps that don't convert cleanly. Please review them below.", pipelineIndent+2))
+				}
+				if len(postSteps) > 0 {
+					lines = append(lines, indentLine("# The post conditions of the stage run in each of its parallel jobs.", pipelineIndent+2))
+				}
 			}
-			lines = append(lines, l)
-			stepCount++
+			for _, c := range runsOnComments {
+				lines = append(lines, indentLine(c, pipelineIndent+2))
+			}
+			lines = append(lines, indentLine(fmt.Sprintf("runs-on: %s", runsOn), pipelineIndent+2))
+			for _, o := range s.getOptions() {
+				optionLines, optionIssues := linesForStageOption(o, s.Name, stepSettings.retries > 1, pipelineIndent+2)
+				if optionIssues {
+					conversionIssues = true
+					stageSettings.addIssue("the option %s", o.Name)
+					stageSettings.countUnsupportedDirective()
+				}
+				lines = append(lines, optionLines...)
+			}
+			if minutes, ok := s.getTimeoutMinutes(m.getTimeoutMinutes()); ok {
+				lines = append(lines, indentLine(fmt.Sprintf("timeout-minutes: %d", minutes), pipelineIndent+2))
+			}
+			if len(stageSettings.podContainers) > 0 {
+				lines = append(lines, linesForPodContainer(image, pipelineIndent+2, stageSettings)...)
+			} else if dockerAgent := s.getDockerAgent(m.getAgent()); dockerAgent != nil {
+				dockerLines, dockerIssues := linesForDockerAgent(dockerAgent, runsOn, pipelineIndent+2, stageSettings)
+				if dockerIssues {
+					conversionIssues = true
+				}
+				lines = append(lines, dockerLines...)
+			}
+			condition := ""
+			if when := s.getWhen(); when != nil {
+				var branchComments []string
+				if notBranches, ok := when.getNotBranches(); ok {
+					condition, branchComments = notBranchCondition(notBranches)
+				} else if triggeredBy, ok := when.getTriggeredBy(); ok {
+					event, _ := triggeredBy.event()
+					triggered := settings.ReusableWorkflow || containsString(settings.events, event)
+					condition, branchComments = triggeredBy.condition(), triggeredBy.comments(triggered)
+				} else {
+					branches, _ := when.getBranches()
+					condition, branchComments = branchCondition(branches)
+				}
+				for _, c := range branchComments {
+					lines = append(lines, indentLine(c, pipelineIndent+2))
+				}
+			}
+			stageNeeds, needsComments := earlierJobs.stageNeeds(s, writes, needsPhase, settings)
+			for _, c := range needsComments {
+				lines = append(lines, indentLine(c, pipelineIndent+2))
+			}
+			jobNeeds := stageNeeds
+			if paths := s.getChangesets(); len(paths) > 0 && !settings.pathsFiltered {
+				filter := changesetFilter{JobID: jobID, Paths: paths}
+				filters = append(filters, filter)
+				lines = append(lines, indentLine(fmt.Sprintf("# The Jenkinsfile runs this stage only when files matching its changeset change: %s", strings.Join(paths, ", ")), pipelineIndent+2))
+				condition = filter.condition()
+				jobNeeds = append([]string{changesJobID}, stageNeeds...)
+			}
+			if len(stageNeeds) > 0 {
+				if condition != "" {
+					lines = append(lines, indentLine(fmt.Sprintf("if: ${{ always() && (%s) }}", condition), pipelineIndent+2))
+				} else {
+					lines = append(lines, indentLine("if: ${{ always() }}", pipelineIndent+2))
+				}
+				lines = append(lines, indentLine(fmt.Sprintf("needs: [%s]", strings.Join(jobNeeds, ", ")), pipelineIndent+2))
+			} else if condition != "" {
+				lines = append(lines, indentLine(fmt.Sprintf("if: ${{ %s }}", condition), pipelineIndent+2))
+				if len(jobNeeds) > 0 {
+					lines = append(lines, indentLine(fmt.Sprintf("needs: [%s]", strings.Join(jobNeeds, ", ")), pipelineIndent+2))
+				}
+			}
+			workflowJobs = append(workflowJobs, workflowJob{ID: jobID, Needs: jobNeeds})
+			if read := writes.readBy(s); len(read) > 0 {
+				conversionIssues = true
+				stageSettings.addIssue("reading files an earlier stage wrote to the workspace")
+				lines = append(lines, commentsForWorkspaceReads(read, writes, pipelineIndent+2)...)
+			}
+			lines = append(lines, linesForLocks(s.getLockResources(), pipelineIndent+2)...)
+			if input := s.getInput(); input != nil {
+				conversionIssues = true
+				stageSettings.addIssue("the input directive, which waits for approval")
+				lines = append(lines, commentsForInput(input, pipelineIndent+2)...)
+			}
+			var laterStages []*ModelStage
+			for _, later := range stages[i+1:] {
+				laterStages = append(laterStages, later.toParallelJobs()...)
+			}
+			lines = append(lines, linesForJobOutputs(s, laterStages, pipelineIndent+2)...)
+			envLines, err := linesForJobEnv(s.getEnvironment(), m, pipelineIndent+2)
+			if err != nil {
+				return nil, conversionIssues, err
+			}
+			lines = append(lines, withJobOutputs(envLines, earlierJobs.outputsUsedBy(s), pipelineIndent+2)...)
+			if !hasRunnableStep(stageSteps) {
+				stageSteps = append(stageSteps, stepForEmptyStage(pipelineIndent+2))
+			}
+			lines = append(lines, indentLine("steps:", pipelineIndent+2))
+
+			fullHistory := usesGitHistory(stageSteps)
+			if !stageSettings.skipDefaultCheckout {
+				lines = append(lines, linesForDefaultCheckout(fullHistory, pipelineIndent+3, settings)...)
+			} else if fullHistory {
+				stageSteps = withFullHistory(stageSteps, pipelineIndent+2, settings)
+			}
+
+			lines = append(lines, namedStepLines(stageSteps, pipelineIndent+3, stageSettings)...)
+			stepLines = append(stepLines, stageSteps...)
+		}
+		if len(previousJobs) > 0 {
+			settings.countStage(true)
+		}
+		// Jobs of the same stage run concurrently, so only later stages can read what they write
+		for _, s := range stageJobs {
+			writes.add(s)
+		}
+		for i, s := range previousStages {
+			earlierJobs.add(s, previousJobs[i])
 		}
-		stepLines = append(stepLines, stageSteps...)
-	}
-	//lines = append(lines, indentLine("agent:", 6))
-	//lines = append(lines, indentLine(fmt.Sprintf("image: %s", image), 7))
-	var envList []*ModelEnvironmentEntry
-	for _, envVar := range envVars {
-		envList = append(envList, envVar)
-	}
-	envYamlLines, err := toEnvYamlLines(envList)
-	if err != nil {
-		return "", conversionIssues, err
 	}
-	if len(envYamlLines) > 0 {
-		realEnvLines := containsRealEnvLines(envYamlLines)
-		envLineIndent := pipelineIndent + 3
-		if realEnvLines {
-			lines = append(lines, indentLine("environment:", pipelineIndent+3))
-			envLineIndent = pipelineIndent + 4
+
+	if len(filters) > 0 {
+		workflowJobs = append(workflowJobs, workflowJob{ID: changesJobID})
+		settings.addJobSource(jobSource{JobID: changesJobID, Construct: "changeset"})
+		runsOn, _ := (&ModelStage{}).runsOn(m.getAgent(), settings.ConvertOptions)
+		lines = append(lines, linesForChangesJob(filters, runsOn, pipelineIndent+1, settings)...)
+	}
+
+	// The pipeline's post conditions run in a job of their own, once every stage job is done
+	if len(post) > 0 && len(jobs) > 0 {
+		workflowJobs = append(workflowJobs, workflowJob{ID: "post", Needs: jobs})
+		settings.addJobSource(jobSource{JobID: "post", Construct: "post"})
+		lines = append(lines, indentLine("post:", pipelineIndent+1))
+		lines = append(lines, indentLine(fmt.Sprintf("runs-on: %s", postRunsOn), pipelineIndent+2))
+		lines = append(lines, indentLine("if: ${{ always() }}", pipelineIndent+2))
+		lines = append(lines, indentLine(fmt.Sprintf("needs: [%s]", strings.Join(jobs, ", ")), pipelineIndent+2))
+		lines = append(lines, indentLine("steps:", pipelineIndent+2))
+		postSettings := settings
+		postSettings.stepIDs = make(jobIDs)
+		postSettings.ownRunner = !isGitHubHostedRunner(postRunsOn)
+		postSteps, postIssues := linesForPost(post, true, pipelineIndent+2, postSettings)
+		if postIssues {
+			conversionIssues = true
 		}
-		for _, l := range envYamlLines {
-			lines = append(lines, indentLine(l, envLineIndent))
+		fullHistory := usesGitHistory(postSteps)
+		if !settings.skipDefaultCheckout {
+			lines = append(lines, linesForDefaultCheckout(fullHistory, pipelineIndent+3, settings)...)
+		} else if fullHistory {
+			postSteps = withFullHistory(postSteps, pipelineIndent+2, settings)
 		}
+		lines = append(lines, namedStepLines(postSteps, pipelineIndent+3, settings)...)
 	}
+	//lines = append(lines, indentLine("agent:", 6))
+	//lines = append(lines, indentLine(fmt.Sprintf("image: %s", image), 7))
 	//lines = append(lines, indentLine("steps:", 6))
 	if len(stepLines) == 0 {
 		conversionIssues = true
+		settings.addIssue("no stages were found that will be run")
+		// A job failing on purpose keeps the workflow valid, since GitHub rejects one without jobs
+		workflowJobs = append(workflowJobs, workflowJob{ID: noStagesJobID})
+		runsOn, _ := (&ModelStage{}).runsOn(m.getAgent(), settings.ConvertOptions)
 		lines = append(lines, indentLine("# No stages were found that will be run.", pipelineIndent+1))
-		lines = append(lines, indentLine("- name: step0", pipelineIndent+1))
-		lines = append(lines, indentLine("runs: echo 'No stages found, failing' && exit 1", pipelineIndent+2))
+		lines = append(lines, indentLine(noStagesJobID+":", pipelineIndent+1))
+		lines = append(lines, indentLine(fmt.Sprintf("runs-on: %s", runsOn), pipelineIndent+2))
+		lines = append(lines, indentLine("steps:", pipelineIndent+2))
+		lines = append(lines, indentLine("- name: step0", pipelineIndent+3))
+		lines = append(lines, indentLine("run: echo 'No stages found, failing' && exit 1", pipelineIndent+4))
+	}
+	if err := validateJobs(workflowJobs); err != nil {
+		return nil, conversionIssues, err
 	}
 
-	return strings.Join(lines, "\n"), conversionIssues, nil
+	return lines, conversionIssues, nil
 }
 
 // UnsupportedModelBlock represents a field that is unsupported and will cause an error.
 type UnsupportedModelBlock struct {
-	Name  string `@Ident`
-	Value string `@RawString`
+	Name  string `parser:"@Ident" json:"name,omitempty"`
+	Value string `parser:"@RawString" json:"value,omitempty"`
 }
 
 // ToString converts the model to a rough string form
@@ -328,43 +897,81 @@ func (m *UnsupportedModelBlock) ToString() string {
 
 // ModelPipelineEntry represents the directives that can be contained within the pipeline block
 type ModelPipelineEntry struct {
-	Agent       *ModelAgent              `"agent" "{" @@ "}"`
-	Environment []*ModelEnvironmentEntry `| "environment" "{" { @@ } "}"`
-	Stages      []*ModelStage            `| "stages" "{" { @@ } "}"`
-	Post        []*ModelPostEntry        `| "post" "{" { @@ } "}"`
-	Unsupported []*UnsupportedModelBlock `| @@`
+	Agent       *ModelAgent              `parser:"\"agent\" \"{\" @@ \"}\"" json:"agent,omitempty"`
+	Environment []*ModelEnvironmentEntry `parser:"| \"environment\" \"{\" { @@ } \"}\"" json:"environment,omitempty"`
+	Stages      []*ModelStage            `parser:"| \"stages\" \"{\" { @@ } \"}\"" json:"stages,omitempty"`
+	Post        []*ModelPostEntry        `parser:"| \"post\" \"{\" { @@ } \"}\"" json:"post,omitempty"`
+	Options     []*ModelOption           `parser:"| \"options\" \"{\" { @@ } \"}\"" json:"options,omitempty"`
+	Parameters  []*ModelParameter        `parser:"| \"parameters\" \"{\" { @@ } \"}\"" json:"parameters,omitempty"`
+	Unsupported []*UnsupportedModelBlock `parser:"| @@" json:"unsupported,omitempty"`
+}
+
+// ModelOption represents an entry in the options block, such as `timeout(time: 1, unit: 'HOURS')`
+type ModelOption struct {
+	Name string          `parser:"@Ident" json:"name,omitempty"`
+	Args []*ModelCallArg `parser:"\"(\" ( @@ { \",\" @@ } )? \")\"" json:"args,omitempty"`
+}
+
+// ToString converts the model to a rough string form
+func (m *ModelOption) ToString() string {
+	var args []string
+	for _, a := range m.Args {
+		args = append(args, a.ToString())
+	}
+	return fmt.Sprintf("%s(%s)", m.Name, strings.Join(args, ", "))
 }
 
 // ModelAgent represents the agent block in Declarative
 type ModelAgent struct {
-	Label string `("label" | "kubernetes") @(String|RawString)`
+	Label      string            `parser:"  \"label\" @(String|Char|RawString)" json:"label,omitempty"`
+	Kubernetes string            `parser:"| \"kubernetes\" @(String|RawString)" json:"kubernetes,omitempty"`
+	Docker     *ModelDockerAgent `parser:"| \"docker\" @@" json:"docker,omitempty"`
 }
 
 // ToString converts the model to a rough string form
 func (m *ModelAgent) ToString() string {
+	if m.Kubernetes != "" {
+		return fmt.Sprintf("agent kubernetes: %s", toCurlyStringFromEscaped(m.Kubernetes))
+	}
+	if m.Docker != nil {
+		return fmt.Sprintf("agent %s", m.Docker.ToString())
+	}
 	return fmt.Sprintf("agent label: %s", m.Label)
 }
 
 // ModelEnvironmentEntry represents a `foo = bar` (or `foo = credentials("bar")` in the environment block
 type ModelEnvironmentEntry struct {
-	Key   string                      `@Ident`
-	Value *ModelEnvironmentEntryValue `"=" @@`
+	Key   string                      `parser:"@Ident" json:"key,omitempty"`
+	Value *ModelEnvironmentEntryValue `parser:"\"=\" @@" json:"value,omitempty"`
 }
 
-func toEnvYamlLines(modelVars []*ModelEnvironmentEntry) ([]string, error) {
+func toEnvYamlLines(modelVars []*ModelEnvironmentEntry, model *Model) ([]string, error) {
 	var invalidVars []string
 	var envVars []map[string]string
 	for _, e := range modelVars {
+		if e.Value != nil && e.Value.Credential != nil {
+			credentialComments, credentialVars := e.toCredentialEnv(model)
+			invalidVars = append(invalidVars, credentialComments...)
+			envVars = append(envVars, credentialVars...)
+			continue
+		}
 		convertedVars, isInvalid := e.ToEnv()
+		if e.Value != nil && !isInvalid && e.Value.changesCase() {
+			invalidVars = append(invalidVars, fmt.Sprintf("# WARNING: The variable '%s' changes the case of its value, which is left out. Please change the case in the steps reading it instead.", e.Key))
+		}
 		if isInvalid {
 			invalidVars = append(invalidVars, fmt.Sprintf("# The variable '%s' has the value '%s', which cannot be converted.", e.Key, e.Value.ToString()))
 		} else {
-			envVars = append(envVars, convertedVars...)
+			envVars = append(envVars, withSecretParameterEnv(convertedVars, model.getSecretParameters())...)
 		}
 	}
 	if len(envVars) == 0 {
 		return invalidVars, nil
 	}
+	// Sorted by name, so that the env reads the same however the Jenkinsfile orders its variables
+	sort.SliceStable(envVars, func(i, j int) bool {
+		return envVarName(envVars[i]) < envVarName(envVars[j])
+	})
 	envYamlBytes, err := yaml.Marshal(envVars)
 	if err != nil {
 		return nil, err
@@ -374,6 +981,90 @@ func toEnvYamlLines(modelVars []*ModelEnvironmentEntry) ([]string, error) {
 	return append(invalidVars, strings.Split(envYaml, "\n")...), nil
 }
 
+// envVarName returns the name of a converted environment variable, which is the only key of its map
+func envVarName(vars map[string]string) string {
+	for name := range vars {
+		return name
+	}
+	return ""
+}
+
+// linesForJobEnv converts the environment of a stage into the env of its job
+func linesForJobEnv(modelVars []*ModelEnvironmentEntry, model *Model, indent int) ([]string, error) {
+	envYamlLines, err := toEnvYamlLines(modelVars, model)
+	if err != nil || len(envYamlLines) == 0 {
+		return nil, err
+	}
+	var lines []string
+	envLineIndent := indent
+	if containsRealEnvLines(envYamlLines) {
+		lines = append(lines, indentLine("env:", indent))
+		envLineIndent = indent + 1
+	}
+	for _, l := range envYamlLines {
+		if !strings.HasPrefix(l, "#") {
+			// list라서 생긴 -를 공백으로 변경
+			l = strings.TrimPrefix(l, "- ")
+		}
+		lines = append(lines, indentLine(l, envLineIndent))
+	}
+	return lines, nil
+}
+
+// Directives holding the body of a stage in place of its steps, like nested stages, which aren't converted
+var stageBodyDirectives = []string{"stages", "parallel", "matrix"}
+
+// getUnsupportedBody returns the directive the stage has in place of steps, like a matrix, which isn't converted, or
+// an empty string if the stage has none
+func (m *ModelStage) getUnsupportedBody() string {
+	if len(m.getSteps()) > 0 {
+		return ""
+	}
+	for _, u := range m.getUnsupported() {
+		if containsString(stageBodyDirectives, u.Name) {
+			return u.Name
+		}
+	}
+	return ""
+}
+
+// isEmpty checks if the stage does nothing: it has no post conditions, no directives that aren't converted, and no
+// steps other than those left out, like milestone
+func (m *ModelStage) isEmpty(settings conversionSettings) bool {
+	if len(m.getPost()) > 0 {
+		return false
+	}
+	for _, u := range m.getUnsupported() {
+		if u.Name != "input" || m.getInput() == nil {
+			return false
+		}
+	}
+	for _, step := range m.getSteps() {
+		if !(settings.isLeftOut(step) && len(step.NestedSteps) == 0) && !settings.isIgnoredScript(step) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasRunnableStep checks if any of the converted steps is more than a comment
+func hasRunnableStep(steps []string) bool {
+	for _, step := range steps {
+		if !isCommentOnly(step) {
+			return true
+		}
+	}
+	return false
+}
+
+// stepForEmptyStage is the step a stage without steps runs, since a job needs at least one
+func stepForEmptyStage(indent int) string {
+	return strings.Join([]string{
+		indentLine("# The stage has no steps, so its job runs this one only.", indent+2),
+		indentLine("run: echo 'This stage has no steps.'", indent+2),
+	}, "\n")
+}
+
 // ToEnv converts to jenkins-x.yml friendly environment variables
 func (m *ModelEnvironmentEntry) ToEnv() ([]map[string]string, bool) {
 	for _, e := range unusedEnvVars {
@@ -382,67 +1073,120 @@ func (m *ModelEnvironmentEntry) ToEnv() ([]map[string]string, bool) {
 		}
 	}
 
+	if m.Value.Command != nil {
+		// Computed in a step of each job instead, if possible
+		_, ok := m.Value.Command.getScript()
+		return nil, !ok
+	}
+
+	if m.Value.Credential != nil {
+		// Set from secrets instead, see toCredentialEnv
+		return nil, false
+	}
+
+	if m.Value.Param != nil {
+		return []map[string]string{{
+			m.Key: fmt.Sprintf("${{ inputs.%s }}", *m.Value.Param),
+		}}, false
+	}
+
 	if m.Value.StringValue != nil && strings.Contains(*m.Value.StringValue, "$") {
-		return nil, true
+		// Parameters are read from the inputs, and Jenkins' built-in variables from the GitHub context instead
+		value := paramsInterpolationRegexp.ReplaceAllString(stripInterpolatedCaseMethods(*m.Value.StringValue), "$${{ inputs.$1$2 }}")
+		value, ok := withGitHubBuiltins(value)
+		if !ok {
+			return nil, true
+		}
+		return []map[string]string{{
+			m.Key: unescapeArg(value),
+		}}, false
 	}
 
+	// Multiline strings are escaped onto one line for the parser
 	return []map[string]string{{
-		m.Key: *m.Value.StringValue,
+		m.Key: unescapeArg(*m.Value.StringValue),
 	}}, false
 }
 
-// ModelEnvironmentEntryValue represents either a string or a credentials step's value
+// changesCase checks if the value changes the case of a string or of an interpolation, which is left out
+func (m *ModelEnvironmentEntryValue) changesCase() bool {
+	return m.CaseMethod != nil || (m.StringValue != nil && interpolatedCaseMethodRegexp.MatchString(*m.StringValue))
+}
+
+// ModelEnvironmentEntryValue represents either a string, whose change of case is left out, a credentials step's value
+// or the output of a shell command
 type ModelEnvironmentEntryValue struct {
-	StringValue *string `  @(String|Char)`
-	Credential  *string `| "credentials" "(" @(String|Char) ")"`
+	StringValue *string                  `parser:"  @(String|Char)" json:"stringValue,omitempty"`
+	CaseMethod  *string                  `parser:"  [ \".\" @(\"toLowerCase\" | \"toUpperCase\") \"(\" \")\" ]" json:"caseMethod,omitempty"`
+	Credential  *string                  `parser:"| \"credentials\" \"(\" @(String|Char) \")\"" json:"credential,omitempty"`
+	Param       *string                  `parser:"| \"params\" \".\" @Ident" json:"param,omitempty"`
+	Command     *ModelEnvironmentCommand `parser:"| @@" json:"command,omitempty"`
 }
 
 // ToString converts the model to a rough string form
 func (m *ModelEnvironmentEntryValue) ToString() string {
 	if m.StringValue != nil {
-		return *m.StringValue
+		return unescapeArg(*m.StringValue)
 	}
 	if m.Credential != nil {
 		return *m.Credential
 	}
+	if m.Param != nil {
+		return "params." + *m.Param
+	}
+	if m.Command != nil {
+		return m.Command.ToString()
+	}
 	return "n/a"
 }
 
 // ModelStage represents a stage in a Jenkinsfile
 type ModelStage struct {
-	Name    string             `"stage" "(" @String ")"`
-	Entries []*ModelStageEntry `"{" { @@ } "}"`
+	Name    string             `parser:"\"stage\" \"(\" @String \")\"" json:"name,omitempty"`
+	Entries []*ModelStageEntry `parser:"\"{\" { @@ } \"}\"" json:"entries,omitempty"`
+
+	// parallelBranch is the name of the parallel branch this stage was split from, if any
+	parallelBranch string
 }
 
 func imageFromContainerStep(step *ModelStep) string {
 	if len(step.Args) == 1 {
 		return step.getArg()
-	} else {
-		for _, a := range step.Args {
-			if a.Named != nil && a.Named.Key == "name" && a.Named.Value != nil {
-				return removeQuotesAndTrim(a.Named.Value.ToString())
-			}
-		}
+	} else if name := step.getNamedArg("name"); name != "" {
+		return name
 	}
 
 	return "maven"
 }
 
 // toImageAndSteps converts the model to jenkins-x.yml representation
-func (m *ModelStage) toImageAndSteps(indent int) (string, []string, bool) {
+func (m *ModelStage) toImageAndSteps(indent int, settings conversionSettings) (string, []string, bool) {
+	return stepsToImageAndSteps(m.getSteps(), indent, settings)
+}
+
+// stepsToImageAndSteps converts the given steps, of a stage or a post condition, to jenkins-x.yml representation
+func stepsToImageAndSteps(steps []*ModelStep, indent int, settings conversionSettings) (string, []string, bool) {
 	var stepLines []string
 
 	var baseSteps []stepDirAndImage
 
 	conversionIssues := false
 
-	// Use the maven pod template as a default
+	// Use the first container of the kubernetes agent's pod, or else the maven pod template, as a default. Images are
+	// tracked by container name, and resolved to the image of the pod container with that name at the end.
 	image := "maven"
+	if len(settings.podContainers) > 0 {
+		image = settings.podContainers[0].Name
+	}
 
-	if len(m.getSteps()) > 0 && m.getSteps()[0].Name == "container" {
-		image = imageFromContainerStep(m.getSteps()[0])
+	if len(steps) > 0 && steps[0].Name == "container" {
+		image = imageFromContainerStep(steps[0])
+		if _, ok := settings.podImage(image); !ok {
+			conversionIssues = true
+			stepLines = append(stepLines, strings.Join(linesForUnknownPodContainer(image, indent, settings), "\n"))
+		}
 	}
-	for _, s := range m.getSteps() {
+	for _, s := range steps {
 		baseSteps = append(baseSteps, s.nestedStepsWithDirAndImage("", image)...)
 	}
 
@@ -455,52 +1199,284 @@ func (m *ModelStage) toImageAndSteps(indent int) (string, []string, bool) {
 		}
 	}
 
+	// Tool homes assigned to variables in script blocks, which later sh steps may use
+	var scriptTools []jenkinsTool
+
+	// Whether Node.js is set up for the steps yet, by a tool step or before the first sh step that needs it
+	nodeSetUp := false
+	usesNvmrc := false
+	for _, s := range stepsToInclude {
+		if s.step.Name == "sh" {
+			usesNvmrc = usesNvmrc || nvmrcRegexp.MatchString(unescapeArg(s.step.getArg()))
+		}
+	}
+
 	for _, s := range stepsToInclude {
 		var singleStep []string
+		issuesBefore := settings.issueCount()
 
-		if s.step.Name == "sh" || s.step.Name == "echo" {
-			if len(s.step.Args) != 1 {
+		if mapping, ok := settings.stepMapping(s.step); ok {
+			singleStep = append(singleStep, linesForMappedStep(s.step, mapping, indent)...)
+		} else if isNotificationStep(s.step) {
+			conversionIssues = true
+			settings.addIssue("the step %s, converted to a commented-out step", s.step.Name)
+			singleStep = append(singleStep, linesForMailStep(s.step, indent, settings)...)
+		} else if isBuildToolWrapper(s.step) {
+			singleStep = append(singleStep, linesForBuildToolWrapper(s.step, indent, settings)...)
+		} else if isCredentialWrapper(s.step) {
+			singleStep = append(singleStep, linesForCredentialWrapper(s.step, indent, settings)...)
+		} else if s.step.Name == parallelMapStep {
+			singleStep = append(singleStep, indentLine("# The branches of the parallel step run one after another here, since the stage has other steps as well.", indent+1))
+		} else if s.step.Name == parallelBranchStep {
+			singleStep = append(singleStep, indentLine(fmt.Sprintf("# The parallel branch '%s':", s.step.getArg()), indent+1))
+		} else if s.step.Name == "checkout" && s.step.getArg() == "scm" {
+			// The repository is checked out at the start of every job, unless the default checkout is skipped
+			if !settings.skipDefaultCheckout {
+				settings.countStep(nil, issuesBefore)
+				continue
+			}
+			singleStep = append(singleStep, indentLine("uses: "+settings.action("actions/checkout"), indent+2))
+		} else if s.step.Name == "junit" && len(s.step.getPatternsArg("testResults")) > 0 {
+			singleStep = append(singleStep, linesForJunitStep(s.step, indent, settings)...)
+		} else if s.step.Name == "archiveArtifacts" && len(s.step.getPatternsArg("artifacts")) > 0 {
+			singleStep = append(singleStep, linesForArchiveArtifacts(s.step, indent, settings)...)
+		} else if s.step.Name == "stash" && s.step.getStashName() != "" {
+			singleStep = append(singleStep, linesForStash(s.step, s.dir, indent, settings)...)
+		} else if s.step.Name == "unstash" && s.step.getStashName() != "" {
+			singleStep = append(singleStep, linesForUnstash(s.step, s.dir, indent, settings)...)
+		} else if s.step.Name == "dir" {
+			// A dir step with nested steps is replaced by them, each running in the folder
+			conversionIssues = true
+			settings.addIssue("the step dir without nested steps")
+			singleStep = append(singleStep, commentsForDirWithoutSteps(s.step, indent)...)
+		} else if settings.isLeftOut(s.step) {
+			singleStep = append(singleStep, linesForIgnoredStep(s.step, indent)...)
+		} else if isWorkspaceCleanup(s.step) {
+			singleStep = append(singleStep, linesForWorkspaceCleanup(s.step, s.dir, indent)...)
+		} else if settings.isIgnoredScript(s.step) {
+			scriptSteps, _ := parseStepsText(unescapeArg(s.step.getArg()))
+			for _, scriptStep := range scriptSteps {
+				singleStep = append(singleStep, linesForIgnoredStep(scriptStep, indent)...)
+			}
+		} else if s.step.Name == "timeout" && len(s.step.NestedSteps) > 0 {
+			// The wrapped steps follow, converted as usual
+			conversionIssues = true
+			settings.addIssue("the step timeout")
+			singleStep = append(singleStep, commentsForTimeout(s.step, indent+1)...)
+		} else if s.step.Name == "input" {
+			conversionIssues = true
+			settings.addIssue("the step input, which waits for approval")
+			singleStep = append(singleStep, commentsForInput(inputFromStep(s.step), indent+2)...)
+			singleStep = append(singleStep, linesForInvalidStep(s.step, "Approve the job with an environment instead, and remove this step.", indent)...)
+		} else if s.step.Name == "tool" {
+			nodeSetUp = nodeSetUp || toolFromStep(s.step).kind() == "nodejs"
+			toolLines, toolIssues := linesForToolSetup(toolFromStep(s.step), indent, settings)
+			if toolIssues {
+				conversionIssues = true
+				settings.addIssue("the tool '%s', which has no known setup action", toolFromStep(s.step).Name)
+			}
+			singleStep = append(singleStep, toolLines...)
+		} else if assignments, ok := scriptAssignments(s.step); ok {
+			singleStep = append(singleStep, linesForScriptAssignments(assignments, indent)...)
+		} else if s.step.Name == "script" && len(s.step.Args) == 1 && s.step.Args[0].Unnamed != nil {
+			// Set up any tools the script resolves before the script itself, which can't be translated
+			for _, t := range toolsFromScript(s.step.getArg()) {
+				toolLines, _ := linesForToolSetup(t, indent, settings)
+				stepLines = append(stepLines, strings.Join(toolLines, "\n"))
+				if t.Variable != "" {
+					scriptTools = append(scriptTools, t)
+				}
+			}
+			conversionIssues = true
+			settings.addIssue("the step script")
+			br := buildResultFromScript(s.step.getArg())
+			if br.Only {
+				previousStepID := ""
+				if br.Conditional && len(stepLines) > 0 && !isCommentOnly(stepLines[len(stepLines)-1]) {
+					// Let the previous step fail without failing the job, like an unstable build in Jenkins
+					stepLines[len(stepLines)-1], previousStepID = continueOnError(stepLines[len(stepLines)-1], indent, settings)
+				}
+				singleStep = append(singleStep, linesForBuildResult(br, previousStepID, indent)...)
+			} else {
+				singleStep = append(singleStep, commentsForBuildResult(br, indent)...)
+				singleStep = append(singleStep, linesForInvalidStep(s.step, "", indent)...)
+			}
+		} else if s.step.Name == "sh" || s.step.Name == "echo" || s.step.Name == "bat" || s.step.Name == "powershell" {
+			step := s.step
+			shell := shellStep{}
+			if s.step.Name != "echo" && len(s.step.Args) > 0 && s.step.Args[0].Named != nil {
+				if named, ok := toShellStep(s.step); ok {
+					shell = named
+					step = shell.step
+					shellLines, shellIssues := shell.linesBefore(indent, settings)
+					if shellIssues {
+						conversionIssues = true
+					}
+					singleStep = append(singleStep, shellLines...)
+				}
+			}
+			if len(step.Args) != 1 {
 				conversionIssues = true
+				settings.addIssue("the step %s, with additional parameters", s.step.Name)
 				singleStep = append(singleStep, linesForInvalidStep(s.step, "Additional parameters to the Jenkins Pipeline sh step are not supported", indent)...)
 			} else {
-				arg := s.step.Args[0]
+				arg := step.Args[0]
 				if arg.Unnamed == nil {
 					conversionIssues = true
+					settings.addIssue("the step %s, with named parameters", s.step.Name)
 					singleStep = append(singleStep, linesForInvalidStep(s.step, "Named parameters to the Jenkins Pipeline sh step are not supported", indent)...)
+				} else if build, ok := dockerBuildFromScript(unescapeArg(step.getArg())); ok && settings.DockerActions && s.step.Name == "sh" && s.dir == "" && shell.step == nil {
+					stepLines = append(stepLines, linesForDockerBuild(build, indent, settings)...)
 				} else {
-					jxArgs := s.step.getJxArg()
+					if packageManager, ok := nodePackageManager(unescapeArg(step.getArg())); ok && settings.SetupActions && s.step.Name == "sh" && !nodeSetUp {
+						nodeSetUp = true
+						stepLines = append(stepLines, strings.Join(linesForSetupNode(packageManager, usesNvmrc, indent, settings), "\n"))
+					}
+					jxArgs := withSecretParameters(step.getJxArg(), settings.secretParameters)
+					for _, t := range scriptTools {
+						if t.referencedIn(strings.Join(jxArgs, "\n")) {
+							singleStep = append(singleStep, indentLine(fmt.Sprintf("# '%s' held the home of the Jenkins tool '%s'. The path may differ on GitHub runners, where the tool is on the PATH.", t.Variable, t.Name), indent+2))
+						}
+					}
+					if methods := groovyMethods(jxArgs); len(methods) > 0 {
+						conversionIssues = true
+						singleStep = append(singleStep, commentsForGroovyMethods(methods, s.step.Name, indent+2, settings)...)
+					}
+					interpolationLines, interpolationIssues := commentsForInterpolations(interpolationChanges(step.getGroovyLines(), settings.secretParameters), s.step.Name, indent+2, settings)
+					if interpolationIssues {
+						conversionIssues = true
+					}
+					singleStep = append(singleStep, interpolationLines...)
 					if s.step.Name == "echo" {
-						singleStep = append(singleStep, indentLine(fmt.Sprintf("run: %s %s", s.step.Name, strings.Join(jxArgs, " ")), indent+2))
-					} else if len(jxArgs) == 1 {
-						singleStep = append(singleStep, indentLine(fmt.Sprintf("run: %s", jxArgs[0]), indent+2))
-						//singleStep = append(singleStep, indentLine(fmt.Sprintf("shell: sh"), indent))
-					} else {
-						singleStep = append(singleStep, indentLine(fmt.Sprintf("run: %s", jxArgs[0]), indent+2))
-						//singleStep = append(singleStep, indentLine(fmt.Sprintf("shell: sh"), indent))
-						for _, argLine := range jxArgs[1:] {
-							singleStep = append(singleStep, indentLine(argLine, indent+3))
+						jxArgs = toEchoCommands(jxArgs)
+					}
+					jxArgs = withLiteralDollars(jxArgs)
+					if shell.returnStdout {
+						jxArgs = withCapturedStdout(jxArgs)
+					}
+					commands := [][]string{jxArgs}
+					// The status and output of a script are those of all of its commands
+					if settings.SplitCommands && s.step.Name == "sh" && s.image == image && !shell.returnStatus && !shell.returnStdout {
+						commands = splitCommands(jxArgs)
+						if len(commands) > 1 {
+							singleStep = append(singleStep, indentLine(fmt.Sprintf("# The sh step is split into a step for each of the %d commands it joins with &&.", len(commands)), indent+2))
 						}
 					}
-					if s.image != image {
-						singleStep = append(singleStep, indentLine(fmt.Sprintf("image: %s", s.image), indent))
+					for i, command := range commands {
+						if i > 0 {
+							// Each command after the first runs in a step of its own
+							stepLines = append(stepLines, strings.Join(singleStep, "\n"))
+							singleStep = nil
+						}
+						if len(command) == 1 && shell.label == "" && s.step.Name == "sh" {
+							if name := buildToolStepName(command[0]); name != "" {
+								singleStep = append(singleStep, indentLine(fmt.Sprintf("name: %s", toYamlScalar(name)), indent+2))
+							}
+						}
+						if settings.retries > 1 && s.step.Name == "sh" {
+							command = withRetryLoop(command, settings.retries)
+						}
+						if len(command) == 1 {
+							// Commands like `echo foo: bar` or `make # all` are quoted, so YAML reads them as they are
+							singleStep = append(singleStep, indentLine(fmt.Sprintf("run: %s", toYamlScalar(command[0])), indent+2))
+							//singleStep = append(singleStep, indentLine(fmt.Sprintf("shell: sh"), indent))
+						} else {
+							singleStep = append(singleStep, indentLine(fmt.Sprintf("run: %s", command[0]), indent+2))
+							//singleStep = append(singleStep, indentLine(fmt.Sprintf("shell: sh"), indent))
+							for _, argLine := range command[1:] {
+								singleStep = append(singleStep, indentLine(argLine, indent+3))
+							}
+						}
+						if s.step.Name == "bat" {
+							singleStep = append(singleStep, indentLine("shell: cmd", indent+2))
+						} else if s.step.Name == "powershell" {
+							singleStep = append(singleStep, indentLine("shell: powershell", indent+2))
+						}
+						if s.image != image {
+							containerLines, containerIssues := linesForStepContainer(s.image, indent, settings)
+							if containerIssues {
+								conversionIssues = true
+							}
+							singleStep = append(containerLines, singleStep...)
+						}
+						if s.dir != "" {
+							singleStep = append(singleStep, indentLine(fmt.Sprintf("working-directory: %s", workingDirectory(s.dir)), indent+2))
+						}
 					}
-					if s.dir != "" {
-						singleStep = append(singleStep, indentLine(fmt.Sprintf("working-directory: ./%s", s.dir), indent+2))
+					outputID := ""
+					if shell.returnStdout {
+						outputID = settings.stepIDs.forStep("sh-output")
 					}
+					singleStep = append(singleStep, shell.linesAfter(outputID, indent)...)
 				}
 			}
+		} else if isLibraryStep(s.step) {
+			// What a shared library step does is unknown, so leave a step to replace
+			conversionIssues = true
+			settings.addIssue("the shared library step %s", s.step.Name)
+			settings.addLibraryStep(s.step.Name)
+			singleStep = append(singleStep, linesForLibraryStep(s.step, indent)...)
 		} else {
 			// Not a valid step, so add a boilerplate "echo 'step (name) can't be translated' && exit 1" sh, and a
 			// comment with the original text
 			conversionIssues = true
+			settings.addIssue("the step %s", s.step.Name)
 			singleStep = append(singleStep, linesForInvalidStep(s.step, "", indent)...)
 		}
 		if len(singleStep) > 0 {
 			stepLines = append(stepLines, strings.Join(singleStep, "\n"))
 		}
+		if s.step.Name != parallelMapStep && s.step.Name != parallelBranchStep {
+			settings.countStep(singleStep, issuesBefore)
+		}
+	}
+
+	podImage, _ := settings.podImage(image)
+	return podImage, stepLines, conversionIssues
+}
+
+// namedStepLines names each converted step of a job, leaving comment-only steps as they are. With the StepIDs option,
+// steps that don't have an id yet are given one derived from their name, unique within the job.
+func namedStepLines(steps []string, indent int, settings conversionSettings) []string {
+	ids := jobIDs{}
+	idPrefix := indentLine("id: ", indent+1)
+	for _, l := range steps {
+		for _, stepLine := range strings.Split(l, "\n") {
+			if strings.HasPrefix(stepLine, idPrefix) {
+				ids.reserve(strings.TrimPrefix(stepLine, idPrefix))
+			}
+		}
 	}
 
-	return image, stepLines, conversionIssues
+	var lines []string
+	stepCount := 1
+	namePrefix := indentLine("name: ", indent+1)
+	for _, l := range steps {
+		if isCommentOnly(l) {
+			lines = append(lines, l)
+			continue
+		}
+		name := fmt.Sprintf("step%d", stepCount)
+		// Steps named in the Jenkinsfile, like a sh step with a label, keep their name
+		if strings.Contains("\n"+l, "\n"+namePrefix) {
+			var stepLines []string
+			for _, stepLine := range strings.Split(l, "\n") {
+				if strings.HasPrefix(stepLine, namePrefix) {
+					name = strings.TrimPrefix(stepLine, namePrefix)
+				} else {
+					stepLines = append(stepLines, stepLine)
+				}
+			}
+			l = strings.Join(stepLines, "\n")
+		}
+		lines = append(lines, indentLine(fmt.Sprintf("- name: %s", name), indent))
+		if settings.StepIDs && !strings.Contains("\n"+l, "\n"+idPrefix) {
+			lines = append(lines, indentLine(fmt.Sprintf("id: %s", ids.forName(name)), indent+1))
+		}
+		lines = append(lines, l)
+		stepCount++
+	}
+	return lines
 }
 
 func linesForInvalidStep(step *ModelStep, reason string, indent int) []string {
@@ -521,11 +1497,22 @@ func linesForInvalidStep(step *ModelStep, reason string, indent int) []string {
 	return stepLines
 }
 
+// indentLine indents a line by the given number of levels. The workflow is built with the default width, and
+// indented by the width of the options once it is complete.
 func indentLine(line string, count int) string {
 	if strings.TrimSpace(line) == "" {
 		return line
 	}
-	return fmt.Sprintf("%s%s", strings.Repeat(indent, count), line)
+	return strings.Repeat(" ", count*defaultIndentWidth) + line
+}
+
+func (m *ModelStage) getAgent() *ModelAgent {
+	for _, e := range m.Entries {
+		if e.Agent != nil {
+			return e.Agent
+		}
+	}
+	return nil
 }
 
 func (m *ModelStage) getEnvironment() []*ModelEnvironmentEntry {
@@ -564,6 +1551,15 @@ func (m *ModelStage) getWhen() *ModelWhen {
 	return nil
 }
 
+func (m *ModelStage) getOptions() []*ModelOption {
+	for _, e := range m.Entries {
+		if len(e.Options) > 0 {
+			return e.Options
+		}
+	}
+	return nil
+}
+
 func (m *ModelStage) getPost() []*ModelPostEntry {
 	for _, e := range m.Entries {
 		if len(e.Post) > 0 {
@@ -575,29 +1571,118 @@ func (m *ModelStage) getPost() []*ModelPostEntry {
 
 // ModelStageEntry represents the various directives contained within a stage
 type ModelStageEntry struct {
-	Agent       *ModelAgent              `  "agent" "{" @@ "}"`
-	Environment []*ModelEnvironmentEntry `| "environment" "{" { @@ } "}"`
-	Steps       []*ModelStep             `| "steps" "{" { @@ } "}"`
-	Post        []*ModelPostEntry        `| "post" "{" { @@ } "}"`
-	When        *ModelWhen               `| "when" "{" @@ "}"`
-	Unsupported []*UnsupportedModelBlock `| @@`
+	Agent       *ModelAgent              `parser:"  \"agent\" \"{\" @@ \"}\"" json:"agent,omitempty"`
+	Environment []*ModelEnvironmentEntry `parser:"| \"environment\" \"{\" { @@ } \"}\"" json:"environment,omitempty"`
+	Steps       []*ModelStep             `parser:"| \"steps\" \"{\" { @@ } \"}\"" json:"steps,omitempty"`
+	Post        []*ModelPostEntry        `parser:"| \"post\" \"{\" { @@ } \"}\"" json:"post,omitempty"`
+	When        *ModelWhen               `parser:"| \"when\" \"{\" @@ \"}\"" json:"when,omitempty"`
+	Options     []*ModelOption           `parser:"| \"options\" \"{\" { @@ } \"}\"" json:"options,omitempty"`
+	Unsupported []*UnsupportedModelBlock `parser:"| @@" json:"unsupported,omitempty"`
 }
 
-// ModelWhen represents a when block - only branch is supported currently
+// ModelWhen represents a when block - only branch, changeset and changeRequest conditions, optionally combined with
+// anyOf, and branch conditions negated with not are supported currently
 type ModelWhen struct {
-	Branch      string                   `"branch" @String`
-	Unsupported []*UnsupportedModelBlock `| @@`
+	Flags         []*ModelWhenFlag         `parser:"{ @@ }" json:"flags,omitempty"`
+	Branch        string                   `parser:"( \"branch\" @(String|Char)" json:"branch,omitempty"`
+	Changeset     *ModelWhenChangeset      `parser:"| \"changeset\" @@" json:"changeset,omitempty"`
+	ChangeRequest bool                     `parser:"| @\"changeRequest\" [ \"(\" \")\" ]" json:"changeRequest,omitempty"`
+	AnyOf         []*ModelWhen             `parser:"| \"anyOf\" \"{\" { @@ } \"}\"" json:"anyOf,omitempty"`
+	Not           *ModelWhen               `parser:"| \"not\" \"{\" @@ \"}\"" json:"not,omitempty"`
+	TriggeredBy   []*ModelStepArg          `parser:"| \"triggeredBy\" @@ { \",\" @@ }" json:"triggeredBy,omitempty"`
+	Unsupported   []*UnsupportedModelBlock `parser:"| @@ ) [ \";\" ]" json:"unsupported,omitempty"`
+	FlagsAfter    []*ModelWhenFlag         `parser:"{ @@ }" json:"flagsAfter,omitempty"`
+}
+
+// ModelWhenFlag represents the beforeAgent, beforeInput and beforeOptions flags of a when block. They only change
+// when the condition is evaluated, so they're ignored, since jobs are skipped before anything else happens anyway.
+type ModelWhenFlag struct {
+	Name  string `parser:"@(\"beforeAgent\"|\"beforeInput\"|\"beforeOptions\")" json:"name,omitempty"`
+	Value string `parser:"@Ident [ \";\" ]" json:"value,omitempty"`
 }
 
 // ToString converts the model to a rough string form
 func (m *ModelWhen) ToString() string {
+	if len(m.AnyOf) > 0 {
+		var conditions []string
+		for _, c := range m.AnyOf {
+			conditions = append(conditions, c.ToString())
+		}
+		return fmt.Sprintf("when: anyOf { %s }", strings.Join(conditions, "; "))
+	}
+	if m.Not != nil {
+		return fmt.Sprintf("when: not { %s }", m.Not.ToString())
+	}
+	if m.Changeset != nil {
+		return fmt.Sprintf("when: changeset %s", m.Changeset.Pattern)
+	}
+	if m.ChangeRequest {
+		return "when: changeRequest"
+	}
+	if len(m.TriggeredBy) > 0 {
+		var args []string
+		for _, a := range m.TriggeredBy {
+			args = append(args, a.ToString())
+		}
+		return fmt.Sprintf("when: triggeredBy %s", strings.Join(args, ", "))
+	}
 	return fmt.Sprintf("when: branch %s", m.Branch)
 }
 
+// getBranches returns the branches the condition matches, splitting comma-separated lists. It returns false if the
+// condition depends on anything but branches. changeRequest matches pull requests, which multibranch pipelines build
+// on PR-* branches.
+func (m *ModelWhen) getBranches() ([]string, bool) {
+	if len(m.Unsupported) > 0 || m.Changeset != nil || m.Not != nil {
+		return nil, false
+	}
+	if m.ChangeRequest {
+		return []string{"PR-*"}, true
+	}
+	if len(m.AnyOf) > 0 {
+		var branches []string
+		for _, c := range m.AnyOf {
+			nested, ok := c.getBranches()
+			if !ok {
+				return nil, false
+			}
+			branches = append(branches, nested...)
+		}
+		return branches, true
+	}
+	var branches []string
+	for _, b := range strings.Split(m.Branch, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			branches = append(branches, b)
+		}
+	}
+	return branches, len(branches) > 0
+}
+
+// getNotBranches returns the branches a `not { branch ... }` condition excludes, and false for any other condition
+func (m *ModelWhen) getNotBranches() ([]string, bool) {
+	if m.Not == nil || len(m.Unsupported) > 0 {
+		return nil, false
+	}
+	return m.Not.getBranches()
+}
+
+// getUnsupported returns the unsupported conditions, including those nested in anyOf and not
+func (m *ModelWhen) getUnsupported() []*UnsupportedModelBlock {
+	unsupported := m.Unsupported
+	for _, c := range m.AnyOf {
+		unsupported = append(unsupported, c.getUnsupported()...)
+	}
+	if m.Not != nil {
+		unsupported = append(unsupported, m.Not.getUnsupported()...)
+	}
+	return unsupported
+}
+
 // ModelPostEntry represents a post condition and its steps
 type ModelPostEntry struct {
-	Kind  string       `@Ident`
-	Steps []*ModelStep `"{" { @@ } "}"`
+	Kind  string       `parser:"@Ident" json:"kind,omitempty"`
+	Steps []*ModelStep `parser:"\"{\" { @@ } \"}\"" json:"steps,omitempty"`
 }
 
 func (m *ModelPostEntry) isDefaultCleanWs() bool {
@@ -610,9 +1695,9 @@ func (m *ModelPostEntry) isDefaultCleanWs() bool {
 
 // ModelStep represents either a normal step or a script block
 type ModelStep struct {
-	Name        string          `@Ident`
-	Args        []*ModelStepArg `"("? @@? { "," @@ } ")"?`
-	NestedSteps []*ModelStep    `("{" { @@ } "}")*`
+	Name        string          `parser:"@Ident" json:"name,omitempty"`
+	Args        []*ModelStepArg `parser:"\"(\"? @@? { \",\" @@ } \")\"?" json:"args,omitempty"`
+	NestedSteps []*ModelStep    `parser:"(\"{\" { @@ } \"}\")*" json:"nestedSteps,omitempty"`
 }
 
 type stepDirAndImage struct {
@@ -632,9 +1717,16 @@ func (m *ModelStep) nestedStepsWithDirAndImage(baseDir string, baseImage string)
 		})
 	} else {
 		if m.Name == "dir" {
-			baseDir = strings.Trim(m.getArg(), "./")
+			baseDir = joinDir(baseDir, m.getArg())
 		} else if m.Name == "container" {
 			baseImage = imageFromContainerStep(m)
+		} else if isBuildToolWrapper(m) || isCredentialWrapper(m) || isIgnoredStep(m) || m.Name == "timeout" || m.Name == parallelMapStep || m.Name == parallelBranchStep {
+			// Keep the wrapper itself, so its setup is converted ahead of the wrapped steps
+			steps = append(steps, stepDirAndImage{
+				step:  m,
+				dir:   baseDir,
+				image: baseImage,
+			})
 		}
 		for _, s := range m.NestedSteps {
 			steps = append(steps, s.nestedStepsWithDirAndImage(baseDir, baseImage)...)
@@ -654,7 +1746,56 @@ func (m *ModelStep) getJxArg() []string {
 	fixedArg = strings.ReplaceAll(fixedArg, doubleQuotePlaceholder, "\"")
 	fixedArg = strings.ReplaceAll(fixedArg, singleQuotePlaceholder, "'")
 
-	return toMultilineQuote(fixedArg)
+	var jxArgs []string
+	for _, l := range toMultilineQuote(fixedArg) {
+		jxArgs = append(jxArgs, toShellInterpolations(l))
+	}
+	return withGitHubBuiltinVariables(jxArgs)
+}
+
+// getGroovyLines returns the lines of the argument of the step before their interpolations are converted
+func (m *ModelStep) getGroovyLines() []string {
+	arg := strings.ReplaceAll(m.getArg(), doubleQuotePlaceholder, "\"")
+	return toMultilineQuote(strings.ReplaceAll(arg, singleQuotePlaceholder, "'"))
+}
+
+// getNamedArg returns the value of the named argument with the given key, or an empty string if there isn't one
+func (m *ModelStep) getNamedArg(key string) string {
+	for _, a := range m.Args {
+		if a.Named != nil && a.Named.Key == key && a.Named.Value != nil {
+			return strings.ReplaceAll(removeQuotesAndTrim(a.Named.Value.ToString()), literalDollarPlaceholder, "$")
+		}
+	}
+	return ""
+}
+
+// toEchoCommands turns the text of an echo step, as returned by getJxArg, into shell echo commands. Interpolations
+// are left to the shell, and multiline text gets one echo per line.
+func toEchoCommands(jxArgs []string) []string {
+	if len(jxArgs) == 1 {
+		return []string{toEchoCommand(jxArgs[0])}
+	}
+
+	textLines := jxArgs[1:]
+	for len(textLines) > 0 && textLines[0] == "" {
+		textLines = textLines[1:]
+	}
+	for len(textLines) > 0 && textLines[len(textLines)-1] == "" {
+		textLines = textLines[:len(textLines)-1]
+	}
+	commands := []string{"|"}
+	for _, l := range textLines {
+		commands = append(commands, toEchoCommand(l))
+	}
+	return commands
+}
+
+func toEchoCommand(text string) string {
+	text = strings.ReplaceAll(text, "\"", "\\\"")
+	text = strings.ReplaceAll(text, "`", "\\`")
+	// Literal dollar signs stay literal within the double quotes
+	text = strings.ReplaceAll(text, literalDollarPlaceholder, "\\"+literalDollarPlaceholder)
+	return fmt.Sprintf("echo \"%s\"", text)
 }
 
 func (m *ModelStep) getArg() string {
@@ -734,13 +1875,13 @@ func (m *ModelStep) toOriginalGroovy() string {
 		}
 	}
 
-	return strings.Join(lines, "\n")
+	return strings.ReplaceAll(strings.Join(lines, "\n"), literalDollarPlaceholder, "$")
 }
 
 // ModelStepArg represents an argument to a step
 type ModelStepArg struct {
-	Unnamed *Value             `  @@`
-	Named   *ModelStepNamedArg `| @@`
+	Unnamed *Value             `parser:"  @@" json:"unnamed,omitempty"`
+	Named   *ModelStepNamedArg `parser:"| @@" json:"named,omitempty"`
 }
 
 // ToString converts the model to a rough string form
@@ -755,8 +1896,8 @@ func (m *ModelStepArg) ToString() string {
 }
 
 type ModelStepNamedArg struct {
-	Key   string `@(Ident|String|Char)`
-	Value *Value `":" @@`
+	Key   string `parser:"@(Ident|String|Char)" json:"key,omitempty"`
+	Value *Value `parser:"\":\" @@" json:"value,omitempty"`
 }
 
 // ToString converts the model to a rough string form
@@ -765,10 +1906,55 @@ func (m *ModelStepNamedArg) ToString() string {
 }
 
 type Value struct {
-	String *string  `  @(String|RawString)`
-	Number *float64 `| @Float`
-	Int    *int64   `| @Int`
-	Bool   *bool    `| (@"true" | "false")`
+	String *string         `parser:"  @(String|Char|RawString)" json:"string,omitempty"`
+	Number *float64        `parser:"| @Float" json:"number,omitempty"`
+	Int    *int64          `parser:"| @Int" json:"int,omitempty"`
+	Bool   *Boolean        `parser:"| @(\"true\" | \"false\")" json:"bool,omitempty"`
+	List   []*ModelCallArg `parser:"| \"[\" ( @@ { \",\" @@ } )? \"]\"" json:"list,omitempty"`
+	Param  *string         `parser:"| \"params\" \".\" @Ident" json:"param,omitempty"`
+	EnvVar *string         `parser:"| \"env\" \".\" @Ident" json:"envVar,omitempty"`
+}
+
+// Boolean is a value of true or false. Capturing a keyword into a bool would make both of them true.
+type Boolean bool
+
+// Capture sets the boolean from the keyword it's parsed from
+func (b *Boolean) Capture(values []string) error {
+	*b = values[0] == "true"
+	return nil
+}
+
+// ModelCallArg represents an argument that may itself be a call, like `developers()` in a list value or
+// `logRotator(...)` in an option
+type ModelCallArg struct {
+	Call *ValueCall    `parser:"  @@" json:"call,omitempty"`
+	Arg  *ModelStepArg `parser:"| @@" json:"arg,omitempty"`
+}
+
+// ToString converts the model to a rough string form
+func (m *ModelCallArg) ToString() string {
+	if m.Call != nil {
+		return m.Call.ToString()
+	}
+	if m.Arg != nil {
+		return m.Arg.ToString()
+	}
+	return "(none)"
+}
+
+// ValueCall represents a call used as a value, such as `developers()`
+type ValueCall struct {
+	Name string          `parser:"@Ident \"(\"" json:"name,omitempty"`
+	Args []*ModelStepArg `parser:"( @@ { \",\" @@ } )? \")\"" json:"args,omitempty"`
+}
+
+// ToString converts the model to a rough string form
+func (m *ValueCall) ToString() string {
+	var args []string
+	for _, a := range m.Args {
+		args = append(args, a.ToString())
+	}
+	return fmt.Sprintf("%s(%s)", m.Name, strings.Join(args, ", "))
 }
 
 // ToString converts the model to a rough string form
@@ -777,20 +1963,54 @@ func (v *Value) ToString() string {
 		return "\"" + *v.String + "\""
 	}
 	if v.Number != nil {
-		return fmt.Sprintf("%d", v.Number)
+		return strconv.FormatFloat(*v.Number, 'f', -1, 64)
 	}
 	if v.Int != nil {
-		return fmt.Sprintf("%d", v.Int)
+		return strconv.FormatInt(*v.Int, 10)
 	}
 	if v.Bool != nil {
 		return fmt.Sprintf("%t", *v.Bool)
 	}
+	// References like params.VERSION are the same as their interpolation, like "${params.VERSION}", so that they're
+	// converted the same way
+	if v.Param != nil {
+		return fmt.Sprintf("\"${params.%s}\"", *v.Param)
+	}
+	if v.EnvVar != nil {
+		return fmt.Sprintf("\"${env.%s}\"", *v.EnvVar)
+	}
+	if v.List != nil {
+		var items []string
+		for _, i := range v.List {
+			items = append(items, i.ToString())
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
 
 	return "n/a"
 }
 
 // ParseJenkinsfileInDirectory looks for a Jenkinsfile in a directory and parses it
 func ParseJenkinsfileInDirectory(dir string) (*Model, error) {
+	return ParseJenkinsfileInDirectoryNamed(dir, "")
+}
+
+// ParseJenkinsfileInDirectoryNamed looks for a Jenkinsfile with the given name in a directory and parses it. The name
+// is the file name or glob pattern of the Jenkinsfile, or empty to look for the common names of Jenkinsfiles, as
+// FindJenkinsfile does. Given a file instead of a directory, it parses that file.
+func ParseJenkinsfileInDirectoryNamed(dir string, name string) (*Model, error) {
+	isDir, err := doesDirExist(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error checking if %s is a directory", dir)
+	}
+	if isDir {
+		jenkinsfile, err := FindJenkinsfile(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		return ParseJenkinsfile(jenkinsfile)
+	}
+
 	fileExists, err := doesFileExist(dir)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Error checking if %s is a file", dir)
@@ -832,35 +2052,118 @@ func ParseJenkinsfile(jenkinsfile string) (*Model, error) {
 		return nil, err
 	}
 
-	replacedJF := strings.ReplaceAll(string(jf), "\\$", "\\\\$")
-	replacedJF = strings.ReplaceAll(replacedJF, ".toLowerCase()", "")
-	replacedJF = strings.ReplaceAll(replacedJF, "agent any", "")
+	model, err := ParseText(string(jf))
+	if errors.Is(err, ErrNoPipelineBlock) || errors.Is(err, ErrNotText) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Jenkinsfile %s cannot be parsed. It may contain code outside of the pipeline {} block, or it may not have a pipeline {} block at all.", jenkinsfile)
+	}
 
-	curlyBlocks := GetBlocks(replacedJF)
-	for _, b := range curlyBlocks {
-		replacedJF = escapeUnsupportedFieldsInContext(b, "steps", supportedSteps, replacedJF, false)
-		replacedJF = escapeUnsupportedFieldsInContext(b, "when", supportedWhenFields, replacedJF, false)
-		replacedJF = escapeUnsupportedFieldsInContext(b, "agent", unsupportedAgentFields, replacedJF, true)
-		replacedJF = escapeUnsupportedFieldsInContext(b, "stage", unsupportedStageFields, replacedJF, true)
-		replacedJF = escapeUnsupportedFieldsInContext(b, "pipeline", unsupportedTopLevelFields, replacedJF, true)
+	return model, nil
+}
+
+// ErrNoPipelineBlock is returned for a Jenkinsfile that is empty, or has nothing but comments
+var ErrNoPipelineBlock = errors.New("No pipeline block found; the file appears empty.")
+
+// Matches the agents that don't ask for an agent of their own, `agent any` and `agent none`, which run on the default
+// runner like pipelines without an agent
+var anyAgentRegexp = regexp.MustCompile(`\bagent\s+(any|none)\b`)
+
+// Matches the comments of a Jenkinsfile, to tell whether there is anything else in it
+var jenkinsfileCommentRegexp = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+
+// ParseText takes the text of a Jenkinsfile and returns the resulting model
+func ParseText(jf string) (*Model, error) {
+	jf, err := decodeJenkinsfile(jf)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(jenkinsfileCommentRegexp.ReplaceAllString(jf, "")) == "" {
+		return nil, ErrNoPipelineBlock
+	}
+	model, err := parseJenkinsfileText(jf, unsupportedTopLevelFields, unsupportedStageFields)
+	if err != nil {
+		// Options and parameters the grammar doesn't understand are escaped like any other unsupported directive, so
+		// that the rest of the pipeline can still be converted
+		escapedOptions := append([]string{"options", "parameters"}, unsupportedTopLevelFields...)
+		escapedStageOptions := append([]string{"options"}, unsupportedStageFields...)
+		if fallback, fallbackErr := parseJenkinsfileText(jf, escapedOptions, escapedStageOptions); fallbackErr == nil {
+			slog.Debug("Parsed Jenkinsfile with its options escaped", "error", err)
+			return fallback, nil
+		}
+		return nil, err
 	}
 
-	replacedJF = escapeSingleQuotedOrMultilineStrings(replacedJF)
+	return model, nil
+}
 
+// Preprocess escapes the parts of the Jenkinsfile text the grammar doesn't support, returning the text the grammar
+// parses
+func Preprocess(jf string) string {
+	return escapeJenkinsfileText(jf, unsupportedTopLevelFields, unsupportedStageFields)
+}
+
+// parseJenkinsfileText escapes the unsupported parts of the Jenkinsfile text, with the given unsupported top level
+// and stage fields, and parses the result
+func parseJenkinsfileText(jf string, topLevelFields []string, stageFields []string) (*Model, error) {
 	parser, err := participle.Build(&Model{})
 	if err != nil {
 		return nil, err
 	}
 	model := &Model{}
-	err = parser.ParseString(replacedJF, model)
-
+	err = parser.ParseString(escapeJenkinsfileText(jf, topLevelFields, stageFields), model)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Jenkinsfile %s cannot be parsed. It may contain code outside of the pipeline {} block, or it may not have a pipeline {} block at all.", jenkinsfile)
+		return nil, err
 	}
 
 	return model, nil
 }
 
+// modelSteps represents a bare list of steps, such as the body of a script block
+type modelSteps struct {
+	Steps []*ModelStep `parser:"\"steps\" \"{\" { @@ } \"}\""`
+}
+
+// parseStepsText parses Groovy text holding steps only, escaping it the same way as a whole Jenkinsfile
+func parseStepsText(text string) ([]*ModelStep, error) {
+	parser, err := participle.Build(&modelSteps{})
+	if err != nil {
+		return nil, err
+	}
+	steps := &modelSteps{}
+	err = parser.ParseString(escapeJenkinsfileText("steps {\n"+text+"\n}", nil, unsupportedStageFields), steps)
+	if err != nil {
+		return nil, err
+	}
+
+	return steps.Steps, nil
+}
+
+// escapeJenkinsfileText escapes the parts of the Jenkinsfile text the grammar doesn't support, with the given
+// unsupported top level and stage fields
+func escapeJenkinsfileText(jf string, topLevelFields []string, stageFields []string) string {
+	replacedJF := strings.ReplaceAll(rewriteProperties(unwrapNode(jf)), "\\$", "\\\\$")
+	replacedJF = stripCaseMethods(replacedJF)
+	replacedJF = anyAgentRegexp.ReplaceAllString(replacedJF, "")
+	replacedJF = checkoutScmRegexp.ReplaceAllString(replacedJF, "${1}checkout('scm')")
+	replacedJF = rewriteParallelMaps(replacedJF)
+
+	curlyBlocks := GetBlocks(replacedJF)
+	for _, b := range curlyBlocks {
+		replacedJF = escapeUnsupportedFieldsInContext(b, "steps", supportedSteps, replacedJF, false)
+		replacedJF = escapeUnsupportedFieldsInContext(b, parallelBranchStep, supportedSteps, replacedJF, false)
+		replacedJF = escapeUnsupportedFieldsInContext(b, "when", supportedWhenFields, replacedJF, false)
+		replacedJF = escapeUnsupportedFieldsInContext(b, "anyOf", supportedWhenFields, replacedJF, false)
+		replacedJF = escapeUnsupportedFieldsInContext(b, "not", supportedWhenFields, replacedJF, false)
+		replacedJF = escapeUnsupportedFieldsInContext(b, "agent", unsupportedAgentFields, replacedJF, true)
+		replacedJF = escapeUnsupportedFieldsInContext(b, "stage", stageFields, replacedJF, true)
+		replacedJF = escapeUnsupportedFieldsInContext(b, "pipeline", topLevelFields, replacedJF, true)
+	}
+
+	return escapeSingleQuotedOrMultilineStrings(replacedJF)
+}
+
 func escapeUnsupportedFieldsInContext(block curlyBlock, context string, fields []string, jfText string, isBlacklist bool) string {
 	if block.Name == context {
 		for _, nested := range block.Nested {
@@ -876,7 +2179,15 @@ func toEscapedFromCurlyString(curly string) string {
 	wsPrefix := ""
 	wsRegexp := regexp.MustCompile(`^(\s+)\S`)
 	var indentRemoved []string
+	// Lines within multiline strings, like the pod YAML of a kubernetes agent, keep their indentation
+	inMultiline := false
 	for _, l := range strings.Split(curly, "\n") {
+		if inMultiline {
+			indentRemoved = append(indentRemoved, l)
+			inMultiline = (strings.Count(l, "'''")+strings.Count(l, `"""`))%2 == 0
+			continue
+		}
+		inMultiline = (strings.Count(l, "'''")+strings.Count(l, `"""`))%2 == 1
 		if l != "" && wsPrefix == "" {
 			match := wsRegexp.FindStringSubmatch(l)
 			if len(match) > 0 && match[1] != "" {
@@ -893,6 +2204,13 @@ func toEscapedFromCurlyString(curly string) string {
 	return escaped
 }
 
+// toEscapedMultilineString escapes the content of a string in triple quotes onto one line. Its lines keep their
+// indentation, which dedentLines removes as far as they share it once the string is used.
+func toEscapedMultilineString(multiline string) string {
+	escaped := strings.ReplaceAll(multiline, "\n", newlinePlaceholder)
+	return strings.ReplaceAll(escaped, "`", backtickPlaceholder)
+}
+
 func unescapeMultiline(escaped string) string {
 	unescaped := strings.ReplaceAll(escaped, newlinePlaceholder, "\n")
 	unescaped = strings.ReplaceAll(unescaped, "\\\\", "\\")
@@ -900,23 +2218,78 @@ func unescapeMultiline(escaped string) string {
 	return unescaped
 }
 
+// unescapeArg turns an escaped step argument back into its plain text
+func unescapeArg(escaped string) string {
+	unescaped := strings.ReplaceAll(escaped, multilineDoubleQuotePlaceholder, "")
+	unescaped = strings.ReplaceAll(unescaped, multilineSingleQuotePlaceholder, "")
+	unescaped = strings.ReplaceAll(unescaped, doubleQuotePlaceholder, "\"")
+	unescaped = strings.ReplaceAll(unescaped, "\\"+singleQuotePlaceholder, "'")
+	unescaped = strings.ReplaceAll(unescaped, singleQuotePlaceholder, "'")
+	unescaped = strings.ReplaceAll(unescaped, literalDollarPlaceholder, "$")
+	return unescapeMultiline(unescaped)
+}
+
 func toMultilineQuote(escaped string) []string {
 	if strings.Contains(escaped, multilineSingleQuotePlaceholder) || strings.Contains(escaped, multilineDoubleQuotePlaceholder) {
 		unescaped := strings.ReplaceAll(escaped, multilineDoubleQuotePlaceholder, "")
 		unescaped = strings.ReplaceAll(unescaped, multilineSingleQuotePlaceholder, "")
 
-		var lines = []string{"|"}
-		for _, l := range strings.Split(unescapeMultiline(unescaped), "\n") {
-			lines = append(lines, strings.TrimSpace(l))
+		dedented := dedentLines(strings.Split(unescapeMultiline(unescaped), "\n"))
+		// YAML takes the indentation of a block scalar from its first line, so if that line is indented more than
+		// others, like a command before an unindented heredoc body, the indentation is given explicitly. The lines
+		// are always indented one level deeper than the key they're the value of.
+		indicator := "|"
+		if len(dedented) > 0 && strings.HasPrefix(dedented[0], " ") {
+			indicator = "|2"
 		}
-		return lines
+		return append([]string{indicator}, dedented...)
 	}
 
 	return []string{escaped}
 }
 
+// dedentLines removes the leading and trailing blank lines, and the indentation all remaining lines share, so that
+// nested commands keep their indentation relative to each other. Text on the line of the opening quotes has no
+// indentation of its own, so it doesn't count.
+func dedentLines(lines []string) []string {
+	onOpeningLine := len(lines) > 0 && strings.TrimSpace(lines[0]) != ""
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	prefix := ""
+	hasPrefix := false
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "" || (i == 0 && onOpeningLine) {
+			continue
+		}
+		lineIndent := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		if !hasPrefix {
+			prefix = lineIndent
+			hasPrefix = true
+		}
+		// Indentation mixing tabs and spaces, like a heredoc body indented with tabs for <<-, is only shared as far
+		// as the characters match
+		for !strings.HasPrefix(lineIndent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	var dedented []string
+	for i, l := range lines {
+		if i == 0 && onOpeningLine {
+			l = strings.TrimLeft(l, " \t")
+		}
+		dedented = append(dedented, strings.TrimRight(strings.TrimPrefix(l, prefix), " \t"))
+	}
+	return dedented
+}
+
 func toCurlyStringFromEscaped(escaped string) string {
-	return "{" + unescapeMultiline(escaped) + "}"
+	return "{" + unescapeMultiline(strings.ReplaceAll(escaped, literalDollarPlaceholder, "$")) + "}"
 }
 
 type curlyBlock struct {
@@ -942,7 +2315,9 @@ func GetBlocks(fullString string) []curlyBlock {
 
 	var blocks []curlyBlock
 
-	var re = regexp.MustCompile(`(\w+)(\(.*?\))?\s+{`)
+	// The arguments of a block, like those of stage('Build'), may span lines, as long as they hold no parentheses
+	// themselves, so that a block is found the same way whether its arguments are on one line or several
+	var re = regexp.MustCompile(`(\w+)(\(.*?\)|\([^()]*\))?\s+{`)
 
 	for _, matchingIdx := range re.FindAllStringSubmatchIndex(fullString, -1) {
 		// Start with the name - matchingIdx[2]:matchingIdx[3] is the submatch's index
@@ -997,11 +2372,16 @@ func escapeSingleQuotedOrMultilineStrings(fullString string) string {
 	var reDoubleQuoteMultiline = regexp.MustCompile(`(?s)"""(.*?)"""`)
 
 	for _, sqm := range reSingleQuoteMultiline.FindAllStringSubmatch(fullString, -1) {
-		fullString = strings.ReplaceAll(fullString, "'''"+sqm[1]+"'''", "'"+multilineSingleQuotePlaceholder+toEscapedFromCurlyString(sqm[1])+multilineSingleQuotePlaceholder+"'")
+		// Single quotes within the string, like those of a heredoc's <<'EOF', would end it early, so they're replaced
+		// with a placeholder
+		escaped := strings.ReplaceAll(toEscapedMultilineString(sqm[1]), "'", singleQuotePlaceholder)
+		fullString = strings.ReplaceAll(fullString, "'''"+sqm[1]+"'''", "'"+multilineSingleQuotePlaceholder+escaped+multilineSingleQuotePlaceholder+"'")
 	}
 
 	for _, dqm := range reDoubleQuoteMultiline.FindAllStringSubmatch(fullString, -1) {
-		fullString = strings.ReplaceAll(fullString, "\"\"\""+dqm[1]+"\"\"\"", "\""+multilineSingleQuotePlaceholder+toEscapedFromCurlyString(dqm[1])+multilineSingleQuotePlaceholder+"\"")
+		// Double quotes within the string would end it early, so they're replaced with a placeholder
+		escaped := strings.ReplaceAll(toEscapedMultilineString(dqm[1]), "\"", doubleQuotePlaceholder)
+		fullString = strings.ReplaceAll(fullString, "\"\"\""+dqm[1]+"\"\"\"", "\""+multilineSingleQuotePlaceholder+escaped+multilineSingleQuotePlaceholder+"\"")
 	}
 
 	inDoubleQuote := false
@@ -1086,7 +2466,12 @@ func escapeSingleQuotedOrMultilineStrings(fullString string) string {
 		default:
 			if inEscapeQuote {
 				strInSingleQuote = strInSingleQuote + string(c)
-				sqReplacement = sqReplacement + string(c)
+				if c == '$' {
+					// Groovy doesn't interpolate single-quoted strings
+					sqReplacement = sqReplacement + literalDollarPlaceholder
+				} else {
+					sqReplacement = sqReplacement + string(c)
+				}
 			}
 		}
 	}
@@ -0,0 +1,63 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Matches a change of case of a variable, like `TAG.toUpperCase()`, which is left out, since names are used as
+	// they are, or an interpolation, which is left for toShellInterpolations to warn about. Changes of case of a string,
+	// like `"$APP_NAME".toLowerCase()`, are parsed with the environment variables they set.
+	caseMethodRegexp = regexp.MustCompile(`\$\{[^}]*\}|(\w)\.(?:toLowerCase|toUpperCase)\(\)`)
+	// Matches a change of case in an interpolation, like `${TAG.toUpperCase()}`, capturing the interpolation up to it
+	interpolatedCaseMethodRegexp = regexp.MustCompile(`(\$\{[^}]*?)\.(?:toLowerCase|toUpperCase)\(\)`)
+	// Matches a Groovy method called in an interpolation of a double-quoted string, like
+	// `${env.TAG.replaceAll('/', '-')}`, capturing the method
+	groovyMethodRegexp = regexp.MustCompile(`\$\{[^}]*?\.(\w+)\s*\(`)
+)
+
+// stripCaseMethods leaves out the changes of case of variables in the Jenkinsfile text, outside of interpolations
+func stripCaseMethods(jf string) string {
+	return caseMethodRegexp.ReplaceAllStringFunc(jf, func(match string) string {
+		if strings.HasPrefix(match, "${") {
+			return match
+		}
+		return match[:1]
+	})
+}
+
+// stripInterpolatedCaseMethods leaves out the changes of case in the interpolations of a double-quoted string
+func stripInterpolatedCaseMethods(text string) string {
+	for interpolatedCaseMethodRegexp.MatchString(text) {
+		text = interpolatedCaseMethodRegexp.ReplaceAllString(text, "$1")
+	}
+	return text
+}
+
+// groovyMethods returns the Groovy methods the lines of a converted command call in interpolations, in the order
+// they're called, which the shell can't run
+func groovyMethods(lines []string) []string {
+	var methods []string
+	for _, l := range lines {
+		for _, match := range groovyMethodRegexp.FindAllStringSubmatch(l, -1) {
+			if !containsString(methods, match[1]) {
+				methods = append(methods, match[1])
+			}
+		}
+	}
+	return methods
+}
+
+// commentsForGroovyMethods warns that the command calls Groovy methods, which are passed on to the shell as they are
+func commentsForGroovyMethods(methods []string, stepName string, indent int, settings conversionSettings) []string {
+	for _, method := range methods {
+		settings.addIssue("the Groovy method %s in the step %s", method, stepName)
+	}
+	called := fmt.Sprintf("the Groovy method %s", methods[0])
+	if len(methods) > 1 {
+		called = fmt.Sprintf("the Groovy methods %s", strings.Join(methods, ", "))
+	}
+	return []string{indentLine(fmt.Sprintf("# WARNING: The %s step calls %s in an interpolation, which the shell can't run. Please compute the value with shell commands instead.", stepName, called), indent)}
+}
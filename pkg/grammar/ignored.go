@@ -0,0 +1,68 @@
+package grammar
+
+import "fmt"
+
+// Steps that have no effect on GitHub Actions, and why. Unlike stepsToRemove, which are dropped silently as setup
+// noise, these are dropped with a comment. Wrappers among them have their nested steps converted as usual.
+var ignoredSteps = map[string]string{
+	"milestone":  "GitHub Actions has no milestones. A concurrency group with cancel-in-progress cancels older runs instead",
+	"timestamps": "GitHub Actions timestamps every log line",
+	"ansiColor":  "GitHub Actions renders ANSI colors in logs",
+	"cleanWs":    "every job starts with a fresh workspace on GitHub-hosted runners",
+	"deleteDir":  "every job starts with a fresh workspace on GitHub-hosted runners",
+}
+
+// Steps that clean the workspace, which are only ignored on GitHub-hosted runners
+var workspaceCleanupSteps = []string{"cleanWs", "deleteDir"}
+
+func isIgnoredStep(step *ModelStep) bool {
+	_, ok := ignoredSteps[step.Name]
+	return ok
+}
+
+func isWorkspaceCleanup(step *ModelStep) bool {
+	return containsString(workspaceCleanupSteps, step.Name)
+}
+
+// isLeftOut checks if a step is left out of the job. Steps cleaning the workspace are kept on runners that aren't
+// GitHub-hosted, which keep the workspace between jobs.
+func (s conversionSettings) isLeftOut(step *ModelStep) bool {
+	return isIgnoredStep(step) && !(s.ownRunner && isWorkspaceCleanup(step))
+}
+
+// isIgnoredScript checks if a script block holds nothing but steps left out, like `script { milestone(1) }`
+func (s conversionSettings) isIgnoredScript(step *ModelStep) bool {
+	if step.Name != "script" || len(step.Args) != 1 || step.Args[0].Unnamed == nil {
+		return false
+	}
+	scriptSteps, err := parseStepsText(unescapeArg(step.getArg()))
+	if err != nil || len(scriptSteps) == 0 {
+		return false
+	}
+	for _, scriptStep := range scriptSteps {
+		if !s.isLeftOut(scriptStep) || len(scriptStep.NestedSteps) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// linesForIgnoredStep notes in a single comment that a step is left out
+func linesForIgnoredStep(step *ModelStep, indent int) []string {
+	return []string{indentLine(fmt.Sprintf("# The step %s is left out: %s.", step.Name, ignoredSteps[step.Name]), indent+1)}
+}
+
+// linesForWorkspaceCleanup converts a step cleaning the workspace, or the folder of the dir step it is in for
+// deleteDir, into a run step emptying it
+func linesForWorkspaceCleanup(step *ModelStep, dir string, indent int) []string {
+	lines := []string{indentLine(fmt.Sprintf("# The job runs on a runner that isn't GitHub-hosted, which keeps the workspace between jobs, so the step %s is kept.", step.Name), indent+2)}
+	if step.Name == "cleanWs" && len(step.Args) > 0 {
+		lines = append(lines, indentLine("# WARNING: The arguments of cleanWs are left out, so the whole workspace is emptied.", indent+2))
+	}
+	if step.Name == "deleteDir" && dir != "" {
+		lines = append(lines, indentLine(fmt.Sprintf("working-directory: %s", workingDirectory(dir)), indent+2))
+		lines = append(lines, indentLine("run: find . -mindepth 1 -delete", indent+2))
+		return lines
+	}
+	return append(lines, indentLine(`run: find "$GITHUB_WORKSPACE" -mindepth 1 -delete`, indent+2))
+}
@@ -0,0 +1,205 @@
+package grammar
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// The indentation width the workflow is indented by unless another one is given
+	defaultIndentWidth = 2
+	// The widest indentation, which keeps deeply nested steps readable
+	maxIndentWidth = 8
+)
+
+var (
+	// Matches a sequence item holding a mapping, like `- name: build`, whose keys line up after the dash
+	sequenceMappingRegexp = regexp.MustCompile(`^-( +)[^'"\s#\[{&*!|>][^#]*?:(?: |$)`)
+	// Matches a line starting a block scalar, like `run: |` or `run: |2`, capturing its explicit indentation, which is
+	// relative to the key
+	blockScalarRegexp = regexp.MustCompile(`(?:^|: |^- +)[|>]([1-9]?)[-+]?$`)
+)
+
+// ParseIndentWidth reads the number of spaces to indent the workflow by, which is 0 for the default width if the text
+// is empty
+func ParseIndentWidth(text string) (int, error) {
+	if text = strings.TrimSpace(text); text == "" {
+		return 0, nil
+	}
+	width, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, errors.Errorf("the indentation width '%s' isn't a number", text)
+	}
+	return width, checkIndentWidth(width)
+}
+
+// checkIndentWidth checks that the workflow can be indented by the given width. Sequence items need at least 2
+// spaces, one for the dash and one after it.
+func checkIndentWidth(width int) error {
+	if width != 0 && (width < defaultIndentWidth || width > maxIndentWidth) {
+		return errors.Errorf("the indentation width %d isn't between %d and %d", width, defaultIndentWidth, maxIndentWidth)
+	}
+	return nil
+}
+
+// indentWidth returns the number of spaces each level of the workflow is indented by
+func (o ConvertOptions) indentWidth() int {
+	if o.IndentWidth == 0 {
+		return defaultIndentWidth
+	}
+	return o.IndentWidth
+}
+
+// yamlNode is a line of a workflow along with the lines nested under it. The workflow is built with the default
+// width, then parsed into a tree of nodes and written with the width of the options, so that every line is indented
+// by it, including those of text rendered elsewhere, like the env values and pod specs marshalled into YAML.
+type yamlNode struct {
+	// text is the line without its indentation: a comment, a key with or without a value, or a sequence item. It's
+	// empty for a blank line.
+	text string
+	// column is the indentation of the line in the workflow as it is built
+	column int
+	// block holds the lines of the block scalar the line starts, like the script of a run step, without the
+	// indentation of the block. Their indentation relative to each other is kept.
+	block []string
+	// children are the lines nested under the line, indented deeper than it
+	children []*yamlNode
+}
+
+// parseYamlNodes parses the lines of a workflow, built with the default width, into the trees of its top level lines.
+// A blank line is kept as a node of its own after the lines before it.
+func parseYamlNodes(lines []string) []*yamlNode {
+	root := &yamlNode{column: -1}
+	stack := []*yamlNode{root}
+	for i := 0; i < len(lines); i++ {
+		text := strings.TrimLeft(lines[i], " ")
+		if text == "" {
+			top := stack[len(stack)-1]
+			top.children = append(top.children, &yamlNode{column: top.column})
+			continue
+		}
+		node := &yamlNode{text: text, column: len(lines[i]) - len(text)}
+		for stack[len(stack)-1].column >= node.column {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, node)
+		stack = append(stack, node)
+
+		if match := blockScalarRegexp.FindStringSubmatch(text); match != nil && !strings.HasPrefix(text, "#") {
+			i = node.parseBlock(lines, i+1, match[1]) - 1
+		}
+	}
+	return root.children
+}
+
+// parseBlock reads the lines of the block scalar the node starts, from the given line up to the first line that
+// isn't indented deeper than its key, leaving out the blank lines at the end. It returns the line after the block.
+func (n *yamlNode) parseBlock(lines []string, start int, explicit string) int {
+	keyColumn := n.keyColumn()
+	end := start
+	for i := start; i < len(lines); i++ {
+		text := strings.TrimLeft(lines[i], " ")
+		if text == "" {
+			continue
+		}
+		if len(lines[i])-len(text) <= keyColumn {
+			break
+		}
+		end = i + 1
+	}
+
+	base := -1
+	if explicit != "" {
+		indentation, _ := strconv.Atoi(explicit)
+		base = keyColumn + indentation
+	}
+	for _, l := range lines[start:end] {
+		text := strings.TrimLeft(l, " ")
+		column := len(l) - len(text)
+		switch {
+		case text == "":
+			n.block = append(n.block, "")
+		case base < 0:
+			base = column
+			n.block = append(n.block, text)
+		case column < base:
+			n.block = append(n.block, text)
+		default:
+			n.block = append(n.block, l[base:])
+		}
+	}
+	return end
+}
+
+// keyColumn returns the column of the key on the node's line, which is after the dash of a sequence item holding a
+// mapping
+func (n *yamlNode) keyColumn() int {
+	if match := sequenceMappingRegexp.FindStringSubmatch(n.text); match != nil {
+		return n.column + 1 + len(match[1])
+	}
+	return n.column
+}
+
+// writeYamlNodes writes the nodes nested under a line, indented by the given width. Their indentation relative to the
+// line's, as they're built, is scaled from the default width to the given one.
+func writeYamlNodes(nodes []*yamlNode, parentColumn int, newParentColumn int, width int) []string {
+	var lines []string
+	for _, n := range nodes {
+		offset := n.column - parentColumn
+		column := newParentColumn + offset/defaultIndentWidth*width + offset%defaultIndentWidth
+		lines = append(lines, n.lines(column, width)...)
+	}
+	return lines
+}
+
+// lines returns the node's line at the given column and those nested under it, indented by the given width
+func (n *yamlNode) lines(column int, width int) []string {
+	if n.text == "" {
+		return []string{""}
+	}
+	text := n.text
+	blockColumn := column + width
+	if sequenceMappingRegexp.MatchString(text) {
+		// The keys of a sequence item line up after the dash, and the content of a block scalar is one level deeper
+		text = "-" + strings.Repeat(" ", width-1) + strings.TrimLeft(text[1:], " ")
+		blockColumn += width
+	}
+	if match := blockScalarRegexp.FindStringSubmatchIndex(text); match != nil && match[3] > match[2] {
+		// The explicit indentation of a block scalar is one level deeper than its key
+		text = text[:match[2]] + strconv.Itoa(width) + text[match[3]:]
+	}
+	lines := []string{strings.Repeat(" ", column) + text}
+	for _, l := range n.block {
+		if l == "" {
+			lines = append(lines, "")
+		} else {
+			lines = append(lines, strings.Repeat(" ", blockColumn)+l)
+		}
+	}
+	return append(lines, writeYamlNodes(n.children, n.column, column, width)...)
+}
+
+// reindent indents the sections, built with the default width, by the given width, which is also the width the jobs
+// are looked up by for annotations
+func (w *WorkflowSections) reindent(width int) {
+	w.indentWidth = width
+	if width == defaultIndentWidth {
+		return
+	}
+	w.Header = reindentLines(w.Header, width)
+	w.On = reindentLines(w.On, width)
+	w.Jobs = reindentLines(w.Jobs, width)
+}
+
+// reindentLines indents lines, built with the default width, by the given width. Lines may hold several lines of
+// text.
+func reindentLines(lines []string, width int) []string {
+	if len(lines) == 0 {
+		return lines
+	}
+	return writeYamlNodes(parseYamlNodes(strings.Split(strings.Join(lines, "\n"), "\n")), 0, 0, width)
+}
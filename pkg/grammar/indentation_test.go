@@ -0,0 +1,78 @@
+package grammar
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+// TestIndentWidthKeepsTheWorkflow converts each golden Jenkinsfile with other indentation widths, and checks that the
+// workflow reads the same as with the default width, and that every line outside block scalars is indented by a
+// multiple of the width
+func TestIndentWidthKeepsTheWorkflow(t *testing.T) {
+	jenkinsfiles, err := filepath.Glob(filepath.Join("test_data", "*.groovy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, jenkinsfile := range jenkinsfiles {
+		base := strings.TrimSuffix(jenkinsfile, ".groovy")
+		t.Run(filepath.Base(base), func(t *testing.T) {
+			opts := readGoldenOptions(t, base+".json")
+			if opts.Split || opts.IndentWidth != 0 {
+				return
+			}
+			data, err := ioutil.ReadFile(jenkinsfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			model, err := ParseText(string(data))
+			if err != nil {
+				return
+			}
+			expected, _, err := model.ToYamlWithOptions(opts.ConvertOptions)
+			if err != nil {
+				return
+			}
+			var expectedDoc interface{}
+			if err := yaml.Unmarshal([]byte(expected), &expectedDoc); err != nil {
+				t.Fatalf("reading the workflow: %v", err)
+			}
+			for _, width := range []int{3, 4, 8} {
+				opts.IndentWidth = width
+				actual, _, err := model.ToYamlWithOptions(opts.ConvertOptions)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var actualDoc interface{}
+				if err := yaml.Unmarshal([]byte(actual), &actualDoc); err != nil {
+					t.Fatalf("reading the workflow indented by %d: %v\n%s", width, err, actual)
+				}
+				if !reflect.DeepEqual(expectedDoc, actualDoc) {
+					t.Errorf("the workflow indented by %d reads differently:\n%s", width, actual)
+				}
+				checkIndentation(t, actual, width)
+			}
+		})
+	}
+}
+
+// checkIndentation checks that the lines of a workflow outside block scalars are indented by a multiple of the width,
+// or line up after the dash of a sequence item
+func checkIndentation(t *testing.T, workflow string, width int) {
+	for _, n := range parseYamlNodes(strings.Split(workflow, "\n")) {
+		checkNodeIndentation(t, n, width)
+	}
+}
+
+func checkNodeIndentation(t *testing.T, n *yamlNode, width int) {
+	if n.text != "" && n.column%width != 0 {
+		t.Errorf("the line '%s' is indented by %d spaces, which isn't a multiple of %d", n.text, n.column, width)
+	}
+	for _, child := range n.children {
+		checkNodeIndentation(t, child, width)
+	}
+}
@@ -0,0 +1,185 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/participle"
+)
+
+// ModelInput represents the body of a stage's input directive
+type ModelInput struct {
+	Entries []*ModelInputEntry `parser:"{ @@ }" json:"entries,omitempty"`
+}
+
+// ModelInputEntry represents an entry of the input directive, like `message 'Deploy?'` or the parameters block
+type ModelInputEntry struct {
+	Parameters []*ModelParameter `parser:"  \"parameters\" \"{\" { @@ } \"}\"" json:"parameters,omitempty"`
+	Key        string            `parser:"| @Ident" json:"key,omitempty"`
+	Value      string            `parser:"  @(String|Char|RawString)" json:"value,omitempty"`
+}
+
+// approvalInput is what the pipeline waits for a person to approve, from the input directive of a stage or the
+// input step
+type approvalInput struct {
+	Message            string
+	Ok                 string
+	Submitter          string
+	SubmitterParameter string
+	Parameters         []*ModelParameter
+}
+
+// getInput returns the input the stage waits for before it runs, if it has an input directive that can be read
+func (m *ModelStage) getInput() *approvalInput {
+	for _, u := range m.getUnsupported() {
+		if u.Name != "input" {
+			continue
+		}
+		parser, err := participle.Build(&ModelInput{})
+		if err != nil {
+			return nil
+		}
+		model := &ModelInput{}
+		if err := parser.ParseString(escapeSingleQuotedOrMultilineStrings(unescapeMultiline(u.Value)), model); err != nil {
+			return nil
+		}
+		input := &approvalInput{}
+		for _, e := range model.Entries {
+			value := unescapeArg(e.Value)
+			switch e.Key {
+			case "message":
+				input.Message = value
+			case "ok":
+				input.Ok = value
+			case "submitter":
+				input.Submitter = value
+			case "submitterParameter":
+				input.SubmitterParameter = value
+			}
+			input.Parameters = append(input.Parameters, e.Parameters...)
+		}
+		return input
+	}
+	return nil
+}
+
+// inputFromStep reads the input the input step waits for, like `input message: 'Deploy?', parameters: [...]`
+func inputFromStep(step *ModelStep) *approvalInput {
+	input := &approvalInput{
+		Message:            unescapeArg(step.getNamedArg("message")),
+		Ok:                 unescapeArg(step.getNamedArg("ok")),
+		Submitter:          unescapeArg(step.getNamedArg("submitter")),
+		SubmitterParameter: unescapeArg(step.getNamedArg("submitterParameter")),
+	}
+	if input.Message == "" && len(step.Args) == 1 && step.Args[0].Unnamed != nil {
+		input.Message = unescapeArg(step.getArg())
+	}
+	for _, a := range step.Args {
+		if a.Named == nil || a.Named.Key != "parameters" || a.Named.Value == nil {
+			continue
+		}
+		for _, item := range a.Named.Value.List {
+			if item.Call == nil {
+				continue
+			}
+			parameter := &ModelParameter{Type: item.Call.Name}
+			for _, arg := range item.Call.Args {
+				parameter.Args = append(parameter.Args, &ModelCallArg{Arg: arg})
+			}
+			input.Parameters = append(input.Parameters, parameter)
+		}
+	}
+	return input
+}
+
+// describe gives the name, type and default of a parameter in a line of text
+func (m *ModelParameter) describe() string {
+	details := []string{m.Type}
+	if choices := m.getChoices(); len(choices) > 0 {
+		details = append(details, "one of "+strings.Join(choices, ", "))
+	}
+	if v := m.getNamedValue("defaultValue"); v != nil {
+		switch {
+		case v.String != nil:
+			details = append(details, fmt.Sprintf("default '%s'", unescapeArg(*v.String)))
+		case v.Bool != nil:
+			details = append(details, fmt.Sprintf("default %t", *v.Bool))
+		case v.Int != nil, v.Number != nil:
+			details = append(details, "default "+v.ToString())
+		}
+	}
+	description := fmt.Sprintf("%s (%s)", m.getNamedString("name"), strings.Join(details, ", "))
+	if d := m.getNamedString("description"); d != "" {
+		description += ": " + d
+	}
+	return description
+}
+
+// commentsForInput describes what the pipeline waits for a person to approve, since a job can't be paused for
+// input on GitHub Actions. Required reviewers of an environment can approve a job before it runs, but can't supply
+// any values.
+func commentsForInput(input *approvalInput, indent int) []string {
+	var lines []string
+	lines = append(lines, indentLine(fmt.Sprintf("# The Jenkinsfile waits for input here: '%s'", input.Message), indent))
+	approval := "# It is approved"
+	if input.Ok != "" {
+		approval += fmt.Sprintf(" with '%s'", input.Ok)
+	}
+	if input.Submitter != "" {
+		approval += fmt.Sprintf(" by one of %s", input.Submitter)
+	}
+	if input.Ok != "" || input.Submitter != "" {
+		lines = append(lines, indentLine(approval+".", indent))
+	}
+	if input.SubmitterParameter != "" {
+		lines = append(lines, indentLine(fmt.Sprintf("# The name of the approver is stored in %s, which github.actor can stand in for.", input.SubmitterParameter), indent))
+	}
+	lines = append(lines, indentLine("# GitHub Actions can't pause a job for input. Use an environment with required reviewers to approve the job instead.", indent))
+	if len(input.Parameters) > 0 {
+		lines = append(lines, indentLine("# Reviewers can't supply values when approving, so the input's parameters need another source, like workflow_dispatch inputs:", indent))
+		for _, p := range input.Parameters {
+			lines = append(lines, indentLine("#   "+p.describe(), indent))
+		}
+	}
+	return lines
+}
+
+// getStepTimeoutMinutes returns the minutes of a timeout step like `timeout(time: 1, unit: 'DAYS') { ... }`, read the
+// same way as the timeout option, or of one like `timeout(5)`, which is in minutes
+func getStepTimeoutMinutes(step *ModelStep) (int64, bool) {
+	if len(step.Args) == 1 && step.Args[0].Unnamed != nil && step.Args[0].Unnamed.Int != nil {
+		return *step.Args[0].Unnamed.Int, true
+	}
+	option := &ModelOption{Name: step.Name}
+	for _, a := range step.Args {
+		option.Args = append(option.Args, &ModelCallArg{Arg: a})
+	}
+	return option.getTimeoutMinutes()
+}
+
+// isInputTimeout checks if a timeout step wraps nothing but an input step, which gives up waiting for approval once
+// the time is up
+func isInputTimeout(step *ModelStep) bool {
+	return step.Name == "timeout" && len(step.NestedSteps) == 1 && step.NestedSteps[0].Name == "input"
+}
+
+// commentsForTimeout explains how a timeout step is converted. An approval deadline has no equivalent, since jobs
+// waiting for an environment's reviewers only give up after 30 days, so the closest settings are suggested. The
+// timeout of other steps isn't converted.
+func commentsForTimeout(step *ModelStep, indent int) []string {
+	limit := "a time limit"
+	if minutes, ok := getStepTimeoutMinutes(step); ok {
+		limit = fmt.Sprintf("%d minutes", minutes)
+	}
+	if isInputTimeout(step) {
+		return []string{
+			indentLine(fmt.Sprintf("# The Jenkinsfile gives up waiting for the input below after %s. Jobs waiting for the reviewers of an environment", limit), indent),
+			indentLine("# only give up after 30 days, so this isn't converted. A wait timer on the environment delays the job instead, and", indent),
+			indentLine("# a scheduled workflow cancelling runs that wait for too long can stand in for the deadline.", indent),
+		}
+	}
+	return []string{
+		indentLine(fmt.Sprintf("# The Jenkinsfile stops the steps below after %s, using the timeout step. This is not converted, but each", limit), indent),
+		indentLine("# step can be given the time it may take with timeout-minutes.", indent),
+	}
+}
@@ -0,0 +1,123 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// literalDollarPlaceholder replaces the dollar signs of single-quoted strings, which Groovy doesn't interpolate, so
+// they're told apart from the interpolations of double-quoted strings. It still contains a dollar sign, so checks
+// for one keep working.
+const literalDollarPlaceholder = "^^LITERAL$^^"
+
+var (
+	// Matches Groovy interpolations of environment variables, like `${env.BRANCH_NAME}` or `$env.BRANCH_NAME`, which
+	// the shell reads as `${BRANCH_NAME}`
+	envInterpolationRegexp = regexp.MustCompile(`\$\{env\.(\w+)\}|\$env\.(\w+)`)
+	// Matches Groovy interpolations of parameters, like `${params.TARGET}`, which are inputs on GitHub Actions
+	paramsInterpolationRegexp = regexp.MustCompile(`\$\{params\.(\w+)\}|\$params\.(\w+)`)
+	// Matches the Groovy interpolations of a double-quoted string, like `${env.TAG}`, `$BUILD_NUMBER` or
+	// `${TAG.toUpperCase()}`
+	groovyInterpolationRegexp = regexp.MustCompile(`\$(?:\{[^}]*\}|(?:env\.|params\.|currentBuild\.)?\w+)`)
+	// Matches an interpolation of a property, like `${currentBuild.result}`, which the shell can't expand
+	propertyInterpolationRegexp = regexp.MustCompile(`^\$\{\w+(?:\.\w+)+\}$|^\$currentBuild\.\w+$`)
+	// Matches an interpolation of an environment variable, like `${env.TAG}`, which is the same variable as `${TAG}`
+	envVariableInterpolationRegexp = regexp.MustCompile(`^\$\{?env\.(\w+)\}?$`)
+)
+
+// interpolationChange is a Groovy interpolation of a step, and what the conversion turns it into
+type interpolationChange struct {
+	Interpolation string
+	Converted     string
+}
+
+// toShellInterpolations converts the Groovy interpolations in a line of a double-quoted string into what the shell
+// or GitHub Actions evaluate instead, leaving out changes of case. Escaped dollar signs, and those of single-quoted strings, are left as
+// literalDollarPlaceholder, for withLiteralDollars to turn back into plain ones.
+func toShellInterpolations(line string) string {
+	line = strings.ReplaceAll(line, "\\"+literalDollarPlaceholder, literalDollarPlaceholder)
+	line = strings.ReplaceAll(line, "\\$", literalDollarPlaceholder)
+	line = stripInterpolatedCaseMethods(line)
+	line = envInterpolationRegexp.ReplaceAllString(line, "$${$1$2}")
+	return paramsInterpolationRegexp.ReplaceAllString(line, "$${{ inputs.$1$2 }}")
+}
+
+// withLiteralDollars turns the literal dollar signs left by toShellInterpolations back into plain ones
+func withLiteralDollars(lines []string) []string {
+	var withDollars []string
+	for _, l := range lines {
+		withDollars = append(withDollars, strings.ReplaceAll(l, literalDollarPlaceholder, "$"))
+	}
+	return withDollars
+}
+
+// interpolationChanges returns the Groovy interpolations in the lines of a step that the conversion changes, in the
+// order they appear, with what they're converted into. Interpolations of environment variables, which are read from
+// the same variables, aren't changed.
+func interpolationChanges(lines []string, secretParameters []string) []interpolationChange {
+	var shellLines []string
+	for _, l := range lines {
+		shellLines = append(shellLines, toShellInterpolations(l))
+	}
+	script := strings.Join(shellLines, "\n")
+	var changes []interpolationChange
+	seen := map[string]bool{}
+	for _, l := range lines {
+		// Escaped dollar signs, and those of single-quoted strings, aren't interpolations
+		l = strings.ReplaceAll(l, "\\"+literalDollarPlaceholder, "")
+		l = strings.ReplaceAll(l, literalDollarPlaceholder, "")
+		l = strings.ReplaceAll(l, "\\$", "")
+		for _, interpolation := range groovyInterpolationRegexp.FindAllString(l, -1) {
+			if seen[interpolation] {
+				continue
+			}
+			seen[interpolation] = true
+			converted := withGitHubBuiltinVariable(toShellInterpolations(interpolation), script)
+			converted = withSecretParameters([]string{converted}, secretParameters)[0]
+			if converted == interpolation && !propertyInterpolationRegexp.MatchString(converted) {
+				continue
+			}
+			if groups := envVariableInterpolationRegexp.FindStringSubmatch(interpolation); groups != nil && converted == "${"+groups[1]+"}" {
+				continue
+			}
+			changes = append(changes, interpolationChange{Interpolation: interpolation, Converted: converted})
+		}
+	}
+	return changes
+}
+
+// commentsForInterpolations describes how the conversion changes the Groovy interpolations of a step. Changes of case
+// that are left out and properties the shell can't expand are warned about, and recorded as conversion issues.
+// Interpolations read from GitHub Actions instead, like `${env.BUILD_NUMBER}` or `${params.TARGET}`, are noted.
+func commentsForInterpolations(changes []interpolationChange, stepName string, indent int, settings conversionSettings) ([]string, bool) {
+	var comments []string
+	var rewritten []string
+	issues := false
+	for _, c := range changes {
+		switch {
+		case interpolatedCaseMethodRegexp.MatchString(c.Interpolation):
+			issues = true
+			settings.addIssue("the change of case of %s in the step %s", c.Interpolation, stepName)
+			comments = append(comments, indentLine(fmt.Sprintf("# WARNING: The %s step changes the case of %s, which is left out, giving %s. Please change the case with shell commands instead.", stepName, c.Interpolation, c.Converted), indent))
+		case propertyInterpolationRegexp.MatchString(c.Converted):
+			issues = true
+			settings.addIssue("the interpolation %s in the step %s", c.Interpolation, stepName)
+			instead := "set the value in an environment variable instead"
+			if buildResultReferenceRegexp.MatchString(c.Converted) {
+				instead = "use the 'job.status' context or the success() and failure() status functions instead"
+			}
+			comments = append(comments, indentLine(fmt.Sprintf("# WARNING: The %s step interpolates %s, which the shell can't expand. Please %s.", stepName, c.Interpolation, instead), indent))
+		case !strings.Contains(c.Converted, "("):
+			rewritten = append(rewritten, fmt.Sprintf("%s as %s", c.Interpolation, c.Converted))
+		}
+	}
+	if len(rewritten) > 0 {
+		read := rewritten[len(rewritten)-1]
+		if len(rewritten) > 1 {
+			read = strings.Join(rewritten[:len(rewritten)-1], ", ") + " and " + read
+		}
+		comments = append(comments, indentLine(fmt.Sprintf("# The %s step reads %s on GitHub Actions.", stepName, read), indent))
+	}
+	return comments, issues
+}
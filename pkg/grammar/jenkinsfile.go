@@ -0,0 +1,94 @@
+package grammar
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The names Jenkinsfiles commonly have, in the order they are looked for. They are matched in any case, like
+// jenkinsfile.
+var jenkinsfileNames = []string{
+	"Jenkinsfile",
+	"Jenkinsfile.ci",
+	"Jenkinsfile.groovy",
+}
+
+// FindJenkinsfile returns the path of the Jenkinsfile in a directory. The name may be a file name or a glob pattern
+// relative to the directory, like ci/Jenkinsfile.*, which has to match a single file. Without a name, the common
+// names of Jenkinsfiles are looked for. Either way, names are matched in any case if nothing matches exactly.
+func FindJenkinsfile(dir string, name string) (string, error) {
+	if name != "" {
+		return findJenkinsfileMatching(dir, name)
+	}
+	for _, n := range jenkinsfileNames {
+		matches, err := filesMatching(dir, n)
+		if err != nil {
+			return "", err
+		}
+		if len(matches) > 0 {
+			return matches[0], nil
+		}
+	}
+	return "", errors.Errorf("No Jenkinsfile found in %s. Looked for %s, in any case.", dir, strings.Join(jenkinsfileNames, ", "))
+}
+
+// findJenkinsfileMatching returns the only file in the directory the name or pattern matches
+func findJenkinsfileMatching(dir string, pattern string) (string, error) {
+	matches, err := filesMatching(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 0:
+		return "", errors.Errorf("No Jenkinsfile found in %s. Looked for %s, in any case.", dir, pattern)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", errors.Errorf("%s matches several files in %s, so which is the Jenkinsfile is unclear: %s", pattern, dir, strings.Join(matches, ", "))
+	}
+}
+
+// filesMatching returns the files the pattern matches in the directory, or else those it matches in any case
+func filesMatching(dir string, pattern string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s isn't a valid file name or pattern", pattern)
+	}
+	if files := regularFiles(matches); len(files) > 0 {
+		return files, nil
+	}
+
+	// Only the file name is matched in any case, in the folder the pattern names
+	folder, base := filepath.Split(filepath.Join(dir, pattern))
+	entries, err := os.ReadDir(folder)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error listing %s", folder)
+	}
+	base = strings.ToLower(base)
+	var caseless []string
+	for _, e := range entries {
+		if ok, _ := filepath.Match(base, strings.ToLower(e.Name())); ok {
+			caseless = append(caseless, filepath.Join(folder, e.Name()))
+		}
+	}
+	return regularFiles(caseless), nil
+}
+
+// regularFiles returns the paths that are files rather than folders, sorted
+func regularFiles(paths []string) []string {
+	var files []string
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,61 @@
+package grammar
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const minimalJenkinsfile = `pipeline {
+    agent any
+    stages {
+        stage('%s') {
+            steps {
+                sh 'make'
+            }
+        }
+    }
+}
+`
+
+// writeJenkinsfile writes a Jenkinsfile with a single stage of the given name
+func writeJenkinsfile(t *testing.T, dir string, name string, stage string) {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf(minimalJenkinsfile, stage)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseJenkinsfileInDirectoryFindsCommonNames(t *testing.T) {
+	for _, name := range []string{"jenkinsfile", "Jenkinsfile.ci", "Jenkinsfile.groovy"} {
+		dir := t.TempDir()
+		writeJenkinsfile(t, dir, name, "Build")
+
+		model, err := ParseJenkinsfileInDirectory(dir)
+		if err != nil {
+			t.Fatalf("with only %s: %v", name, err)
+		}
+		if stages := model.getStages(); len(stages) != 1 || stages[0].Name != "Build" {
+			t.Errorf("with only %s: parsed the wrong Jenkinsfile, with %d stages", name, len(stages))
+		}
+	}
+}
+
+func TestParseJenkinsfileInDirectoryNamed(t *testing.T) {
+	dir := t.TempDir()
+	writeJenkinsfile(t, dir, "Jenkinsfile", "Build")
+	writeJenkinsfile(t, dir, "Jenkinsfile.release", "Release")
+
+	model, err := ParseJenkinsfileInDirectoryNamed(dir, "Jenkinsfile.rel*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stages := model.getStages(); len(stages) != 1 || stages[0].Name != "Release" {
+		t.Errorf("parsed the wrong Jenkinsfile, with %d stages", len(stages))
+	}
+
+	if _, err := ParseJenkinsfileInDirectoryNamed(dir, "Jenkinsfile*"); err == nil {
+		t.Error("a pattern matching several files should fail")
+	}
+}
@@ -0,0 +1,193 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/participle"
+)
+
+// ModelScriptAssignment represents a script block setting an environment variable from the output of a shell command
+// or the content of a file, like `env.VERSION = sh(script: 'cat VERSION', returnStdout: true).trim()`
+type ModelScriptAssignment struct {
+	Key      string                   `parser:"\"env\" \".\" @Ident \"=\"" json:"key,omitempty"`
+	Command  *ModelEnvironmentCommand `parser:"( @@" json:"command,omitempty"`
+	ReadFile *ModelReadFile           `parser:"| @@ ) \";\"?" json:"readFile,omitempty"`
+}
+
+// ModelReadFile represents reading a file of the workspace, like `readFile('VERSION').trim()`
+type ModelReadFile struct {
+	Args    []*ModelStepArg `parser:"\"readFile\" \"(\" ( @@ { \",\" @@ } )? \")\"" json:"args,omitempty"`
+	Methods []string        `parser:"{ \".\" @Ident \"(\" \")\" }" json:"methods,omitempty"`
+}
+
+// modelScriptAssignments represents the text of a script block that does nothing but set environment variables
+type modelScriptAssignments struct {
+	Assignments []*ModelScriptAssignment `parser:"\"steps\" \"{\" { @@ } \"}\""`
+}
+
+// jobOutput is an environment variable an earlier stage sets in a script block, which the job of a later stage reads
+// from the outputs of the job that set it
+type jobOutput struct {
+	Name  string
+	JobID string
+}
+
+// getScript returns the shell command that prints the value of the file, and false if it can't be read the same way
+// in a run step
+func (m *ModelReadFile) getScript() (string, bool) {
+	path := ""
+	for _, a := range m.Args {
+		switch {
+		case a.Unnamed != nil && a.Unnamed.String != nil:
+			path = *a.Unnamed.String
+		case a.Named != nil && a.Named.Key == "file" && a.Named.Value.String != nil:
+			path = *a.Named.Value.String
+		case a.Named != nil && a.Named.Key == "encoding":
+			// The runner reads files as they are
+		default:
+			return "", false
+		}
+	}
+	for _, method := range m.Methods {
+		if method != "trim" {
+			return "", false
+		}
+	}
+	path = unescapeArg(removeQuotesAndTrim(path))
+	// The path is read in double quotes, where these characters aren't literal
+	if path == "" || strings.ContainsAny(path, "\"$`\\") {
+		return "", false
+	}
+	return fmt.Sprintf(`cat "%s"`, path), true
+}
+
+// getScript returns the shell command whose output is the value of the variable
+func (m *ModelScriptAssignment) getScript() (string, bool) {
+	if m.Command != nil {
+		return m.Command.getScript()
+	}
+	return m.ReadFile.getScript()
+}
+
+// scriptAssignments returns the environment variables a script block sets, if that is all it does and each of them
+// can be computed in a run step
+func scriptAssignments(step *ModelStep) ([]*ModelScriptAssignment, bool) {
+	if step.Name != "script" || len(step.Args) != 1 || step.Args[0].Unnamed == nil {
+		return nil, false
+	}
+	parser, err := participle.Build(&modelScriptAssignments{})
+	if err != nil {
+		return nil, false
+	}
+	assignments := &modelScriptAssignments{}
+	err = parser.ParseString(escapeJenkinsfileText("steps {\n"+unescapeArg(step.getArg())+"\n}", nil, unsupportedStageFields), assignments)
+	if err != nil || len(assignments.Assignments) == 0 {
+		return nil, false
+	}
+	for _, a := range assignments.Assignments {
+		if _, ok := a.getScript(); !ok {
+			return nil, false
+		}
+	}
+	return assignments.Assignments, true
+}
+
+// scriptAssignmentsStepID is the id of the step setting the variables of a script block, named after the first of
+// them
+func scriptAssignmentsStepID(assignments []*ModelScriptAssignment) string {
+	return "env-" + assignments[0].Key
+}
+
+// linesForScriptAssignments computes the environment variables a script block sets. They're written to $GITHUB_ENV,
+// for the following steps of the job, and as outputs of the step, for the jobs of later stages.
+func linesForScriptAssignments(assignments []*ModelScriptAssignment, indent int) []string {
+	var lines []string
+	lines = append(lines, indentLine("# The Jenkinsfile sets these environment variables in a script block. They're available to the following steps,", indent+2))
+	lines = append(lines, indentLine("# and to the jobs of later stages as outputs of this step.", indent+2))
+	lines = append(lines, indentLine(fmt.Sprintf("id: %s", scriptAssignmentsStepID(assignments)), indent+2))
+	lines = append(lines, indentLine("run: |", indent+2))
+	for _, a := range assignments {
+		script, _ := a.getScript()
+		for _, l := range linesForCapturedOutput(a.Key, script, "$GITHUB_ENV", "$GITHUB_OUTPUT") {
+			lines = append(lines, indentLine(l, indent+3))
+		}
+	}
+	return lines
+}
+
+// scriptOutputs returns the ids of the steps setting the environment variables the script blocks of the stage set,
+// by the name of each variable
+func (m *ModelStage) scriptOutputs() map[string]string {
+	outputs := make(map[string]string)
+	for _, step := range m.stepsNamed("script") {
+		if assignments, ok := scriptAssignments(step); ok {
+			for _, a := range assignments {
+				outputs[a.Key] = scriptAssignmentsStepID(assignments)
+			}
+		}
+	}
+	return outputs
+}
+
+// usesVariable checks if the steps of the stage or its post conditions read an environment variable, like
+// `${env.VERSION}` or `$VERSION`
+func (m *ModelStage) usesVariable(name string) bool {
+	variableRegexp := regexp.MustCompile(fmt.Sprintf(`\benv\.%[1]s\b|\$\{%[1]s\}|\$%[1]s\b`, regexp.QuoteMeta(name)))
+	steps := m.getSteps()
+	for _, p := range m.getPost() {
+		steps = append(steps, p.Steps...)
+	}
+	for _, step := range steps {
+		if variableRegexp.MatchString(unescapeArg(step.toOriginalGroovy())) {
+			return true
+		}
+	}
+	return false
+}
+
+// linesForJobOutputs makes the environment variables the stage sets in script blocks outputs of its job, for those
+// the given later stages use
+func linesForJobOutputs(stage *ModelStage, laterStages []*ModelStage, indent int) []string {
+	outputs := stage.scriptOutputs()
+	var names []string
+	for name := range outputs {
+		for _, later := range laterStages {
+			if later.usesVariable(name) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	var lines []string
+	lines = append(lines, indentLine("# Later stages use the environment variables the stage sets in script blocks, so they're outputs of its job.", indent))
+	lines = append(lines, indentLine("outputs:", indent))
+	for _, name := range names {
+		lines = append(lines, indentLine(fmt.Sprintf("%s: ${{ steps.%s.outputs.%s }}", name, outputs[name], name), indent+1))
+	}
+	return lines
+}
+
+// withJobOutputs adds the environment variables the stage takes from the outputs of earlier jobs to the env lines of
+// its job
+func withJobOutputs(envLines []string, outputs []jobOutput, indent int) []string {
+	if len(outputs) == 0 {
+		return envLines
+	}
+	lines := envLines
+	if !containsString(envLines, indentLine("env:", indent)) {
+		lines = append(lines, indentLine("env:", indent))
+	}
+	lines = append(lines, indentLine("# Set in script blocks of earlier stages, and taken from the outputs of their jobs", indent+1))
+	for _, o := range outputs {
+		lines = append(lines, indentLine(fmt.Sprintf("%s: ${{ needs.%s.outputs.%s }}", o.Name, o.JobID, o.Name), indent+1))
+	}
+	return lines
+}
@@ -0,0 +1,113 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// The id of the job standing in for the stages of a pipeline without any that run, which fails on purpose
+const noStagesJobID = "no-stages"
+
+// Matches the characters that aren't allowed in a job id, which is also used as a YAML key
+var invalidJobIDRegexp = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// jobIDs turns stage names into unique job ids
+type jobIDs map[string]bool
+
+// reserve marks an id as used, such as the id of the job running the pipeline's post conditions
+func (ids jobIDs) reserve(id string) {
+	ids[id] = true
+}
+
+// forName turns a stage name into a job id made of letters, digits and underscores. Names that end up the same as
+// an earlier one are disambiguated with a number.
+func (ids jobIDs) forName(name string) string {
+	id := strings.Trim(invalidJobIDRegexp.ReplaceAllString(name, "_"), "_")
+	if id == "" || unicode.IsDigit(rune(id[0])) {
+		id = "stage_" + id
+	}
+	unique := id
+	for i := 2; ids[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", id, i)
+	}
+	ids[unique] = true
+	return unique
+}
+
+// forStep returns an id for a step made of the given id, numbered if an earlier step of the job has it already. Without
+// ids to check, it returns the id as it is.
+func (ids jobIDs) forStep(id string) string {
+	if ids == nil {
+		return id
+	}
+	unique := id
+	for i := 2; ids[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", id, i)
+	}
+	ids[unique] = true
+	return unique
+}
+
+// workflowJob is a job of the converted workflow, with the jobs it needs
+type workflowJob struct {
+	ID    string
+	Needs []string
+}
+
+// validateJobs checks that the jobs of a converted workflow have unique ids, and that the jobs they need exist and
+// don't need each other in a cycle, any of which would make GitHub reject the workflow
+func validateJobs(jobs []workflowJob) error {
+	needs := make(map[string][]string)
+	for _, j := range jobs {
+		if _, ok := needs[j.ID]; ok {
+			return errors.Errorf("the converted workflow has more than one job with the id '%s'", j.ID)
+		}
+		needs[j.ID] = j.Needs
+	}
+	for _, j := range jobs {
+		for _, n := range j.Needs {
+			if _, ok := needs[n]; !ok {
+				return errors.Errorf("the job '%s' of the converted workflow needs the job '%s', which the workflow doesn't have", j.ID, n)
+			}
+		}
+	}
+
+	// A job that is needed again while the jobs it needs are still being visited closes a cycle
+	visiting := make(map[string]bool)
+	visited := make(map[string]bool)
+	var path []string
+	var visit func(id string) error
+	visit = func(id string) error {
+		if visited[id] {
+			return nil
+		}
+		if visiting[id] {
+			for i, p := range path {
+				if p == id {
+					return errors.Errorf("the jobs of the converted workflow need each other in a cycle: %s", strings.Join(append(path[i:], id), " -> "))
+				}
+			}
+		}
+		visiting[id] = true
+		path = append(path, id)
+		for _, n := range needs[id] {
+			if err := visit(n); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		visiting[id] = false
+		visited[id] = true
+		return nil
+	}
+	for _, j := range jobs {
+		if err := visit(j.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
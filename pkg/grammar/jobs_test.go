@@ -0,0 +1,43 @@
+package grammar
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateJobsFindsJobsThatDontFitTogether(t *testing.T) {
+	tests := []struct {
+		name string
+		jobs []workflowJob
+		err  string
+	}{
+		{
+			name: "valid",
+			jobs: []workflowJob{{ID: "Build"}, {ID: "Test", Needs: []string{"Build"}}, {ID: "post", Needs: []string{"Build", "Test"}}},
+		},
+		{
+			name: "duplicate id",
+			jobs: []workflowJob{{ID: "Build"}, {ID: "Build", Needs: []string{"Build"}}},
+			err:  "more than one job with the id 'Build'",
+		},
+		{
+			name: "missing need",
+			jobs: []workflowJob{{ID: "Build"}, {ID: "Test", Needs: []string{"Build_2"}}},
+			err:  "the job 'Test' of the converted workflow needs the job 'Build_2'",
+		},
+		{
+			name: "cycle",
+			jobs: []workflowJob{{ID: "Build", Needs: []string{"Deploy"}}, {ID: "Test", Needs: []string{"Build"}}, {ID: "Deploy", Needs: []string{"Test"}}},
+			err:  "cycle: Build -> Deploy -> Test -> Build",
+		},
+	}
+	for _, tt := range tests {
+		err := validateJobs(tt.jobs)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
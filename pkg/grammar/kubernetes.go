@@ -0,0 +1,140 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Matches the yaml option of a kubernetes agent, up to the quote its value starts with
+var podYamlRegexp = regexp.MustCompile(`(^|\s|\^\^NEWLINE\^\^)yaml\s*\(?\s*(['"])`)
+
+// podContainer is a container of the pod a kubernetes agent runs in
+type podContainer struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+// podSpec is the part of a pod spec the conversion reads
+type podSpec struct {
+	Spec struct {
+		Containers []podContainer `json:"containers"`
+	} `json:"spec"`
+}
+
+// getPodYaml returns the pod spec given inline by the yaml option of a kubernetes agent, if any
+func (m *ModelAgent) getPodYaml() string {
+	if m == nil || m.Kubernetes == "" {
+		return ""
+	}
+	loc := podYamlRegexp.FindStringSubmatchIndex(m.Kubernetes)
+	if loc == nil {
+		return ""
+	}
+	rest := m.Kubernetes[loc[1]:]
+	quote := m.Kubernetes[loc[4]:loc[5]]
+	for _, placeholder := range []string{multilineSingleQuotePlaceholder, multilineDoubleQuotePlaceholder} {
+		if strings.HasPrefix(rest, placeholder) {
+			rest = strings.TrimPrefix(rest, placeholder)
+			quote = placeholder
+			break
+		}
+	}
+	end := strings.Index(rest, quote)
+	if end == -1 {
+		return ""
+	}
+	return unescapeArg(rest[:end])
+}
+
+// getPodContainers returns the containers of the pod spec of a kubernetes agent, on a best-effort basis. Pod specs
+// that can't be read, or are given in a file or as pod templates, have no containers.
+func (m *ModelAgent) getPodContainers() []podContainer {
+	podYaml := m.getPodYaml()
+	if podYaml == "" {
+		return nil
+	}
+	var pod podSpec
+	if err := yaml.Unmarshal([]byte(podYaml), &pod); err != nil {
+		return nil
+	}
+	var containers []podContainer
+	for _, c := range pod.Spec.Containers {
+		if c.Image != "" {
+			containers = append(containers, c)
+		}
+	}
+	return containers
+}
+
+// getPodContainers returns the containers of the kubernetes agent the stage runs on, which is the stage's own agent if
+// it has one, or else the pipeline's
+func (m *ModelStage) getPodContainers(pipelineAgent *ModelAgent) []podContainer {
+	if agent := m.getAgent(); agent != nil {
+		return agent.getPodContainers()
+	}
+	return pipelineAgent.getPodContainers()
+}
+
+// podImage returns the image of the pod container with the given name. Without a kubernetes agent, the name is taken
+// as the image, as it is if the pod has no container with that name.
+func (s conversionSettings) podImage(name string) (string, bool) {
+	if len(s.podContainers) == 0 {
+		return name, true
+	}
+	for _, c := range s.podContainers {
+		if c.Name == name {
+			return c.Image, true
+		}
+	}
+	return name, false
+}
+
+// isPodImage checks if the image is that of a container in the pod spec of the kubernetes agent
+func (s conversionSettings) isPodImage(image string) bool {
+	for _, c := range s.podContainers {
+		if c.Image == image {
+			return true
+		}
+	}
+	return false
+}
+
+// linesForPodContainer runs the job in the image of the pod container its steps run in on the kubernetes agent
+func linesForPodContainer(image string, indent int, settings conversionSettings) []string {
+	var lines []string
+	if settings.isPodImage(image) {
+		lines = append(lines, indentLine("# The job runs in the image of the container its steps use in the pod spec of the Jenkins kubernetes agent.", indent))
+	} else {
+		lines = append(lines, indentLine("# The container the steps use isn't in the pod spec of the Jenkins kubernetes agent, so the job runs in the image named after it.", indent))
+	}
+	lines = append(lines, indentLine("# The rest of the pod spec isn't converted. Please check it in the agent block of the original Jenkinsfile.", indent))
+	lines = append(lines, indentLine(fmt.Sprintf("container: %s", toYamlScalar(image)), indent))
+	return lines
+}
+
+// linesForUnknownPodContainer warns that a container step names a container the pod spec doesn't have
+func linesForUnknownPodContainer(name string, indent int, settings conversionSettings) []string {
+	settings.addIssue("the container '%s', which isn't in the pod spec of the kubernetes agent", name)
+	return []string{indentLine(fmt.Sprintf("# WARNING: The container '%s' isn't in the pod spec of the Jenkins kubernetes agent, so its name is used as the image.", name), indent+1)}
+}
+
+// linesForStepContainer explains that a step runs in a container other than the job's, which a single step can't do
+// on GitHub Actions
+func linesForStepContainer(name string, indent int, settings conversionSettings) ([]string, bool) {
+	image, ok := settings.podImage(name)
+	var lines []string
+	if !ok {
+		settings.addIssue("the container '%s', which isn't in the pod spec of the kubernetes agent", name)
+		lines = append(lines, indentLine(fmt.Sprintf("# WARNING: The container '%s' isn't in the pod spec of the Jenkins kubernetes agent, so its image is unknown.", name), indent+2))
+	}
+	container := fmt.Sprintf("the container '%s'", name)
+	if image != name {
+		container += fmt.Sprintf(", with the image '%s'", image)
+	}
+	lines = append(lines, indentLine(fmt.Sprintf("# The Jenkinsfile runs this step in %s. Steps run in the job's container on GitHub Actions,", container), indent+2))
+	lines = append(lines, indentLine("# so please check the step works there, or move it to a job of its own.", indent+2))
+	return lines, !ok
+}
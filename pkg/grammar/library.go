@@ -0,0 +1,150 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The steps of Jenkins and its common plugins. Any other step is taken to be a step of a shared library, whose
+// behavior is unknown.
+var jenkinsSteps = []string{
+	"addBadge",
+	"ansiColor",
+	"archiveArtifacts",
+	"bat",
+	"bitbucketStatusNotify",
+	"build",
+	"catchError",
+	"checkout",
+	"cleanWs",
+	"container",
+	"containerLog",
+	"copyArtifacts",
+	"deleteDir",
+	"dir",
+	"echo",
+	"emailext",
+	"error",
+	"fileExists",
+	"findFiles",
+	"fingerprint",
+	"git",
+	"githubNotify",
+	"gitlabCommitStatus",
+	"hipchatSend",
+	"httpRequest",
+	"input",
+	"isUnix",
+	"jacoco",
+	"junit",
+	"library",
+	"load",
+	"lock",
+	"mail",
+	"milestone",
+	"nexusArtifactUploader",
+	"node",
+	"nodejs",
+	"office365ConnectorSend",
+	"parallel",
+	"podTemplate",
+	"powershell",
+	"properties",
+	"publishChecks",
+	"publishCoverage",
+	"publishHTML",
+	"pwd",
+	"pwsh",
+	"readCSV",
+	"readFile",
+	"readJSON",
+	"readMavenPom",
+	"readProperties",
+	"readYaml",
+	"recordCoverage",
+	"recordIssues",
+	"retry",
+	"rtUpload",
+	"s3Download",
+	"s3Upload",
+	"script",
+	"sh",
+	"sha1",
+	"sha256",
+	"slackSend",
+	"sleep",
+	"sshPublisher",
+	"sshagent",
+	"stash",
+	"step",
+	"tee",
+	"timeout",
+	"timestamps",
+	"tool",
+	"touch",
+	"unstable",
+	"unstash",
+	"unzip",
+	"updateGitlabCommitStatus",
+	"waitForQualityGate",
+	"waitUntil",
+	"warnError",
+	"withAWS",
+	"withAnt",
+	"withCredentials",
+	"withDockerContainer",
+	"withDockerRegistry",
+	"withEnv",
+	"withGradle",
+	"withKubeConfig",
+	"withMaven",
+	"withSonarQubeEnv",
+	"wrap",
+	"writeCSV",
+	"writeFile",
+	"writeJSON",
+	"writeYaml",
+	"ws",
+	"xunit",
+	"zip",
+}
+
+// isLibraryStep checks if the step isn't one of Jenkins or its common plugins, so it is probably defined by a shared
+// library
+func isLibraryStep(step *ModelStep) bool {
+	return !containsString(jenkinsSteps, step.Name)
+}
+
+// addLibraryStep records a step of a shared library, so that they can all be listed together
+func (s conversionSettings) addLibraryStep(name string) {
+	if s.librarySteps == nil {
+		return
+	}
+	*s.librarySteps = appendIfMissing(*s.librarySteps, name)
+}
+
+// linesForLibraryStep leaves a step for a shared library step to be replaced by hand, since what it does is unknown.
+// Unlike invalid steps, it doesn't fail the job.
+func linesForLibraryStep(step *ModelStep, indent int) []string {
+	var stepLines []string
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("# TODO: %s isn't a Jenkins step, so it is probably a step of a shared library. What it does is unknown,", step.Name), indent+2))
+	stepLines = append(stepLines, indentLine("# so please replace this step with the same behavior.", indent+2))
+	stepLines = append(stepLines, indentLine("# Original step from Jenkinsfile:", indent+2))
+	for _, l := range strings.Split(step.toOriginalGroovy(), "\n") {
+		stepLines = append(stepLines, indentLine("# "+l, indent+2))
+	}
+	stepLines = append(stepLines, indentLine("run: |", indent+2))
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("echo 'TODO: shared library step %s'", step.Name), indent+3))
+	return stepLines
+}
+
+// commentsForLibrarySteps lists the shared library steps of the whole pipeline in one place
+func commentsForLibrarySteps(names []string, indent int) []string {
+	if len(names) == 0 {
+		return nil
+	}
+	var lines []string
+	lines = append(lines, indentLine(fmt.Sprintf("# The Jenkinsfile calls these steps, which are probably steps of a shared library: %s", strings.Join(names, ", ")), indent))
+	lines = append(lines, indentLine("# They are left as TODO steps, to be replaced with what they do.", indent))
+	return lines
+}
@@ -0,0 +1,48 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// getLockResources returns the resources locked by the lock steps of the stage, in order
+func (m *ModelStage) getLockResources() []string {
+	var resources []string
+	for _, step := range m.getSteps() {
+		resources = appendLockResources(resources, step)
+	}
+	return resources
+}
+
+func appendLockResources(resources []string, step *ModelStep) []string {
+	if step.Name == "lock" {
+		resource := step.getNamedArg("resource")
+		if resource == "" {
+			resource = step.getNamedArg("label")
+		}
+		if resource == "" && len(step.Args) > 0 && step.Args[0].Unnamed != nil {
+			resource = removeQuotesAndTrim(step.Args[0].ToString())
+		}
+		if resource != "" {
+			resources = appendIfMissing(resources, resource)
+		}
+	}
+	for _, s := range step.NestedSteps {
+		resources = appendLockResources(resources, s)
+	}
+	return resources
+}
+
+// linesForLocks turns the resources locked in a stage into a concurrency group of its job, so that runs of the job
+// wait for each other like builds waiting for the lock
+func linesForLocks(resources []string, indent int) []string {
+	if len(resources) == 0 {
+		return nil
+	}
+	var lines []string
+	lines = append(lines, indentLine(fmt.Sprintf("# The Jenkinsfile locks %s, so the job runs in a concurrency group instead. The whole job waits, not only the locked steps.", strings.Join(resources, ", ")), indent))
+	lines = append(lines, indentLine("# Unlike Jenkins, which queues every build for the lock, a pending job is cancelled when a newer one joins the group.", indent))
+	lines = append(lines, indentLine("concurrency:", indent))
+	lines = append(lines, indentLine(fmt.Sprintf("group: %s", toYamlScalar(strings.Join(resources, "-"))), indent+1))
+	return lines
+}
@@ -0,0 +1,132 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// StepMapping describes how to convert a step the converter doesn't know, like a step of an organization's shared
+// library, into a step of GitHub Actions. A step is converted either into an action or into a shell script.
+//
+// The inputs and the script are templates, in which `{{arg}}` stands for the only unnamed argument of the step and
+// `{{name}}` for its named argument name. A mapping file maps step names to their mapping, like
+//
+//	deployApp:
+//	  uses: my-org/deploy-action@v1
+//	  with:
+//	    environment: "{{env}}"
+//	notifyTeam:
+//	  run: ./scripts/notify.sh "{{arg}}"
+type StepMapping struct {
+	// Uses is the action the step is converted into, like my-org/deploy-action@v1
+	Uses string `json:"uses,omitempty"`
+	// With sets the inputs of the action
+	With map[string]string `json:"with,omitempty"`
+	// Run is the shell script the step is converted into, instead of an action
+	Run string `json:"run,omitempty"`
+}
+
+// Matches the placeholders of step arguments in the templates of a step mapping, like `{{arg}}` or `{{ env }}`
+var stepMappingPlaceholderRegexp = regexp.MustCompile(`{{\s*([A-Za-z_][A-Za-z0-9_]*)\s*}}`)
+
+// ParseStepMappings reads the mappings of custom steps from a YAML or JSON mapping file, keyed by step name
+func ParseStepMappings(data []byte) (map[string]StepMapping, error) {
+	mappings := make(map[string]StepMapping)
+	if err := yaml.UnmarshalStrict(data, &mappings); err != nil {
+		return nil, errors.Wrap(err, "the step mappings can't be read")
+	}
+	for name, m := range mappings {
+		if strings.TrimSpace(name) == "" {
+			return nil, errors.New("the step mappings contain a mapping without a step name")
+		}
+		if (m.Uses == "") == (m.Run == "") {
+			return nil, errors.Errorf("the mapping of the step %s needs either uses or run", name)
+		}
+		if m.Run != "" && len(m.With) > 0 {
+			return nil, errors.Errorf("the mapping of the step %s sets inputs with a run script, which only actions have", name)
+		}
+	}
+	return mappings, nil
+}
+
+// stepMapping returns the mapping the options give the step, if any
+func (s conversionSettings) stepMapping(step *ModelStep) (StepMapping, bool) {
+	m, ok := s.StepMappings[step.Name]
+	return m, ok
+}
+
+// stepMappingArg returns the value of the step's argument that a placeholder stands for, and whether the step has it
+func stepMappingArg(step *ModelStep, name string) (string, bool) {
+	if name == "arg" {
+		if len(step.Args) == 1 && step.Args[0].Unnamed != nil {
+			return unescapeArg(step.getArg()), true
+		}
+		return "", false
+	}
+	for _, a := range step.Args {
+		if a.Named != nil && a.Named.Key == name && a.Named.Value != nil {
+			return unescapeArg(step.getNamedArg(name)), true
+		}
+	}
+	return "", false
+}
+
+// expandStepMapping fills in the arguments of the step in a template of its mapping. Placeholders of arguments the
+// step doesn't have are left empty, and returned so that they can be noted.
+func expandStepMapping(template string, step *ModelStep, toValue func(string) string) (string, []string) {
+	var missing []string
+	expanded := stepMappingPlaceholderRegexp.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := stepMappingPlaceholderRegexp.FindStringSubmatch(placeholder)[1]
+		value, ok := stepMappingArg(step, name)
+		if !ok {
+			missing = appendIfMissing(missing, name)
+		}
+		return toValue(value)
+	})
+	return expanded, missing
+}
+
+// linesForMappedStep converts a step as its mapping describes, into an action or a run script
+func linesForMappedStep(step *ModelStep, mapping StepMapping, indent int) []string {
+	var stepLines []string
+	var missing []string
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("# The step %s is converted as the step mappings describe.", step.Name), indent+2))
+	if mapping.Uses != "" {
+		var withLines []string
+		inputs := make([]string, 0, len(mapping.With))
+		for input := range mapping.With {
+			inputs = append(inputs, input)
+		}
+		sort.Strings(inputs)
+		for _, input := range inputs {
+			// Action inputs aren't expanded by a shell, so variables in the arguments are read from the env context
+			value, m := expandStepMapping(mapping.With[input], step, toActionInput)
+			for _, name := range m {
+				missing = appendIfMissing(missing, name)
+			}
+			withLines = append(withLines, indentLine(fmt.Sprintf("%s: %s", input, yamlQuote(value)), indent+3))
+		}
+		stepLines = append(stepLines, indentLine("uses: "+mapping.Uses, indent+2))
+		if len(withLines) > 0 {
+			stepLines = append(stepLines, indentLine("with:", indent+2))
+			stepLines = append(stepLines, withLines...)
+		}
+	} else {
+		script, m := expandStepMapping(mapping.Run, step, func(value string) string { return value })
+		missing = append(missing, m...)
+		stepLines = append(stepLines, indentLine("run: |", indent+2))
+		for _, l := range strings.Split(strings.TrimRight(script, "\n"), "\n") {
+			stepLines = append(stepLines, indentLine(l, indent+3))
+		}
+	}
+	if len(missing) > 0 {
+		comment := indentLine(fmt.Sprintf("# The step has no argument %s, so it is left empty.", strings.Join(missing, ", ")), indent+2)
+		stepLines = append([]string{stepLines[0], comment}, stepLines[1:]...)
+	}
+	return stepLines
+}
@@ -0,0 +1,47 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Matches a scripted node block wrapping the whole Jenkinsfile, like `node('linux') {`, after any leading comments
+	outerNodeRegexp     = regexp.MustCompile(`^(?:\s*//[^\n]*\n)*\s*node\s*(?:\(\s*(?:label\s*:\s*)?['"]([^'"]*)['"]\s*\))?\s*\{`)
+	pipelineStartRegexp = regexp.MustCompile(`^\s*pipeline\s*\{`)
+)
+
+// unwrapNode removes a scripted node block wrapping a declarative pipeline, like `node('linux') { pipeline { ... } }`.
+// The node's label becomes an agent label of the pipeline, which the pipeline's own agent takes precedence over.
+// Anything else is returned as it is.
+func unwrapNode(jf string) string {
+	node := outerNodeRegexp.FindStringSubmatchIndex(jf)
+	if node == nil {
+		return jf
+	}
+	body := jf[node[1]:]
+	closing := closingCurlyIndex(body)
+	if closing == len(body) || strings.TrimSpace(body[closing+1:]) != "" {
+		return jf
+	}
+	body = body[:closing]
+	pipeline := pipelineStartRegexp.FindStringIndex(body)
+	if pipeline == nil {
+		return jf
+	}
+	pipelineBody := body[pipeline[1]:]
+	pipelineClosing := closingCurlyIndex(pipelineBody)
+	if pipelineClosing == len(pipelineBody) || strings.TrimSpace(pipelineBody[pipelineClosing+1:]) != "" {
+		return jf
+	}
+
+	label := ""
+	if node[2] != -1 {
+		label = jf[node[2]:node[3]]
+	}
+	if label == "" {
+		return body
+	}
+	return fmt.Sprintf("%s\n  agent { label '%s' }\n}", body[:pipeline[1]+pipelineClosing], label)
+}
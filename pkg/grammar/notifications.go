@@ -0,0 +1,89 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	notificationSteps = []string{
+		"mail",
+		"emailext",
+	}
+
+	// Named arguments of the mail and emailext steps, in the order they're emitted, with the matching input of the
+	// mail action.
+	mailArgInputs = [][]string{
+		{"to", "to"},
+		{"cc", "cc"},
+		{"bcc", "bcc"},
+		{"from", "from"},
+		{"replyTo", "reply_to"},
+		{"subject", "subject"},
+		{"body", "body"},
+		{"attachmentsPattern", "attachments"},
+	}
+)
+
+func isNotificationStep(step *ModelStep) bool {
+	for _, n := range notificationSteps {
+		if step.Name == n {
+			return true
+		}
+	}
+	return false
+}
+
+// linesForMailStep converts a mail or emailext step into a commented-out step using a mail action, since the SMTP
+// settings it needs aren't part of the Jenkinsfile.
+func linesForMailStep(step *ModelStep, indent int, settings conversionSettings) []string {
+	var withLines []string
+	mapped := make(map[string]bool)
+	isHTML := strings.Contains(step.getNamedArg("mimeType"), "html")
+
+	withLines = append(withLines, "server_address: ${{ secrets.MAIL_SERVER }}")
+	withLines = append(withLines, "server_port: 465")
+	withLines = append(withLines, "username: ${{ secrets.MAIL_USERNAME }}")
+	withLines = append(withLines, "password: ${{ secrets.MAIL_PASSWORD }}")
+	for _, argInput := range mailArgInputs {
+		arg, input := argInput[0], argInput[1]
+		mapped[arg] = true
+		value := unescapeArg(step.getNamedArg(arg))
+		if value == "" {
+			if arg == "from" {
+				// The mail action requires a sender
+				withLines = append(withLines, "from: ${{ secrets.MAIL_USERNAME }}")
+			}
+			continue
+		}
+		if arg == "body" && isHTML {
+			input = "html_body"
+		}
+		if strings.Contains(value, "\n") {
+			withLines = append(withLines, fmt.Sprintf("%s: |", input))
+			for _, l := range strings.Split(value, "\n") {
+				withLines = append(withLines, "  "+l)
+			}
+		} else {
+			withLines = append(withLines, fmt.Sprintf("%s: %s", input, yamlQuote(value)))
+		}
+	}
+	mapped["mimeType"] = true
+
+	var stepLines []string
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("# The Jenkins Pipeline step %s is converted to a commented-out step, since sending mail needs SMTP settings.", step.Name), indent+1))
+	stepLines = append(stepLines, indentLine("# Configure MAIL_SERVER, MAIL_USERNAME and MAIL_PASSWORD as repository secrets, then uncomment the step.", indent+1))
+	for _, a := range step.Args {
+		if a.Named != nil && !mapped[a.Named.Key] {
+			stepLines = append(stepLines, indentLine(fmt.Sprintf("# The argument '%s' has no equivalent in the mail action and is not converted.", a.Named.Key), indent+1))
+		}
+	}
+	stepLines = append(stepLines, indentLine("# - name: Send mail", indent+1))
+	stepLines = append(stepLines, indentLine("#   uses: "+settings.action("dawidd6/action-send-mail"), indent+1))
+	stepLines = append(stepLines, indentLine("#   with:", indent+1))
+	for _, l := range withLines {
+		stepLines = append(stepLines, indentLine("#     "+l, indent+1))
+	}
+
+	return stepLines
+}
@@ -0,0 +1,299 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Options that only change how Jenkins runs or shows a build, which have no effect on a workflow and are ignored
+var ignoredOptions = []string{
+	"timestamps",
+	"ansiColor",
+	"disableResume",
+	"durabilityHint",
+}
+
+// Options that change how Jenkins schedules or keeps builds, which GitHub Actions has no equivalent for, and why they
+// are left out. Unlike other unsupported options, dropping them doesn't change what a run does.
+var droppedOptions = map[string]string{
+	"quietPeriod":          "GitHub Actions starts runs right away. A concurrency group with cancel-in-progress builds only the latest of changes pushed together instead",
+	"throttle":             "GitHub Actions can't limit runs by category. A concurrency group runs one at a time instead",
+	"throttleJobProperty":  "GitHub Actions can't limit runs by category. A concurrency group runs one at a time instead",
+	"buildDiscarder":       "GitHub Actions keeps runs, logs and artifacts for as long as the repository's retention settings say",
+	"newContainerPerStage": "each stage is a job of its own, which always starts in a new container or on a new runner",
+}
+
+// Minutes in each unit of the timeout option
+var timeoutUnitMinutes = map[string]float64{
+	"SECONDS": 1.0 / 60,
+	"MINUTES": 1,
+	"HOURS":   60,
+	"DAYS":    24 * 60,
+}
+
+// getIntArg returns the option's only argument, if it is a whole number such as the 3 of `retry(3)`
+func (m *ModelOption) getIntArg() (int64, bool) {
+	if len(m.Args) != 1 || m.Args[0].Arg == nil || m.Args[0].Arg.Unnamed == nil || m.Args[0].Arg.Unnamed.Int == nil {
+		return 0, false
+	}
+	return *m.Args[0].Arg.Unnamed.Int, true
+}
+
+// getNamedValue returns the value of the option's named argument, if it has one
+func (m *ModelOption) getNamedValue(key string) *Value {
+	for _, a := range m.Args {
+		if a.Arg != nil && a.Arg.Named != nil && a.Arg.Named.Key == key {
+			return a.Arg.Named.Value
+		}
+	}
+	return nil
+}
+
+// getTimeoutMinutes returns the minutes of a timeout option like `timeout(time: 1, unit: 'HOURS')`, rounded up,
+// since jobs time out in whole minutes
+func (m *ModelOption) getTimeoutMinutes() (int64, bool) {
+	if m.Name != "timeout" {
+		return 0, false
+	}
+	timeout := m.getNamedValue("time")
+	if timeout == nil || timeout.Int == nil {
+		return 0, false
+	}
+	unit := "MINUTES"
+	if v := m.getNamedValue("unit"); v != nil && v.String != nil {
+		unit = strings.ToUpper(unescapeArg(*v.String))
+	}
+	minutes, ok := timeoutUnitMinutes[unit]
+	if !ok {
+		return 0, false
+	}
+	total := float64(*timeout.Int) * minutes
+	rounded := int64(total)
+	if float64(rounded) < total {
+		rounded++
+	}
+	return rounded, true
+}
+
+// isActivityTimeout checks if the timeout option only times out after no log output for its duration, like
+// `timeout(time: 10, unit: 'MINUTES', activity: true)`
+func (m *ModelOption) isActivityTimeout() bool {
+	v := m.getNamedValue("activity")
+	return m.Name == "timeout" && v != nil && v.Bool != nil && bool(*v.Bool)
+}
+
+// getTimeoutMinutes returns the minutes of the pipeline's timeout option, if it has one that can be converted
+func (m *Model) getTimeoutMinutes() (int64, bool) {
+	for _, o := range m.getOptions() {
+		if minutes, ok := o.getTimeoutMinutes(); ok {
+			return minutes, true
+		}
+	}
+	return 0, false
+}
+
+// linesForOption returns the comments explaining how a pipeline option is converted, if at all, and whether the
+// option's behavior is lost in the conversion.
+func linesForOption(option *ModelOption, indent int, settings conversionSettings) ([]string, bool) {
+	switch option.Name {
+	case "skipDefaultCheckout":
+		// Handled when emitting the checkout step of each job
+		return nil, false
+	case "timeout":
+		if minutes, ok := option.getTimeoutMinutes(); ok {
+			// Handled when emitting each job, which times out on its own
+			lines := []string{
+				indentLine(fmt.Sprintf("# The Jenkinsfile times out the whole pipeline after %d minutes. Each job times out after that long instead.", minutes), indent),
+			}
+			if !option.isActivityTimeout() {
+				return lines, false
+			}
+			// GitHub Actions only times out jobs that run too long, so a job that keeps logging can now time out
+			return append(lines,
+				indentLine(fmt.Sprintf("# WARNING: Jenkins only times out after %d minutes without log output, because of activity: true. GitHub Actions can't reset", minutes), indent),
+				indentLine("# the timeout on log output, so each job times out after that long in total. Raise timeout-minutes if jobs run longer.", indent),
+			), true
+		}
+		return []string{
+			indentLine("# The Jenkinsfile contains a timeout option whose duration can't be read. Set timeout-minutes on the jobs instead.", indent),
+		}, true
+	case "preserveStashes":
+		// Handled when emitting the upload of each stash
+		return linesForPreserveStashes(indent, settings), false
+	case "timestamps":
+		return []string{
+			indentLine("# The timestamps option isn't needed, since GitHub Actions timestamps every log line.", indent),
+		}, false
+	case "retry":
+		// Unlike the retry step, which wraps steps of a stage, the option retries the whole pipeline
+		times := "several"
+		if count, ok := option.getIntArg(); ok {
+			times = fmt.Sprint(count)
+		}
+		return []string{
+			indentLine(fmt.Sprintf("# The Jenkinsfile retries the whole pipeline up to %s times, using the retry option. GitHub Actions can't retry a run by itself.", times), indent),
+			indentLine("# Re-run the failed jobs from the Actions tab, or wrap flaky commands in a retry loop such as 'for i in 1 2 3; do <command> && break; done'.", indent),
+		}, true
+	case "quietPeriod":
+		delay := "a while"
+		if seconds, ok := option.getIntArg(); ok {
+			delay = fmt.Sprintf("%d seconds", seconds)
+		}
+		return []string{
+			indentLine(fmt.Sprintf("# The option quietPeriod is left out. Jenkins waits %s before starting a build, so that changes pushed together are built once.", delay), indent),
+			indentLine(fmt.Sprintf("# %s.", droppedOptions[option.Name]), indent),
+		}, false
+	case "throttle", "throttleJobProperty":
+		limit := "how many builds run at once"
+		if v := option.getNamedValue("maxConcurrentTotal"); v != nil && v.Int != nil && *v.Int > 0 {
+			limit = fmt.Sprintf("builds to %d at once", *v.Int)
+		}
+		return []string{
+			indentLine(fmt.Sprintf("# The option %s is left out. Jenkins limits %s, across the jobs of its categories.", option.Name, limit), indent),
+			indentLine(fmt.Sprintf("# %s.", droppedOptions[option.Name]), indent),
+		}, false
+	default:
+		if isSupportedField(option.Name, ignoredOptions, false) {
+			return nil, false
+		}
+		if reason, ok := droppedOptions[option.Name]; ok {
+			return []string{
+				indentLine(fmt.Sprintf("# The option %s is left out: %s.", option.Name, reason), indent),
+			}, false
+		}
+		return []string{
+			indentLine(fmt.Sprintf("# The Jenkinsfile contains the option %s for its pipeline. This is not converted.", option.Name), indent),
+		}, true
+	}
+}
+
+// getRetryCount returns how many times a retry option like `retry(3)` or `retry(count: 3)` runs what it retries
+func (m *ModelOption) getRetryCount() (int64, bool) {
+	if m.Name != "retry" {
+		return 0, false
+	}
+	if count, ok := m.getIntArg(); ok {
+		return count, true
+	}
+	if v := m.getNamedValue("count"); v != nil && v.Int != nil {
+		return *v.Int, true
+	}
+	return 0, false
+}
+
+// hasOption checks if the stage sets the given option
+func (m *ModelStage) hasOption(name string) bool {
+	for _, o := range m.getOptions() {
+		if o.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getTimeoutMinutes returns the minutes the job of the stage times out after. Jenkins times the stage out after its
+// own timeout option or the pipeline's, whichever is shorter.
+func (m *ModelStage) getTimeoutMinutes(pipelineMinutes int64, pipelineTimeout bool) (int64, bool) {
+	for _, o := range m.getOptions() {
+		if minutes, ok := o.getTimeoutMinutes(); ok && (!pipelineTimeout || minutes < pipelineMinutes) {
+			return minutes, true
+		}
+	}
+	return pipelineMinutes, pipelineTimeout
+}
+
+// getRetryCount returns how many times the stage's retry option runs its steps, if it has one that can be converted
+func (m *ModelStage) getRetryCount() int64 {
+	for _, o := range m.getOptions() {
+		if count, ok := o.getRetryCount(); ok {
+			return count
+		}
+	}
+	return 0
+}
+
+// linesForStageOption returns the comments explaining how an option of a stage is converted, if at all, and whether
+// the option's behavior is lost in the conversion. Unlike pipeline options, they only apply to the stage's job, and
+// retries are only converted when its steps are retried in a loop.
+func linesForStageOption(option *ModelOption, stage string, retried bool, indent int) ([]string, bool) {
+	switch option.Name {
+	case "skipDefaultCheckout":
+		// Handled when emitting the checkout step of the job
+		return nil, false
+	case "timeout":
+		minutes, ok := option.getTimeoutMinutes()
+		if !ok {
+			return []string{
+				indentLine(fmt.Sprintf("# The stage '%s' has a timeout option whose duration can't be read. Set timeout-minutes on the job instead.", stage), indent),
+			}, true
+		}
+		if option.isActivityTimeout() {
+			return []string{
+				indentLine(fmt.Sprintf("# WARNING: Jenkins only times out the stage after %d minutes without log output, because of activity: true. GitHub Actions can't reset", minutes), indent),
+				indentLine("# the timeout on log output, so the job times out after that long in total. Raise timeout-minutes if it runs longer.", indent),
+			}, true
+		}
+		// Handled when emitting the job, which times out on its own
+		return nil, false
+	case "retry":
+		count, ok := option.getRetryCount()
+		if !ok {
+			return []string{
+				indentLine(fmt.Sprintf("# The stage '%s' has a retry option whose count can't be read. This is not converted.", stage), indent),
+			}, true
+		}
+		if count <= 1 {
+			// Runs the stage once, like without the option
+			return nil, false
+		}
+		if !retried {
+			return []string{
+				indentLine(fmt.Sprintf("# The Jenkinsfile retries the stage up to %d times, using the retry option. GitHub Actions can't retry a job by itself.", count), indent),
+				indentLine("# Re-run the failed job from the Actions tab instead.", indent),
+			}, true
+		}
+		// Handled when converting the sh steps of the job
+		return []string{
+			indentLine(fmt.Sprintf("# The Jenkinsfile retries the stage up to %d times, using the retry option. GitHub Actions can't retry a job by itself,", count), indent),
+			indentLine("# so each sh step of the job is retried in a loop instead. Other steps run once.", indent),
+		}, false
+	default:
+		if isSupportedField(option.Name, ignoredOptions, false) {
+			return nil, false
+		}
+		return []string{
+			indentLine(fmt.Sprintf("# The Jenkinsfile contains the option %s for the stage '%s'. This is not converted.", option.Name, stage), indent),
+		}, true
+	}
+}
+
+// withRetryLoop wraps the lines of a run script, as returned by getJxArg, in a loop running it up to count times until
+// it succeeds, like the steps of a stage with the retry option. The script runs in a subshell that exits on the first
+// failing command, so the loop knows whether it failed. Its lines aren't indented, which would break heredocs.
+func withRetryLoop(jxArgs []string, count int64) []string {
+	script := jxArgs
+	if len(jxArgs) > 1 {
+		script = jxArgs[1:]
+	}
+	lines := []string{
+		"|",
+		fmt.Sprintf("for attempt in $(seq 1 %d); do", count),
+		"  set +e",
+		"  (",
+		"set -e",
+	}
+	lines = append(lines, script...)
+	return append(lines,
+		"  )",
+		"  status=$?",
+		"  set -e",
+		"  if [ \"$status\" -eq 0 ]; then",
+		"    break",
+		"  fi",
+		fmt.Sprintf("  if [ \"$attempt\" -eq %d ]; then", count),
+		"    exit \"$status\"",
+		"  fi",
+		fmt.Sprintf("  echo \"Attempt $attempt of %d failed, retrying\"", count),
+		"done",
+	)
+}
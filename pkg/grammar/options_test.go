@@ -0,0 +1,25 @@
+package grammar
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestDroppedOptionsAreNotConversionIssues(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("test_data", "dropped_options.groovy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, err := ParseText(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, conversionIssues, err := model.ToYamlWithOptions(ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conversionIssues {
+		t.Error("expected the options dropped with an explanation not to be conversion issues")
+	}
+}
@@ -0,0 +1,82 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// The commands that print a single line, like `git rev-parse HEAD`
+	singleLineCommands = []string{
+		"basename",
+		"date",
+		"dirname",
+		"echo",
+		"git branch --show-current",
+		"git describe",
+		"git rev-list --count",
+		"git rev-parse",
+		"git symbolic-ref",
+		"hostname",
+		"id",
+		"nproc",
+		"pwd",
+		"uname",
+		"wc",
+		"whoami",
+	}
+	// Matches the end of a pipeline keeping a single line of the output, like `| head -n 1` or `| tr -d '\n'`
+	singleLineFilterRegexp = regexp.MustCompile(`^((head|tail)\s+(-n\s*)?-?1|tr\s+-d\s+['"]?\\n['"]?)$`)
+)
+
+// isSingleLineCommand checks if the output of the shell command is clearly a single line, going by the last command
+// of its last pipeline
+func isSingleLineCommand(script string) bool {
+	if strings.Contains(strings.TrimSpace(script), "\n") {
+		return false
+	}
+	commands := strings.Split(script, "|")
+	last := strings.Join(strings.Fields(commands[len(commands)-1]), " ")
+	if singleLineFilterRegexp.MatchString(last) {
+		return true
+	}
+	for _, c := range singleLineCommands {
+		if last == c || strings.HasPrefix(last, c+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// linesForCapturedOutput writes the output of a shell command to the files GitHub Actions reads values from, like
+// $GITHUB_ENV or $GITHUB_OUTPUT. Output that may span several lines is written between delimiters, which GitHub
+// Actions requires for multiline values.
+func linesForCapturedOutput(name string, script string, files ...string) []string {
+	if isSingleLineCommand(script) {
+		return []string{fmt.Sprintf(`echo "%s=$(%s)"%s`, name, script, appendingTo(files))}
+	}
+	delimiter := "EOF_" + name
+	lines := []string{
+		fmt.Sprintf("# %s may span several lines, so it is written between delimiters.", name),
+		"{",
+		fmt.Sprintf(`  echo "%s<<%s"`, name, delimiter),
+	}
+	// Each line of a multiline script on a line of its own, so that it is indented with the others
+	for _, l := range strings.Split(fmt.Sprintf(`echo "$(%s)"`, script), "\n") {
+		lines = append(lines, "  "+l)
+	}
+	lines = append(lines, fmt.Sprintf(`  echo "%s"`, delimiter))
+	lines = append(lines, "}"+appendingTo(files))
+	return lines
+}
+
+// appendingTo returns the redirection appending the output of a command to the files, through tee for all but the
+// last of them
+func appendingTo(files []string) string {
+	redirection := ""
+	for _, f := range files[:len(files)-1] {
+		redirection += fmt.Sprintf(` | tee -a "%s"`, f)
+	}
+	return redirection + fmt.Sprintf(` >> "%s"`, files[len(files)-1])
+}
@@ -0,0 +1,160 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// parallelMapStep is the step the map form of the parallel step is rewritten into, so the grammar can parse it.
+	// It differs from `parallel`, which is unsupported as a stage directive.
+	parallelMapStep = "parallelMap"
+	// parallelBranchStep is the step each branch of the map is rewritten into
+	parallelBranchStep = "parallelBranch"
+)
+
+var (
+	// Matches the start of the map form of the parallel step, `parallel first: { ... }` or `parallel(first: { ... })`
+	parallelMapRegexp   = regexp.MustCompile(`\bparallel\s*\(?\s*(['"]?[\w-]+['"]?\s*:\s*\w+\s*,\s*)*['"]?[\w-]+['"]?\s*:\s*\{`)
+	parallelStartRegexp = regexp.MustCompile(`^parallel\s*(\()?`)
+	// Matches a key of the parallel map, such as `first:` or `'second':`
+	parallelKeyRegexp = regexp.MustCompile(`^\s*['"]?([\w-]+)['"]?\s*:\s*`)
+	// Matches a value other than a branch, such as the `true` of `failFast: true`
+	parallelValueRegexp = regexp.MustCompile(`^\w+`)
+)
+
+// parallelBranch is a named branch of the parallel step's map form
+type parallelBranch struct {
+	Name string
+	Body string
+}
+
+// rewriteParallelMaps rewrites the map form of the parallel step, whose branches are closures, into nested steps the
+// grammar can parse:
+//
+//	parallelMap {
+//	  parallelBranch('first') { ... }
+//	  parallelBranch('second') { ... }
+//	}
+func rewriteParallelMaps(jf string) string {
+	for {
+		loc := parallelMapRegexp.FindStringIndex(jf)
+		if loc == nil {
+			return jf
+		}
+		branches, end := readParallelMap(jf[loc[0]:])
+		var lines []string
+		lines = append(lines, parallelMapStep+" {")
+		for _, b := range branches {
+			lines = append(lines, fmt.Sprintf("%s('%s') {%s}", parallelBranchStep, b.Name, b.Body))
+		}
+		lines = append(lines, "}")
+		jf = jf[:loc[0]] + strings.Join(lines, "\n") + jf[loc[0]+end:]
+	}
+}
+
+// readParallelMap reads the branches of a parallel step's map form at the start of the text, and returns them along
+// with where the step ends. Entries other than branches, such as `failFast: true`, are skipped.
+func readParallelMap(text string) ([]parallelBranch, int) {
+	var branches []parallelBranch
+	start := parallelStartRegexp.FindStringSubmatchIndex(text)
+	pos := start[1]
+	hasParen := start[2] != -1
+	for {
+		key := parallelKeyRegexp.FindStringSubmatchIndex(text[pos:])
+		if key == nil {
+			break
+		}
+		name := text[pos+key[2] : pos+key[3]]
+		pos += key[1]
+		if strings.HasPrefix(text[pos:], "{") {
+			closing := closingCurlyIndex(text[pos+1:])
+			branches = append(branches, parallelBranch{Name: name, Body: text[pos+1 : pos+1+closing]})
+			pos += closing + 2
+		} else {
+			pos += len(parallelValueRegexp.FindString(text[pos:]))
+		}
+		rest := strings.TrimLeft(text[pos:], " \t\r\n")
+		if !strings.HasPrefix(rest, ",") {
+			break
+		}
+		pos = len(text) - len(rest) + 1
+	}
+	if hasParen {
+		rest := strings.TrimLeft(text[pos:], " \t\r\n")
+		if strings.HasPrefix(rest, ")") {
+			pos = len(text) - len(rest) + 1
+		}
+	}
+	return branches, pos
+}
+
+// closingCurlyIndex returns the index of the curly closing the block the text starts within
+func closingCurlyIndex(text string) int {
+	curlyCount := 1
+	for idx, c := range text {
+		if c == '{' {
+			curlyCount++
+		}
+		if c == '}' {
+			curlyCount--
+		}
+		if curlyCount == 0 {
+			return idx
+		}
+	}
+	return len(text)
+}
+
+// getParallelBranches returns the branches of the parallel step, if that is the stage's only step, either directly or
+// as the only statement of a script block. Each branch runs in a job of its own then.
+func (m *ModelStage) getParallelBranches() []*ModelStep {
+	steps := m.getSteps()
+	if len(steps) != 1 {
+		return nil
+	}
+	step := steps[0]
+	if step.Name == "script" && len(step.Args) == 1 && step.Args[0].Unnamed != nil {
+		scriptSteps, err := parseStepsText(unescapeArg(step.getArg()))
+		if err != nil || len(scriptSteps) != 1 {
+			return nil
+		}
+		step = scriptSteps[0]
+	}
+	if step.Name != parallelMapStep {
+		return nil
+	}
+	var branches []*ModelStep
+	for _, b := range step.NestedSteps {
+		if b.Name == parallelBranchStep {
+			branches = append(branches, b)
+		}
+	}
+	return branches
+}
+
+// toParallelJobs splits a stage whose only step is a parallel step into a stage for each branch, to run as concurrent
+// jobs. Stages without parallel branches are returned as they are.
+func (m *ModelStage) toParallelJobs() []*ModelStage {
+	branches := m.getParallelBranches()
+	if len(branches) == 0 {
+		return []*ModelStage{m}
+	}
+	var jobs []*ModelStage
+	for _, b := range branches {
+		job := &ModelStage{
+			Name:           fmt.Sprintf("%s (%s)", m.Name, b.getArg()),
+			parallelBranch: b.getArg(),
+		}
+		for _, e := range m.Entries {
+			if len(e.Steps) > 0 {
+				job.Entries = append(job.Entries, &ModelStageEntry{Steps: b.NestedSteps})
+			} else {
+				job.Entries = append(job.Entries, e)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
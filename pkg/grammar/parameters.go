@@ -0,0 +1,280 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ModelParameter represents a parameter of the parameters directive, like `string(name: 'VERSION')`
+type ModelParameter struct {
+	Type string          `parser:"@Ident" json:"type,omitempty"`
+	Args []*ModelCallArg `parser:"\"(\" ( @@ { \",\" @@ } )? \")\"" json:"args,omitempty"`
+}
+
+// ToString converts the model to a rough string form
+func (m *ModelParameter) ToString() string {
+	var args []string
+	for _, a := range m.Args {
+		args = append(args, a.ToString())
+	}
+	return fmt.Sprintf("%s(%s)", m.Type, strings.Join(args, ", "))
+}
+
+// getNamedValue returns the value of the parameter's named argument, if it has one
+func (m *ModelParameter) getNamedValue(key string) *Value {
+	for _, a := range m.Args {
+		if a.Arg != nil && a.Arg.Named != nil && a.Arg.Named.Key == key {
+			return a.Arg.Named.Value
+		}
+	}
+	return nil
+}
+
+// getNamedString returns the text of the parameter's named argument, if it is a string
+func (m *ModelParameter) getNamedString(key string) string {
+	if v := m.getNamedValue(key); v != nil && v.String != nil {
+		return unescapeArg(*v.String)
+	}
+	return ""
+}
+
+// getChoices returns the options of a choice parameter, given either as a list or as newline separated text
+func (m *ModelParameter) getChoices() []string {
+	v := m.getNamedValue("choices")
+	if v == nil {
+		return nil
+	}
+	var choices []string
+	if v.String != nil {
+		for _, c := range strings.Split(strings.ReplaceAll(unescapeArg(*v.String), `\n`, "\n"), "\n") {
+			if c = strings.TrimSpace(c); c != "" {
+				choices = append(choices, c)
+			}
+		}
+		return choices
+	}
+	for _, item := range v.List {
+		if item.Arg != nil && item.Arg.Unnamed != nil && item.Arg.Unnamed.String != nil {
+			choices = append(choices, unescapeArg(*item.Arg.Unnamed.String))
+		}
+	}
+	return choices
+}
+
+// passwordParameterType is the type of parameters holding a secret, which can't be passed safely as an input
+const passwordParameterType = "password"
+
+// Types of parameters uploading a file when the build starts, which workflows can't take: the file parameter of
+// Jenkins and the base64File and stashedFile parameters of the File Parameters plugin
+var fileParameterTypes = []string{"file", "base64File", "stashedFile"}
+
+// isFileParameter checks if the parameter uploads a file when the build starts
+func (m *ModelParameter) isFileParameter() bool {
+	return containsString(fileParameterTypes, m.Type)
+}
+
+// commentForFileParameter explains that a file parameter isn't converted, and how the file can be provided instead
+func commentForFileParameter(name string, indent int) string {
+	return indentLine(fmt.Sprintf("# The file parameter '%s' isn't converted, since a workflow can't be given a file when it runs. Commit the file to the repository, store its content as a secret, or download it as an artifact of another workflow.", name), indent)
+}
+
+func (m *Model) getParameters() []*ModelParameter {
+	var parameters []*ModelParameter
+	for _, e := range m.Pipeline {
+		parameters = append(parameters, e.Parameters...)
+	}
+	return parameters
+}
+
+// getSecretParameters returns the names of the password parameters, which are read from secrets instead of inputs
+func (m *Model) getSecretParameters() []string {
+	var names []string
+	for _, p := range m.getParameters() {
+		if name := p.getNamedString("name"); name != "" && p.Type == passwordParameterType {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// withSecretParameters reads the password parameters the lines refer to from the secrets standing in for them,
+// instead of from inputs
+func withSecretParameters(lines []string, names []string) []string {
+	if len(names) == 0 {
+		return lines
+	}
+	var replaced []string
+	for _, l := range lines {
+		for _, name := range names {
+			l = strings.ReplaceAll(l, fmt.Sprintf("${{ inputs.%s }}", name), fmt.Sprintf("${{ secrets.%s }}", toSecretName(name)))
+		}
+		replaced = append(replaced, l)
+	}
+	return replaced
+}
+
+// withSecretParameterEnv reads the password parameters that environment variables are set from from the secrets
+// standing in for them, instead of from inputs
+func withSecretParameterEnv(envVars []map[string]string, names []string) []map[string]string {
+	for _, vars := range envVars {
+		for key, value := range vars {
+			vars[key] = withSecretParameters([]string{value}, names)[0]
+		}
+	}
+	return envVars
+}
+
+// getParameterEnv returns the environment variables that set the parameters the pipeline reads as variables, like
+// `$VERSION`, from their inputs. Jenkins sets every parameter as an environment variable, but GitHub Actions doesn't
+// set inputs as variables. As in Jenkins, the variables of the environment directive win over parameters of the same
+// name, which is noted.
+func (m *Model) getParameterEnv() ([]*ModelEnvironmentEntry, []string) {
+	var entries []*ModelEnvironmentEntry
+	var comments []string
+	for _, p := range m.getParameters() {
+		name := p.getNamedString("name")
+		if name == "" || p.isFileParameter() {
+			continue
+		}
+		if m.definesVariable(name) {
+			comments = append(comments, fmt.Sprintf("# The variable '%s' is also a parameter. As in Jenkins, steps reading $%s get the variable, and params.%s the input.", name, name, name))
+			continue
+		}
+		if m.referencesShellVariable(name) {
+			entries = append(entries, &ModelEnvironmentEntry{
+				Key:   name,
+				Value: &ModelEnvironmentEntryValue{Param: &name},
+			})
+		}
+	}
+	return entries, comments
+}
+
+// definesVariable checks if the environment directive of the pipeline sets the variable
+func (m *Model) definesVariable(name string) bool {
+	for _, e := range m.getEnvironment() {
+		if e.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// linesForParameters converts the pipeline's parameters into the inputs of a workflow_dispatch trigger, so that the
+// workflow can be run by hand with the same values. Password parameters are read from secrets instead, since inputs
+// are shown in plain text.
+func linesForParameters(parameters []*ModelParameter, indent int, settings conversionSettings) ([]string, bool) {
+	conversionIssues := false
+
+	lines, inputs, splitIssues := splitParameters(parameters, indent, settings)
+	conversionIssues = conversionIssues || splitIssues
+	if len(inputs) == 0 {
+		return lines, conversionIssues
+	}
+
+	lines = append(lines, indentLine("# The Jenkins parameters are inputs of a manual run. Reference them as ${{ inputs.NAME }} instead of params.NAME.", indent))
+	lines = append(lines, indentLine("workflow_dispatch:", indent))
+	inputLines, inputIssues := linesForInputs(inputs, false, indent+1, settings)
+	return append(lines, inputLines...), conversionIssues || inputIssues
+}
+
+// splitParameters returns the comments on the parameters that aren't inputs, and the other parameters. Password
+// parameters are read from secrets instead of inputs, and file parameters aren't converted.
+func splitParameters(parameters []*ModelParameter, indent int, settings conversionSettings) ([]string, []*ModelParameter, bool) {
+	var lines []string
+	var inputs []*ModelParameter
+	conversionIssues := false
+	for _, p := range parameters {
+		name := p.getNamedString("name")
+		switch {
+		case name != "" && p.Type == passwordParameterType:
+			secret := toSecretName(name)
+			lines = append(lines, indentLine(fmt.Sprintf("# The password parameter '%s' isn't an input, since inputs are shown in plain text. Add it as the secret %s, which steps reference as ${{ secrets.%s }}.", name, secret, secret), indent))
+		case name != "" && p.isFileParameter():
+			conversionIssues = true
+			settings.addIssue("the file parameter '%s'", name)
+			lines = append(lines, commentForFileParameter(name, indent))
+		default:
+			inputs = append(inputs, p)
+		}
+	}
+	return lines, inputs, conversionIssues
+}
+
+// linesForInputs converts parameters into the inputs of a trigger. The inputs of a reusable workflow have no
+// choices, so choice parameters are string inputs then.
+func linesForInputs(inputs []*ModelParameter, reusable bool, indent int, settings conversionSettings) ([]string, bool) {
+	var lines []string
+	conversionIssues := false
+	lines = append(lines, indentLine("inputs:", indent))
+	for _, p := range inputs {
+		name := p.getNamedString("name")
+		if name == "" {
+			conversionIssues = true
+			settings.addIssue("the parameter %s without a name", p.Type)
+			lines = append(lines, indentLine(fmt.Sprintf("# The parameter %s has no name and is not converted.", p.Type), indent+1))
+			continue
+		}
+
+		var inputLines []string
+		if description := p.getNamedString("description"); description != "" {
+			inputLines = append(inputLines, indentLine(fmt.Sprintf("description: %s", toYamlScalar(description)), indent+2))
+		}
+		switch p.Type {
+		case "string", "text":
+			if p.Type == "text" {
+				lines = append(lines, indentLine(fmt.Sprintf("# The text parameter '%s' is a single line input, since inputs can't hold multiple lines.", name), indent+1))
+			}
+			inputLines = append(inputLines, indentLine("type: string", indent+2))
+			if defaultValue := p.getNamedString("defaultValue"); defaultValue != "" {
+				inputLines = append(inputLines, indentLine(fmt.Sprintf("default: %s", yamlQuote(defaultValue)), indent+2))
+			}
+		case "booleanParam":
+			inputLines = append(inputLines, indentLine("type: boolean", indent+2))
+			defaultValue := false
+			if v := p.getNamedValue("defaultValue"); v != nil && v.Bool != nil {
+				defaultValue = bool(*v.Bool)
+			}
+			inputLines = append(inputLines, indentLine(fmt.Sprintf("default: %t", defaultValue), indent+2))
+		case "choice":
+			choices := p.getChoices()
+			if len(choices) == 0 {
+				conversionIssues = true
+				settings.addIssue("the choice parameter '%s' without choices", name)
+				lines = append(lines, indentLine(fmt.Sprintf("# The choice parameter '%s' has no choices and is not converted.", name), indent+1))
+				continue
+			}
+			// A choice input needs a default that is one of its options, which is the first choice in Jenkins
+			defaultValue := choices[0]
+			if jenkinsDefault := p.getNamedString("defaultValue"); jenkinsDefault != "" {
+				if isSupportedField(jenkinsDefault, choices, false) {
+					defaultValue = jenkinsDefault
+				} else {
+					conversionIssues = true
+					settings.addIssue("the choice parameter '%s', whose default '%s' isn't one of its choices", name, jenkinsDefault)
+					lines = append(lines, indentLine(fmt.Sprintf("# WARNING: The default '%s' of the choice parameter '%s' isn't one of its choices, so the first choice is the default instead.", jenkinsDefault, name), indent+1))
+				}
+			}
+			if reusable {
+				lines = append(lines, indentLine(fmt.Sprintf("# The choice parameter '%s' is a string input, since the inputs of a reusable workflow have no choices. Its choices are: %s.", name, strings.Join(choices, ", ")), indent+1))
+				inputLines = append(inputLines, indentLine("type: string", indent+2))
+			} else {
+				inputLines = append(inputLines, indentLine("type: choice", indent+2))
+				inputLines = append(inputLines, indentLine("options:", indent+2))
+				for _, c := range choices {
+					inputLines = append(inputLines, indentLine(fmt.Sprintf("- %s", toYamlScalar(c)), indent+3))
+				}
+			}
+			inputLines = append(inputLines, indentLine(fmt.Sprintf("default: %s", toYamlScalar(defaultValue)), indent+2))
+		default:
+			conversionIssues = true
+			settings.addIssue("the parameter %s '%s'", p.Type, name)
+			lines = append(lines, indentLine(fmt.Sprintf("# The parameter %s '%s' has no equivalent input type and is not converted.", p.Type, name), indent+1))
+			continue
+		}
+		lines = append(lines, indentLine(fmt.Sprintf("%s:", name), indent+1))
+		lines = append(lines, inputLines...)
+	}
+
+	return lines, conversionIssues
+}
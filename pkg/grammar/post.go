@@ -0,0 +1,147 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// postCondition is the closest GitHub Actions condition for a Jenkins post condition
+type postCondition struct {
+	// Condition for steps in the same job as the stage
+	Step string
+	// Condition for steps in the job running after all stage jobs, for the pipeline's post block
+	Pipeline string
+	// Comment explaining what the condition can't express, if anything
+	Comment string
+}
+
+const (
+	anyJobFailed    = "contains(needs.*.result, 'failure')"
+	anyJobCancelled = "contains(needs.*.result, 'cancelled')"
+)
+
+var postConditions = map[string]postCondition{
+	"always": {Step: "always()", Pipeline: "always()"},
+	"success": {
+		Step:     "success()",
+		Pipeline: fmt.Sprintf("!%s && !%s", anyJobFailed, anyJobCancelled),
+	},
+	"failure": {Step: "failure()", Pipeline: anyJobFailed},
+	"aborted": {Step: "cancelled()", Pipeline: "cancelled()"},
+	"unsuccessful": {
+		Step:     "failure() || cancelled()",
+		Pipeline: fmt.Sprintf("%s || cancelled()", anyJobFailed),
+	},
+	"cleanup": {Step: "always()", Pipeline: "always()"},
+	"unstable": {
+		Step:     "failure()",
+		Pipeline: anyJobFailed,
+		Comment:  "GitHub Actions has no unstable result, so the steps run on failure instead.",
+	},
+	"changed": {
+		Step:     "always()",
+		Pipeline: "always()",
+		Comment:  "GitHub Actions can't compare with the result of the previous run, so the steps always run.",
+	},
+	"fixed": {
+		Step:     "success()",
+		Pipeline: fmt.Sprintf("!%s && !%s", anyJobFailed, anyJobCancelled),
+		Comment:  "GitHub Actions can't compare with the result of the previous run, so the steps run on every success.",
+	},
+	"regression": {
+		Step:     "failure() || cancelled()",
+		Pipeline: fmt.Sprintf("%s || cancelled()", anyJobFailed),
+		Comment:  "GitHub Actions can't compare with the result of the previous run, so the steps run on every failure.",
+	},
+}
+
+// getPostToConvert returns the post conditions worth converting, leaving out a lone `cleanWs()` unless the job runs on
+// a runner of your own, since every job starts with a fresh workspace on GitHub-hosted runners. The cleanup condition
+// comes last wherever it's written, since Jenkins runs it after all the others.
+func getPostToConvert(post []*ModelPostEntry, ownRunner bool) []*ModelPostEntry {
+	var toConvert []*ModelPostEntry
+	var cleanup []*ModelPostEntry
+	for _, p := range post {
+		if p.isDefaultCleanWs() && !ownRunner {
+			continue
+		}
+		if p.Kind == "cleanup" {
+			cleanup = append(cleanup, p)
+		} else {
+			toConvert = append(toConvert, p)
+		}
+	}
+	return append(toConvert, cleanup...)
+}
+
+// linesForPost converts the steps of each post condition, guarded by the closest condition on GitHub Actions. If
+// afterJobs is set, the steps run in a job of their own after the stage jobs.
+func linesForPost(post []*ModelPostEntry, afterJobs bool, indent int, settings conversionSettings) ([]string, bool) {
+	var stepLines []string
+	conversionIssues := false
+
+	for _, p := range getPostToConvert(post, settings.ownRunner) {
+		condition, ok := postConditions[p.Kind]
+		if !ok {
+			conversionIssues = true
+			settings.addIssue("the post condition '%s'", p.Kind)
+			stepLines = append(stepLines, indentLine(fmt.Sprintf("# The post condition '%s' is not supported. Its steps are not converted.", p.Kind), indent+1))
+			continue
+		}
+		if condition.Comment != "" {
+			conversionIssues = true
+			settings.addIssue("the post condition '%s', which has no exact equivalent", p.Kind)
+		}
+		ifCondition := condition.Step
+		if afterJobs {
+			ifCondition = condition.Pipeline
+		}
+
+		_, postSteps, postIssues := stepsToImageAndSteps(p.Steps, indent, settings)
+		if postIssues {
+			conversionIssues = true
+		}
+		for _, step := range postSteps {
+			if isCommentOnly(step) {
+				stepLines = append(stepLines, withCommentedOutCondition(step, ifCondition, indent, settings))
+				continue
+			}
+			var commentLines []string
+			commentLines = append(commentLines, indentLine(fmt.Sprintf("# From the '%s' post condition.", p.Kind), indent+2))
+			if condition.Comment != "" {
+				commentLines = append(commentLines, indentLine("# "+condition.Comment, indent+2))
+			}
+			stepLines = append(stepLines, strings.Join(commentLines, "\n")+"\n"+withStepCondition(step, ifCondition, indent))
+		}
+	}
+
+	return stepLines, conversionIssues
+}
+
+// withCommentedOutCondition adds an if condition to the steps commented out among the lines, like the placeholder of
+// a mail step, so that they keep to their post condition once uncommented
+func withCommentedOutCondition(step string, condition string, indent int, settings conversionSettings) string {
+	stepPrefix := indentLine("# - ", indent+1)
+	var lines []string
+	for _, l := range strings.Split(step, "\n") {
+		lines = append(lines, l)
+		if strings.HasPrefix(l, stepPrefix) {
+			lines = append(lines, indentLine(fmt.Sprintf("#   if: ${{ %s }}", condition), indent+1))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withStepCondition adds an if condition to a converted step, combining it with the condition the step has already
+func withStepCondition(step string, condition string, indent int) string {
+	ifPrefix := indentLine("if: ${{ ", indent+2)
+	lines := strings.Split(step, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, ifPrefix) && strings.HasSuffix(l, " }}") {
+			existing := strings.TrimSuffix(strings.TrimPrefix(l, ifPrefix), " }}")
+			lines[i] = indentLine(fmt.Sprintf("if: ${{ (%s) && (%s) }}", condition, existing), indent+2)
+			return strings.Join(lines, "\n")
+		}
+	}
+	return indentLine(fmt.Sprintf("if: ${{ %s }}", condition), indent+2) + "\n" + step
+}
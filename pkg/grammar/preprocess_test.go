@@ -0,0 +1,53 @@
+package grammar
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreprocessEscapesUnsupportedFieldsAndLiteralDollars(t *testing.T) {
+	escaped := Preprocess(`pipeline {
+    agent any
+    tools { maven 'm3' }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'echo $HOME'
+            }
+        }
+    }
+}`)
+	if !strings.Contains(escaped, "tools `maven 'm3' `") {
+		t.Errorf("expected the tools block to be escaped:\n%s", escaped)
+	}
+	if !strings.Contains(escaped, "sh 'echo "+literalDollarPlaceholder+"HOME'") {
+		t.Errorf("expected the dollar sign of the single-quoted string to be literal:\n%s", escaped)
+	}
+	if strings.Contains(escaped, "agent any") {
+		t.Errorf("expected the any agent to be left out:\n%s", escaped)
+	}
+}
+
+func TestWorkflowSectionsMakeUpTheWorkflow(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("test_data", "basic.groovy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, err := ParseText(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections, _, err := model.ToWorkflowSections(ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	asYaml, _, err := model.ToYamlWithOptions(ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joined := strings.Join(sections.Lines(), "\n"); joined != asYaml {
+		t.Errorf("the lines of the sections don't make up the workflow:\n%s", lineDiff(asYaml, joined))
+	}
+}
@@ -0,0 +1,197 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Matches the start of the properties step, `properties([`, on a line of its own
+	propertiesRegexp = regexp.MustCompile(`(?m)^[ \t]*properties\s*\(\s*\[`)
+	// Matches the start of the pipeline block, wherever it is
+	pipelineBlockRegexp = regexp.MustCompile(`(?m)^\s*pipeline\s*\{`)
+	// Matches the name of a job property, like the `pipelineTriggers` of `pipelineTriggers([cron('@daily')])`
+	propertyNameRegexp = regexp.MustCompile(`^\s*(\w+)\s*\(`)
+)
+
+// rewriteProperties rewrites the properties step of older pipelines, outside the pipeline block, into the directives
+// of the pipeline that declare the same:
+//
+//	properties([pipelineTriggers([cron('@daily')]), parameters([string(name: 'X')]), buildDiscarder(...)])
+//
+// becomes
+//
+//	pipeline {
+//	  triggers {
+//	    cron('@daily')
+//	  }
+//	  parameters {
+//	    string(name: 'X')
+//	  }
+//	  properties {
+//	    buildDiscarder(...)
+//	  }
+//	  ...
+//
+// where the properties directive holds any other job properties, which aren't converted.
+func rewriteProperties(jf string) string {
+	pipeline := pipelineBlockRegexp.FindStringIndex(jf)
+	if pipeline == nil {
+		return jf
+	}
+	pipelineEnd := pipeline[1] + closingCurlyIndex(jf[pipeline[1]:])
+	for _, loc := range propertiesRegexp.FindAllStringIndex(jf, -1) {
+		if loc[0] >= pipeline[0] && loc[0] <= pipelineEnd {
+			continue
+		}
+		listEnd := closingBracketIndex(jf[loc[1]:], '[', ']')
+		if listEnd == -1 {
+			return jf
+		}
+		rest := strings.TrimLeft(jf[loc[1]+listEnd+1:], " \t\r\n")
+		if !strings.HasPrefix(rest, ")") {
+			return jf
+		}
+		end := len(jf) - len(rest) + 1
+		if strings.HasPrefix(jf[end:], ";") {
+			end++
+		}
+
+		var triggers, parameters, others []string
+		for _, property := range splitTopLevel(jf[loc[1] : loc[1]+listEnd]) {
+			name := ""
+			if match := propertyNameRegexp.FindStringSubmatch(property); match != nil {
+				name = match[1]
+			}
+			switch name {
+			case "pipelineTriggers":
+				triggers = append(triggers, propertyList(property)...)
+			case "parameters":
+				parameters = append(parameters, propertyList(property)...)
+			default:
+				// Each property on a line of its own, so that they can be told apart
+				others = append(others, strings.Join(strings.Fields(property), " "))
+			}
+		}
+
+		var directives []string
+		for _, d := range []struct {
+			name    string
+			entries []string
+		}{{"triggers", triggers}, {"parameters", parameters}, {"properties", others}} {
+			if len(d.entries) > 0 {
+				directives = append(directives, fmt.Sprintf("  %s {\n    %s\n  }", d.name, strings.Join(d.entries, "\n    ")))
+			}
+		}
+		jf = jf[:loc[0]] + jf[end:]
+		pipeline = pipelineBlockRegexp.FindStringIndex(jf)
+		return rewriteProperties(jf[:pipeline[1]] + "\n" + strings.Join(directives, "\n") + jf[pipeline[1]:])
+	}
+	return jf
+}
+
+// propertyList returns the entries of the list a job property is given, like the triggers of
+// `pipelineTriggers([cron('@daily'), pollSCM('H/5 * * * *')])`
+func propertyList(property string) []string {
+	start := strings.Index(property, "[")
+	if start == -1 {
+		return nil
+	}
+	end := closingBracketIndex(property[start+1:], '[', ']')
+	if end == -1 {
+		return nil
+	}
+	return splitTopLevel(property[start+1 : start+1+end])
+}
+
+// closingBracketIndex returns the index of the bracket closing the one the text starts within, ignoring brackets in
+// quoted strings, or -1 if it isn't closed
+func closingBracketIndex(text string, open byte, close byte) int {
+	depth := 1
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == open:
+			depth++
+		case c == close:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits a comma separated list of Groovy values, leaving the commas within calls, lists, closures and
+// quoted strings alone
+func splitTopLevel(text string) []string {
+	var values []string
+	depth := 0
+	start := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			values = append(values, text[start:i])
+			start = i + 1
+		}
+	}
+	values = append(values, text[start:])
+
+	var trimmed []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			trimmed = append(trimmed, v)
+		}
+	}
+	return trimmed
+}
+
+// linesForProperties warns about the job properties that aren't converted, one line for each
+func linesForProperties(block *UnsupportedModelBlock, indent int, settings conversionSettings) []string {
+	var lines []string
+	for _, property := range splitLines(unescapeArg(block.Value)) {
+		name := property
+		if match := propertyNameRegexp.FindStringSubmatch(property); match != nil {
+			name = match[1]
+		}
+		settings.addIssue("the job property %s", name)
+		lines = append(lines, indentLine(fmt.Sprintf("# The Jenkinsfile sets the job property %s with the properties step. This is not converted.", name), indent))
+	}
+	return lines
+}
+
+// splitLines returns the lines of the text that aren't blank, trimmed
+func splitLines(text string) []string {
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,54 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Matches the secrets a workflow reads, like `${{ secrets.DOCKER_HUB }}`
+var secretReferenceRegexp = regexp.MustCompile(`\$\{\{\s*secrets\.(\w+)\s*\}\}`)
+
+// getSecretNames returns the names of the secrets the lines of a workflow read, sorted. GITHUB_TOKEN is left out,
+// since every workflow has it.
+func getSecretNames(lines []string) []string {
+	var names []string
+	for _, l := range lines {
+		for _, match := range secretReferenceRegexp.FindAllStringSubmatch(l, -1) {
+			if match[1] != "GITHUB_TOKEN" {
+				names = appendIfMissing(names, match[1])
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// linesForWorkflowCall converts the pipeline's parameters into the inputs of a reusable workflow, and declares the
+// secrets the given lines of the workflow read, like those of credentials, so that the calling workflows pass them.
+// The calling workflows decide when it runs, so branches and the triggers directive don't trigger it.
+func (m *Model) linesForWorkflowCall(workflowLines []string, indent int, settings conversionSettings) ([]string, bool) {
+	var lines []string
+	lines = append(lines, indentLine("# The workflow is reusable. The workflows calling it decide when it runs, and pass the parameters as inputs and the secrets it uses.", indent))
+	if triggers, ok := m.getTriggerDirectives(); !ok || len(triggers) > 0 {
+		lines = append(lines, indentLine("# The triggers directive isn't converted, since it is up to the calling workflows when this one runs.", indent))
+	}
+	parameterComments, inputs, conversionIssues := splitParameters(m.getParameters(), indent, settings)
+	lines = append(lines, parameterComments...)
+	lines = append(lines, indentLine("on:", indent))
+	lines = append(lines, indentLine("workflow_call:", indent+1))
+	if len(inputs) > 0 {
+		inputLines, inputIssues := linesForInputs(inputs, true, indent+2, settings)
+		conversionIssues = conversionIssues || inputIssues
+		lines = append(lines, inputLines...)
+	}
+	if secrets := getSecretNames(workflowLines); len(secrets) > 0 {
+		lines = append(lines, indentLine("# Callers pass each secret, or all of theirs with secrets: inherit.", indent+2))
+		lines = append(lines, indentLine("secrets:", indent+2))
+		for _, s := range secrets {
+			lines = append(lines, indentLine(fmt.Sprintf("%s:", s), indent+3))
+			lines = append(lines, indentLine("required: true", indent+4))
+		}
+	}
+	return lines, conversionIssues
+}
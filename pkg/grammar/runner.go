@@ -0,0 +1,169 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const defaultRunsOn = "ubuntu-latest"
+
+var (
+	// Steps that only run on Windows agents
+	windowsSteps = []string{
+		"bat",
+		"powershell",
+	}
+
+	// Hints in Jenkins agent labels, and the GitHub-hosted runner they map to
+	labelRunners = [][]string{
+		{"self-hosted", selfHostedRunsOn},
+		{"selfhosted", selfHostedRunsOn},
+		{"on-prem", selfHostedRunsOn},
+		{"onprem", selfHostedRunsOn},
+		{"gpu", selfHostedRunsOn},
+		{"windows", "windows-latest"},
+		{"mac", "macos-latest"},
+		{"macos", "macos-latest"},
+		{"osx", "macos-latest"},
+		{"linux", "ubuntu-latest"},
+		{"ubuntu", "ubuntu-latest"},
+		{"docker", "ubuntu-latest"},
+	}
+
+	// How specific a runner is, to choose between the runners the terms of a label expression map to
+	runnerSpecificity = map[string]int{
+		selfHostedRunsOn: 3,
+		"windows-latest": 2,
+		"macos-latest":   2,
+		"ubuntu-latest":  1,
+	}
+
+	// Matches the separators between the words of a label, like the dash in `build-machine`
+	labelSeparatorRegexp = regexp.MustCompile(`[-_ .]+`)
+	// Matches the labels of GitHub-hosted runners, like ubuntu-latest or windows-2022
+	githubHostedRunnerRegexp = regexp.MustCompile(`^(ubuntu|windows|macos)-(latest|\d[\w.-]*)$`)
+	// Matches the negated terms of a label expression, like `!windows`, which can't pick a runner
+	negatedLabelRegexp = regexp.MustCompile(`!\s*[^\s&|()!]+`)
+	// Matches the operators and parentheses between the terms of a label expression
+	labelOperatorRegexp = regexp.MustCompile(`&&|\|\||[()]`)
+)
+
+const selfHostedRunsOn = "self-hosted"
+
+// runnerForLabel maps a Jenkins agent label, or a label expression like `linux && docker`, to a runner, if the label
+// is recognizable. Of the runners the terms of an expression map to, the most specific one is used. It also returns
+// comments asking to check the choice.
+func runnerForLabel(label string) (string, []string, bool) {
+	runner := ""
+	var matched []string
+	terms := labelOperatorRegexp.Split(negatedLabelRegexp.ReplaceAllString(strings.ToLower(label), ""), -1)
+	for _, term := range terms {
+		words := labelWords(term)
+		for _, lr := range labelRunners {
+			if containsWords(words, labelWords(lr[0])) {
+				matched = appendIfMissing(matched, lr[1])
+				if runnerSpecificity[lr[1]] > runnerSpecificity[runner] {
+					runner = lr[1]
+				}
+				break
+			}
+		}
+	}
+	if runner == "" {
+		return "", nil, false
+	}
+
+	var comments []string
+	if runner == selfHostedRunsOn {
+		comments = append(comments, fmt.Sprintf("# The Jenkins agent label '%s' looks like an agent of your own, so the job runs on a self-hosted runner. Please register one with matching labels.", label))
+	}
+	if len(matched) > 1 {
+		comments = append(comments, fmt.Sprintf("# The Jenkins agent label expression '%s' matches the runners %s, so the most specific one, '%s', is used. Please check that the job can run there.", label, strings.Join(matched, ", "), runner))
+	} else if len(terms) > 1 || strings.Contains(label, "!") {
+		comments = append(comments, fmt.Sprintf("# The Jenkins agent label expression '%s' is mapped to '%s'. Please check that the job can run there.", label, runner))
+	}
+	return runner, comments, true
+}
+
+// isGitHubHostedRunner checks if a runner label is for a GitHub-hosted runner, whose workspace starts empty for every job
+func isGitHubHostedRunner(runner string) bool {
+	return githubHostedRunnerRegexp.MatchString(runner)
+}
+
+// labelWords splits a label into its words, so that hints only match whole words: `mac-mini` is a Mac, but
+// `build-machine` isn't
+func labelWords(label string) []string {
+	return strings.Fields(labelSeparatorRegexp.ReplaceAllString(label, " "))
+}
+
+// containsWords checks if the words of a hint appear in a row among the words of a label
+func containsWords(words []string, hint []string) bool {
+	for i := 0; i+len(hint) <= len(words); i++ {
+		matches := true
+		for j, w := range hint {
+			if words[i+j] != w {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// usesWindowsSteps checks if any of the stage's steps can only run on Windows
+func (m *ModelStage) usesWindowsSteps() bool {
+	for _, step := range m.getSteps() {
+		for _, s := range step.nestedStepsWithDirAndImage("", "") {
+			for _, w := range windowsSteps {
+				if s.step.Name == w {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// runsOn decides which runner the job for a stage runs on. Windows-only steps take precedence over the stage's
+// agent label, which takes precedence over the pipeline's agent label, and finally the default runner from the
+// options. It also returns comments for labels that couldn't be mapped.
+func (m *ModelStage) runsOn(pipelineAgent *ModelAgent, opts ConvertOptions) (string, []string) {
+	if m.usesWindowsSteps() {
+		return "windows-latest", []string{"# This stage uses Windows-only steps, so it runs on 'windows-latest'."}
+	}
+
+	var comments []string
+	runner := opts.RunsOn
+	if runner == "" {
+		runner = defaultRunsOn
+	}
+	for _, agent := range []*ModelAgent{pipelineAgent, m.getAgent()} {
+		label := agent.getLabel()
+		if label == "" {
+			// Like agent any, and pipelines without an agent, an empty label runs on any agent
+			continue
+		}
+		if labelRunner, labelComments, ok := runnerForLabel(label); ok {
+			runner = labelRunner
+			comments = append(comments, labelComments...)
+		} else {
+			comments = append(comments, fmt.Sprintf("# The Jenkins agent label '%s' has no matching GitHub-hosted runner, so '%s' is used instead.", label, runner))
+		}
+	}
+	return runner, comments
+}
+
+// getLabel returns the label of the agent, or of the node its docker container runs on, if it has one that isn't blank
+func (m *ModelAgent) getLabel() string {
+	if m == nil {
+		return ""
+	}
+	if m.Docker != nil {
+		return m.Docker.getString("label")
+	}
+	return strings.TrimSpace(m.Label)
+}
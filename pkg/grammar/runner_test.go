@@ -0,0 +1,31 @@
+package grammar
+
+import (
+	"testing"
+)
+
+func TestRunnerForLabelMatchesWholeWords(t *testing.T) {
+	tests := []struct {
+		label  string
+		runner string
+	}{
+		{"mac-mini", "macos-latest"},
+		{"macos", "macos-latest"},
+		{"windows-2019", "windows-latest"},
+		{"Linux_Docker", "ubuntu-latest"},
+		{"self-hosted", selfHostedRunsOn},
+		{"build-self-hosted-01", selfHostedRunsOn},
+		{"linux && gpu", selfHostedRunsOn},
+		{"!windows && linux", "ubuntu-latest"},
+		// Hints inside other words aren't matched
+		{"build-machine", ""},
+		{"dockerhost", ""},
+		{"winlinuxer", ""},
+	}
+	for _, tt := range tests {
+		runner, _, ok := runnerForLabel(tt.label)
+		if runner != tt.runner || ok != (tt.runner != "") {
+			t.Errorf("runnerForLabel(%q) = %q, %v, want %q", tt.label, runner, ok, tt.runner)
+		}
+	}
+}
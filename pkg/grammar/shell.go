@@ -0,0 +1,135 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultShell is the shell run steps use, since the Jenkins sh step runs its script with a POSIX shell, and the
+// default shell of GitHub runners differs by OS
+const defaultShell = "bash"
+
+// Named arguments of the sh, bat and powershell steps that are converted
+var shellStepArgs = []string{
+	"script",
+	"returnStdout",
+	"returnStatus",
+	"label",
+	"encoding",
+}
+
+// shellStep is a sh, bat or powershell step given with named arguments, like
+// `sh(script: 'make test', returnStatus: true, label: 'Test')`
+type shellStep struct {
+	// step is the step with the script as its only argument, as if it were given without names
+	step         *ModelStep
+	label        string
+	encoding     string
+	returnStatus bool
+	returnStdout bool
+	// unknownArgs are the named arguments that aren't converted
+	unknownArgs []string
+}
+
+// toShellStep reads the named arguments of a shell step, and returns false if the step has no script
+func toShellStep(step *ModelStep) (shellStep, bool) {
+	shell := shellStep{}
+	var script *Value
+	for _, a := range step.Args {
+		if a.Named == nil || a.Named.Value == nil {
+			return shellStep{}, false
+		}
+		v := a.Named.Value
+		switch a.Named.Key {
+		case "script":
+			script = v
+		case "label":
+			shell.label = step.getNamedArg("label")
+		case "encoding":
+			shell.encoding = step.getNamedArg("encoding")
+		case "returnStatus":
+			shell.returnStatus = v.Bool != nil && bool(*v.Bool)
+		case "returnStdout":
+			if step.Name != "sh" {
+				// The output is captured with a bash command substitution
+				shell.unknownArgs = append(shell.unknownArgs, a.Named.Key)
+				continue
+			}
+			shell.returnStdout = v.Bool != nil && bool(*v.Bool)
+		default:
+			shell.unknownArgs = append(shell.unknownArgs, a.Named.Key)
+		}
+	}
+	if script == nil || script.String == nil {
+		return shellStep{}, false
+	}
+	shell.step = &ModelStep{Name: step.Name, Args: []*ModelStepArg{{Unnamed: script}}}
+	return shell, true
+}
+
+// linesBefore returns the lines going before the run of the step: its name from the label, and comments for the
+// arguments that have no equivalent
+func (s shellStep) linesBefore(indent int, settings conversionSettings) ([]string, bool) {
+	var lines []string
+	if s.label != "" {
+		lines = append(lines, indentLine(fmt.Sprintf("name: %s", toYamlScalar(s.label)), indent+2))
+	}
+	if s.encoding != "" {
+		lines = append(lines, indentLine(fmt.Sprintf("# The %s step read the output of its script as %s. Steps on GitHub Actions always log it as UTF-8.", s.step.Name, s.encoding), indent+2))
+	}
+	for _, a := range s.unknownArgs {
+		settings.addIssue("the argument %s of the step %s", a, s.step.Name)
+		lines = append(lines, indentLine(fmt.Sprintf("# WARNING: The argument %s of the step %s can't be converted and is left out.", a, s.step.Name), indent+2))
+	}
+	return lines, len(s.unknownArgs) > 0
+}
+
+// withCapturedStdout makes a script, as returned by getJxArg, write its output to the step output stdout, like
+// returnStdout returns it in Jenkins
+func withCapturedStdout(jxArgs []string) []string {
+	script := jxArgs[0]
+	if len(jxArgs) > 1 {
+		script = strings.Join(jxArgs[1:], "\n")
+	}
+	return append([]string{"|"}, linesForCapturedOutput("stdout", script, "$GITHUB_OUTPUT")...)
+}
+
+// linesAfter returns the lines going after the run of the step, for returnStatus and returnStdout
+func (s shellStep) linesAfter(id string, indent int) []string {
+	var lines []string
+	if s.returnStdout {
+		lines = append(lines, indentLine(fmt.Sprintf("# The output of the script, which returnStdout returned, is the step output steps.%s.outputs.stdout.", id), indent+2))
+		lines = append(lines, indentLine(fmt.Sprintf("id: %s", id), indent+2))
+	}
+	if s.returnStatus {
+		lines = append(lines, indentLine("# With returnStatus, a failing script doesn't fail the build. Its result is the outcome of the step.", indent+2))
+		lines = append(lines, indentLine("continue-on-error: true", indent+2))
+	}
+	return lines
+}
+
+// isWindowsRunner checks if a runner label is for a Windows runner
+func isWindowsRunner(runner string) bool {
+	return strings.Contains(strings.ToLower(runner), "windows")
+}
+
+// runsOnWindows checks if the job for any of the stages runs on a Windows runner
+func (m *Model) runsOnWindows(opts ConvertOptions) bool {
+	for _, stage := range m.getStages() {
+		for _, s := range stage.toParallelJobs() {
+			if runsOn, _ := s.runsOn(m.getAgent(), opts); isWindowsRunner(runsOn) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// linesForDefaultShell makes run steps use bash
+func linesForDefaultShell(indent int) []string {
+	var lines []string
+	lines = append(lines, indentLine("defaults:", indent))
+	lines = append(lines, indentLine("run:", indent+1))
+	lines = append(lines, indentLine("shell: "+defaultShell, indent+2))
+	return lines
+}
@@ -0,0 +1,165 @@
+package grammar
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Arguments of the stash step that map to inputs of the upload-artifact action
+var stashMappedArgs = []string{
+	"name",
+	"includes",
+	"excludes",
+	"allowEmpty",
+}
+
+// getStashName returns the name of a stash or unstash step, given either as its only argument or as the named
+// argument
+func (m *ModelStep) getStashName() string {
+	if name := m.getNamedArg("name"); name != "" {
+		return name
+	}
+	if len(m.Args) == 1 && m.Args[0].Unnamed != nil {
+		return unescapeArg(m.getArg())
+	}
+	return ""
+}
+
+// getStashIncludes returns the patterns of the files a stash step stashes, in the folder it runs in. Like Jenkins,
+// it stashes every file unless told otherwise.
+func (m *ModelStep) getStashIncludes(dir string) []string {
+	includes := splitPatterns(m.getNamedArg("includes"))
+	if len(includes) == 0 {
+		includes = []string{"**"}
+	}
+	var patterns []string
+	for _, p := range includes {
+		// Like in Ant, a pattern ending with a slash matches everything in the folder
+		if strings.HasSuffix(p, "/") {
+			p += "**"
+		}
+		patterns = append(patterns, path.Join(dir, p))
+	}
+	return patterns
+}
+
+// stashRoot returns the folder upload-artifact stores the matched files relative to: the deepest folder all the
+// patterns are in, before any wildcard
+func stashRoot(patterns []string) string {
+	var root []string
+	for i, p := range patterns {
+		var folders []string
+		parts := strings.Split(p, "/")
+		for _, part := range parts[:len(parts)-1] {
+			if strings.ContainsAny(part, "*?[{") {
+				break
+			}
+			folders = append(folders, part)
+		}
+		if i == 0 {
+			root = folders
+			continue
+		}
+		common := 0
+		for common < len(root) && common < len(folders) && root[common] == folders[common] {
+			common++
+		}
+		root = root[:common]
+	}
+	if len(root) == 0 {
+		return "."
+	}
+	return strings.Join(root, "/")
+}
+
+// getStashRoots returns the folder each stash of the pipeline is stored relative to, in the folder its stash step
+// runs in, by name
+func (m *Model) getStashRoots() map[string]string {
+	roots := make(map[string]string)
+	for _, stage := range m.getStages() {
+		for _, s := range stage.toParallelJobs() {
+			for _, step := range s.getSteps() {
+				for _, nested := range step.nestedStepsWithDirAndImage("", "") {
+					if nested.step.Name != "stash" || nested.step.getStashName() == "" {
+						continue
+					}
+					root := stashRoot(nested.step.getStashIncludes(""))
+					roots[nested.step.getStashName()] = root
+				}
+			}
+		}
+	}
+	return roots
+}
+
+// getStashRetentionDays returns how many days stashes are kept, going by the preserveStashes option: Jenkins keeps
+// the stashes of that many of the latest builds, which is taken as a build a day. Without the option, Jenkins drops
+// stashes once the build is done, so they are kept for the shortest time there is, a day.
+func (m *Model) getStashRetentionDays() int64 {
+	for _, o := range m.getOptions() {
+		if o.Name != "preserveStashes" {
+			continue
+		}
+		if v := o.getNamedValue("buildCount"); v != nil && v.Int != nil && *v.Int > 0 {
+			return *v.Int
+		}
+	}
+	return 1
+}
+
+// linesForStash converts the stash step into the upload-artifact action, which keeps the files for the jobs of later
+// stages to download
+func linesForStash(step *ModelStep, dir string, indent int, settings conversionSettings) []string {
+	var stepLines []string
+	stepLines = append(stepLines, commentsForUnmappedArgs(step, stashMappedArgs, "actions/upload-artifact", indent)...)
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("# The stash '%s' is an artifact, which the jobs of later stages download.", step.getStashName()), indent+2))
+	stepLines = append(stepLines, indentLine("uses: "+settings.action("actions/upload-artifact"), indent+2))
+	stepLines = append(stepLines, indentLine("with:", indent+2))
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("name: %s", toYamlScalar(step.getStashName())), indent+3))
+	stepLines = append(stepLines, indentLine("path: |", indent+3))
+	for _, p := range step.getStashIncludes(dir) {
+		stepLines = append(stepLines, indentLine(p, indent+4))
+	}
+	for _, p := range splitPatterns(step.getNamedArg("excludes")) {
+		stepLines = append(stepLines, indentLine("!"+path.Join(dir, p), indent+4))
+	}
+	ifNoFilesFound := "error"
+	if step.getNamedArg("allowEmpty") == "true" {
+		ifNoFilesFound = "ignore"
+	}
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("if-no-files-found: %s", ifNoFilesFound), indent+3))
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("retention-days: %d", settings.stashRetentionDays), indent+3))
+	return stepLines
+}
+
+// linesForUnstash converts the unstash step into the download-artifact action, putting the files back where the
+// stash step found them
+func linesForUnstash(step *ModelStep, dir string, indent int, settings conversionSettings) []string {
+	var stepLines []string
+	name := step.getStashName()
+	root, ok := settings.stashes[name]
+	if !ok {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("# The Jenkinsfile doesn't stash '%s', so where its files belong is unknown. Please check the path.", name), indent+2))
+		root = "."
+	}
+	stepLines = append(stepLines, indentLine("uses: "+settings.action("actions/download-artifact"), indent+2))
+	stepLines = append(stepLines, indentLine("with:", indent+2))
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("name: %s", toYamlScalar(name)), indent+3))
+	if downloadPath := path.Join(dir, root); downloadPath != "." {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("path: %s", yamlQuote(downloadPath)), indent+3))
+	}
+	return stepLines
+}
+
+// linesForPreserveStashes explains how the preserveStashes option is converted, if the pipeline stashes anything
+func linesForPreserveStashes(indent int, settings conversionSettings) []string {
+	if len(settings.stashes) == 0 {
+		return []string{
+			indentLine("# The option preserveStashes has no effect, since the Jenkinsfile doesn't stash anything.", indent),
+		}
+	}
+	return []string{
+		indentLine(fmt.Sprintf("# The option preserveStashes keeps the stashes of the latest builds. Stashes are artifacts kept for %d days instead, a day for each build.", settings.stashRetentionDays), indent),
+	}
+}
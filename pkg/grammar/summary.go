@@ -0,0 +1,76 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConversionSummary counts what a conversion converted and what it left out, to gauge how much a converted workflow
+// needs fixing by hand
+type ConversionSummary struct {
+	// StagesConverted is how many stages are converted into jobs
+	StagesConverted int `json:"stagesConverted"`
+	// StagesNotConverted is how many stages are left out, such as those with unsupported when conditions
+	StagesNotConverted int `json:"stagesNotConverted"`
+	// StepsConverted is how many steps are converted as they are
+	StepsConverted int `json:"stepsConverted"`
+	// StepsCommentedOut is how many steps are left as comments only, since the workflow doesn't need them
+	StepsCommentedOut int `json:"stepsCommentedOut"`
+	// StepsToFix is how many steps aren't fully converted, and need fixing by hand
+	StepsToFix int `json:"stepsToFix"`
+	// UnsupportedDirectives is how many directives and options of the pipeline and its stages aren't converted
+	UnsupportedDirectives int `json:"unsupportedDirectives"`
+	// Issues lists the constructs that aren't fully converted
+	Issues []string `json:"issues,omitempty"`
+}
+
+// String describes the counts of the summary in a sentence
+func (s ConversionSummary) String() string {
+	stages := s.StagesConverted + s.StagesNotConverted
+	steps := s.StepsConverted + s.StepsCommentedOut + s.StepsToFix
+	return fmt.Sprintf("Converted %d of %d stages and %d of %d steps. %d steps are commented out, %d steps and %d directives need fixing by hand.",
+		s.StagesConverted, stages, s.StepsConverted, steps, s.StepsCommentedOut, s.StepsToFix, s.UnsupportedDirectives)
+}
+
+// issueCount returns how many constructs are recorded as not fully converted so far
+func (s conversionSettings) issueCount() int {
+	if s.issues == nil {
+		return 0
+	}
+	return len(*s.issues)
+}
+
+// countStep counts a converted step in the summary: as one to fix if any issue was recorded while converting it, as
+// commented out if it only left comments, and as converted otherwise
+func (s conversionSettings) countStep(stepLines []string, issuesBefore int) {
+	if s.summary == nil {
+		return
+	}
+	switch {
+	case s.issueCount() > issuesBefore:
+		s.summary.StepsToFix++
+	case len(stepLines) > 0 && isCommentOnly(strings.Join(stepLines, "\n")):
+		s.summary.StepsCommentedOut++
+	default:
+		s.summary.StepsConverted++
+	}
+}
+
+// countStage counts a stage in the summary, as converted or as left out
+func (s conversionSettings) countStage(converted bool) {
+	if s.summary == nil {
+		return
+	}
+	if converted {
+		s.summary.StagesConverted++
+	} else {
+		s.summary.StagesNotConverted++
+	}
+}
+
+// countUnsupportedDirective counts a directive or option that isn't converted in the summary
+func (s conversionSettings) countUnsupportedDirective() {
+	if s.summary != nil {
+		s.summary.UnsupportedDirectives++
+	}
+}
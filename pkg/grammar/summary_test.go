@@ -0,0 +1,32 @@
+package grammar
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// convertSections parses a golden Jenkinsfile and converts it into the sections of a workflow
+func convertSections(t *testing.T, name string, opts ConvertOptions) *WorkflowSections {
+	data, err := ioutil.ReadFile(filepath.Join("test_data", name+".groovy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, err := ParseText(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections, _, err := model.ToWorkflowSections(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sections
+}
+
+func TestSummaryCountsStagesWithUnsupportedBodiesAsNotConverted(t *testing.T) {
+	summary := convertSections(t, "empty_stages", ConvertOptions{}).Summary
+	// Setup, Milestone and Release are jobs, while the parallel and matrix stages are left out
+	if summary.StagesConverted != 3 || summary.StagesNotConverted != 2 {
+		t.Errorf("expected 3 stages converted and 2 not, got %d and %d", summary.StagesConverted, summary.StagesNotConverted)
+	}
+}
@@ -0,0 +1,11 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make build'
+                archiveArtifacts artifacts: 'dist/**'
+            }
+        }
+    }
+}
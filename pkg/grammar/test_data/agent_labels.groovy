@@ -0,0 +1,34 @@
+pipeline {
+    agent any
+    stages {
+        stage('Any') {
+            steps {
+                sh 'make'
+            }
+        }
+        stage('Empty label') {
+            agent {
+                label ''
+            }
+            steps {
+                sh 'make test'
+            }
+        }
+        stage('Blank label') {
+            agent {
+                label '  '
+            }
+            steps {
+                sh 'make lint'
+            }
+        }
+        stage('Unknown label') {
+            agent {
+                label 'build-farm-42'
+            }
+            steps {
+                sh 'make package'
+            }
+        }
+    }
+}
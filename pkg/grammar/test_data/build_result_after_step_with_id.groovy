@@ -0,0 +1,27 @@
+pipeline {
+    agent any
+    stages {
+        stage('Test') {
+            steps {
+                sh 'make lint'
+                script {
+                    if (fileExists('lint.txt')) {
+                        currentBuild.result = 'UNSTABLE'
+                    }
+                }
+                sh(script: 'make test', returnStdout: true)
+                script {
+                    if (fileExists('failures.txt')) {
+                        currentBuild.result = 'UNSTABLE'
+                    }
+                }
+                sh(script: 'make e2e', returnStatus: true)
+                script {
+                    if (fileExists('e2e.txt')) {
+                        currentBuild.result = 'UNSTABLE'
+                    }
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,15 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'mvn -B clean package'
+                sh './mvnw -s settings.xml clean'
+                sh 'gradle build'
+                sh './gradlew --no-daemon test integrationTest'
+                sh label: 'Publish', script: 'mvn deploy'
+                sh 'mvn package && cp target/app.jar dist/'
+            }
+        }
+    }
+}
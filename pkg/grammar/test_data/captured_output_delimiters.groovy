@@ -0,0 +1,15 @@
+pipeline {
+    agent any
+    environment {
+        CHANGED_FILES = sh(script: 'git diff --name-only HEAD~1', returnStdout: true).trim()
+    }
+    stages {
+        stage('Inspect') {
+            steps {
+                sh(script: 'git rev-parse HEAD', returnStdout: true)
+                sh(script: 'cat package.json | jq .scripts', returnStdout: true)
+                sh(script: 'ls dist | head -n 1', returnStdout: true)
+            }
+        }
+    }
+}
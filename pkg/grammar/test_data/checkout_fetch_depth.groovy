@@ -0,0 +1,15 @@
+pipeline {
+    agent any
+    stages {
+        stage('Version') {
+            steps {
+                sh 'git describe --tags > VERSION'
+            }
+        }
+        stage('Build') {
+            steps {
+                sh 'make build'
+            }
+        }
+    }
+}
@@ -0,0 +1,25 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make'
+            }
+        }
+        stage('Build!') {
+            steps {
+                sh 'make again'
+            }
+        }
+        stage('Build_2') {
+            steps {
+                sh 'make once more'
+            }
+        }
+        stage('Build 2') {
+            steps {
+                sh 'make one last time'
+            }
+        }
+    }
+}
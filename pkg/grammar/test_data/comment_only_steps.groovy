@@ -0,0 +1,13 @@
+pipeline {
+    agent any
+    options {
+        skipDefaultCheckout()
+    }
+    stages {
+        stage('Gate') {
+            steps {
+                milestone(1)
+            }
+        }
+    }
+}
@@ -0,0 +1,6 @@
+// The pipeline moved to another repository.
+/*
+pipeline {
+    agent any
+}
+*/
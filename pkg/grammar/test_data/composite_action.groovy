@@ -0,0 +1,17 @@
+pipeline {
+    agent any
+    parameters {
+        string(name: 'TARGET', defaultValue: 'all', description: 'The make target')
+    }
+    environment {
+        GOFLAGS = '-mod=mod'
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh "make ${params.TARGET}"
+                bat 'build.cmd'
+            }
+        }
+    }
+}
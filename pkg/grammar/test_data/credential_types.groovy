@@ -0,0 +1,16 @@
+pipeline {
+    agent any
+    stages {
+        stage('Push') {
+            environment {
+                DOCKER_HUB = credentials('docker-hub')
+                SLACK_TOKEN = credentials('slack.token')
+            }
+            steps {
+                sh 'echo $DOCKER_HUB_PSW | docker login --password-stdin -u $DOCKER_HUB_USR'
+                sh 'docker push app'
+                sh 'notify --token $SLACK_TOKEN'
+            }
+        }
+    }
+}
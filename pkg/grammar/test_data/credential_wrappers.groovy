@@ -0,0 +1,18 @@
+pipeline {
+    agent any
+    stages {
+        stage('Publish') {
+            steps {
+                withAWS(credentials: 'aws-deploy', region: 'eu-west-1') {
+                    sh 'aws s3 sync dist s3://bucket'
+                }
+                withDockerRegistry([credentialsId: 'docker-hub', url: 'https://index.docker.io/v1/']) {
+                    sh 'docker push org/app'
+                }
+                withSonarQubeEnv('sonar') {
+                    sh 'mvn sonar:sonar'
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,12 @@
+pipeline {
+    agent any
+    stages {
+        stage('Deploy') {
+            steps {
+                deployApp(env: 'staging', version: '1.4.2')
+                notifySlack 'releases'
+                unknownStep()
+            }
+        }
+    }
+}
@@ -0,0 +1,13 @@
+pipeline {
+    agent any
+    stages {
+        stage('Frontend') {
+            steps {
+                dir('frontend') {
+                    sh 'npm run build'
+                }
+                sh 'ls frontend/dist'
+            }
+        }
+    }
+}
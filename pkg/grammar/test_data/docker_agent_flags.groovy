@@ -0,0 +1,28 @@
+pipeline {
+    agent {
+        docker {
+            image 'maven:3.9-eclipse-temurin-17'
+            args '--memory 4g'
+            reuseNode true
+            alwaysPull true
+        }
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'mvn -B package'
+            }
+        }
+        stage('Lint') {
+            agent {
+                docker {
+                    image 'golangci/golangci-lint:v1.55'
+                    reuseNode false
+                }
+            }
+            steps {
+                sh 'golangci-lint run'
+            }
+        }
+    }
+}
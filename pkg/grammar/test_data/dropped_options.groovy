@@ -0,0 +1,14 @@
+pipeline {
+    agent any
+    options {
+        quietPeriod(30)
+        throttleJobProperty(categories: ['deploy'], throttleEnabled: true, throttleOption: 'category')
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make build'
+            }
+        }
+    }
+}
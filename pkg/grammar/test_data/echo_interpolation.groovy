@@ -0,0 +1,18 @@
+pipeline {
+    agent any
+    environment {
+        VERSION = '1.2.0'
+    }
+    stages {
+        stage('Build') {
+            steps {
+                echo "Building ${VERSION}"
+                echo 'Status: done # for now'
+                echo """
+                    Version: ${VERSION}
+                    Branch: ${env.BRANCH_NAME}
+                """
+            }
+        }
+    }
+}
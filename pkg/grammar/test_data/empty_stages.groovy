@@ -0,0 +1,51 @@
+pipeline {
+    agent any
+    stages {
+        stage('Setup') {
+            environment {
+                TARGET = 'staging'
+            }
+        }
+        stage('Milestone') {
+            steps {
+                milestone(1)
+            }
+        }
+        stage('Tests') {
+            parallel {
+                stage('Unit') {
+                    steps {
+                        sh 'make unit'
+                    }
+                }
+                stage('Lint') {
+                    steps {
+                        sh 'make lint'
+                    }
+                }
+            }
+        }
+        stage('Platforms') {
+            matrix {
+                axes {
+                    axis {
+                        name 'PLATFORM'
+                        values 'linux', 'windows'
+                    }
+                }
+                stages {
+                    stage('Build') {
+                        steps {
+                            sh 'make build'
+                        }
+                    }
+                }
+            }
+        }
+        stage('Release') {
+            steps {
+                sh 'make release'
+            }
+        }
+    }
+}
@@ -0,0 +1,19 @@
+pipeline {
+    agent any
+    parameters {
+        string(name: 'TARGET', defaultValue: 'staging')
+    }
+    environment {
+        OUT_DIR = 'build'
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh "make OUT=${env.OUT_DIR} TARGET=${params.TARGET} REV=\$(git rev-parse HEAD)"
+                sh 'echo ${env.OUT_DIR} stays literal'
+                archiveArtifacts artifacts: "${env.OUT_DIR}/**/*.jar"
+                junit "${env.OUT_DIR}/reports/*.xml"
+            }
+        }
+    }
+}
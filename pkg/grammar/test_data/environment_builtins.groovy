@@ -0,0 +1,16 @@
+pipeline {
+    agent any
+    environment {
+        OUT_DIR = "${WORKSPACE}/out"
+        IMAGE_TAG = "build-${BUILD_NUMBER}"
+        RELEASE = "${JOB_NAME}-${env.BRANCH_NAME}"
+        NODE_HOME = "${NODE_NAME}/node"
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make OUT=$OUT_DIR TAG=$IMAGE_TAG'
+            }
+        }
+    }
+}
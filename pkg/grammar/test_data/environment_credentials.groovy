@@ -0,0 +1,19 @@
+pipeline {
+    agent any
+    environment {
+        APP_NAME = 'app'
+        DEPLOY_TOKEN = credentials('deploy-token')
+        REGISTRY = credentials('registry-login')
+    }
+    stages {
+        stage('Deploy') {
+            environment {
+                TARGET = 'staging'
+            }
+            steps {
+                sh 'deploy --app $APP_NAME --target $TARGET --token $DEPLOY_TOKEN'
+                sh 'docker login -u $REGISTRY_USR -p $REGISTRY_PSW'
+            }
+        }
+    }
+}
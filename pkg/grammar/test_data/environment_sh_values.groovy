@@ -0,0 +1,14 @@
+pipeline {
+    agent any
+    environment {
+        GIT_SHA = sh(script: 'git rev-parse HEAD', returnStdout: true).trim()
+        REGION = 'eu-west-1'
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'docker build -t app:$GIT_SHA .'
+            }
+        }
+    }
+}
@@ -0,0 +1,15 @@
+pipeline {
+    agent any
+    parameters {
+        string(name: 'TARGET', defaultValue: 'all', description: 'The make target')
+        file(name: 'CONFIG', description: 'The deployment config')
+        base64File(name: 'KEYSTORE')
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh "make ${params.TARGET}"
+            }
+        }
+    }
+}
@@ -0,0 +1,20 @@
+pipeline {
+    agent any
+    triggers {
+        GenericTrigger(
+            genericVariables: [
+                [key: 'REF', value: '$.ref'],
+                [key: 'PUSHER', value: '$.pusher.name']
+            ],
+            token: 'my-token',
+            causeString: 'Triggered by $PUSHER'
+        )
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'echo "Building $REF for $PUSHER"'
+            }
+        }
+    }
+}
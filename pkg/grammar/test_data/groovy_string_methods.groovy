@@ -0,0 +1,15 @@
+pipeline {
+    agent any
+    environment {
+        IMAGE = "${env.JOB_NAME}".toLowerCase()
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh "docker build -t app:${env.TAG.replaceAll('/', '-')} ."
+                sh "docker push app:${TAG.toUpperCase()}"
+                echo "Build ${env.BUILD_NUMBER} finished with ${currentBuild.result}"
+            }
+        }
+    }
+}
@@ -0,0 +1,43 @@
+pipeline {
+    agent any
+    environment {
+        APP = 'demo'
+        NOTES = '''first line
+  second line'''
+    }
+    stages {
+        stage('Build') {
+            agent {
+                kubernetes {
+                    yaml '''
+apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - name: maven
+    image: maven:3.9-eclipse-temurin-17
+'''
+                }
+            }
+            steps {
+                sh '''
+                    cat > config.yml <<'EOF'
+server:
+  hosts:
+    - "a"
+EOF
+                '''
+                container('maven') {
+                    sh 'mvn -B package'
+                }
+                sh 'make build'
+                archiveArtifacts artifacts: 'dist/**'
+            }
+            post {
+                failure {
+                    echo 'Build failed'
+                }
+            }
+        }
+    }
+}
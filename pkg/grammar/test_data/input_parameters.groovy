@@ -0,0 +1,20 @@
+pipeline {
+    agent any
+    stages {
+        stage('Deploy') {
+            input {
+                message 'Deploy to production?'
+                ok 'Deploy'
+                submitter 'release-managers'
+                submitterParameter 'APPROVER'
+                parameters {
+                    string(name: 'VERSION', defaultValue: '1.0.0', description: 'Version to deploy')
+                    choice(name: 'REGION', choices: ['eu-west-1', 'us-east-1'], description: 'Region')
+                }
+            }
+            steps {
+                sh './deploy.sh $VERSION $REGION'
+            }
+        }
+    }
+}
@@ -0,0 +1,18 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make'
+            }
+        }
+        stage('Approve') {
+            steps {
+                timeout(time: 1, unit: 'DAYS') {
+                    input 'Deploy to production?'
+                }
+                sh './deploy.sh'
+            }
+        }
+    }
+}
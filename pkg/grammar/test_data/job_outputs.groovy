@@ -0,0 +1,19 @@
+pipeline {
+    agent any
+    stages {
+        stage('Version') {
+            steps {
+                script {
+                    env.VERSION = sh(script: 'git describe --tags', returnStdout: true).trim()
+                    env.CHANNEL = readFile('channel.txt').trim()
+                }
+                sh 'echo "Building $VERSION"'
+            }
+        }
+        stage('Publish') {
+            steps {
+                sh "./publish.sh ${env.VERSION} ${CHANNEL}"
+            }
+        }
+    }
+}
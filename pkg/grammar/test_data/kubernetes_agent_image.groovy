@@ -0,0 +1,24 @@
+pipeline {
+    agent {
+        kubernetes {
+            yaml '''
+apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - name: golang
+    image: golang:1.21
+    command:
+    - cat
+    tty: true
+'''
+        }
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'go build ./...'
+            }
+        }
+    }
+}
@@ -0,0 +1,39 @@
+pipeline {
+    agent {
+        kubernetes {
+            yaml '''
+apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - name: maven
+    image: maven:3.9-eclipse-temurin-17
+  - name: node
+    image: node:20
+'''
+        }
+    }
+    stages {
+        stage('Build') {
+            steps {
+                container('maven') {
+                    sh 'mvn -B package'
+                }
+            }
+        }
+        stage('Frontend') {
+            steps {
+                container('node') {
+                    sh 'npm ci'
+                }
+            }
+        }
+        stage('Scan') {
+            steps {
+                container('trivy') {
+                    sh 'trivy fs .'
+                }
+            }
+        }
+    }
+}
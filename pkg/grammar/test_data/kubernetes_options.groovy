@@ -0,0 +1,14 @@
+pipeline {
+    agent any
+    options {
+        newContainerPerStage()
+        timeout(time: 30, unit: 'MINUTES')
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make'
+            }
+        }
+    }
+}
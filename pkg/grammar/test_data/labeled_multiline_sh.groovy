@@ -0,0 +1,17 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh(script: '''
+                    make deps
+                    make build
+                ''', label: 'Build')
+                sh(script: '''
+                    ./run-tests.sh
+                    ./upload-coverage.sh
+                ''', label: 'Test: unit', returnStatus: true)
+            }
+        }
+    }
+}
@@ -0,0 +1,12 @@
+pipeline {
+    agent any
+    stages {
+        stage('Deploy') {
+            steps {
+                sh 'make build'
+                milestone(1)
+                sh 'make deploy'
+            }
+        }
+    }
+}
@@ -0,0 +1,19 @@
+pipeline {
+    agent any
+    stages {
+        stage(
+            'Build'
+        ) {
+            steps {
+                sh 'make'
+                archiveArtifacts artifacts: 'dist/**',
+                    fingerprint: true,
+                    allowEmptyArchive: true
+                junit(
+                    testResults: 'reports/*.xml',
+                    allowEmptyResults: true
+                )
+            }
+        }
+    }
+}
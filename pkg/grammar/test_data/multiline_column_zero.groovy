@@ -0,0 +1,25 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh '''
+python3 - <<EOF
+if True:
+    print("x")
+EOF
+for f in *.txt; do
+  if [ -s "$f" ]; then
+      echo "$f"
+  fi
+done
+'''
+                sh """
+if [ -d build ]; then
+    rm -rf build
+fi
+"""
+            }
+        }
+    }
+}
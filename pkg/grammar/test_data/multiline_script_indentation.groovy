@@ -0,0 +1,16 @@
+pipeline {
+    agent any
+    stages {
+        stage('Report') {
+            steps {
+                sh '''
+                    python3 - <<'EOF'
+                    for name in ["a", "b"]:
+                        if name:
+                            print(name)
+                    EOF
+                '''
+            }
+        }
+    }
+}
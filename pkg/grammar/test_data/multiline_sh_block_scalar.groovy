@@ -0,0 +1,14 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh '''
+                    ./configure --prefix=/usr
+                    make -j4 && make check
+                    make install
+                '''
+            }
+        }
+    }
+}
@@ -0,0 +1,12 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sleep(time: 5, unit: 'SECONDS')
+                sh(script: 'make', returnStatus: false)
+                deployApp(replicas: 3, ratio: 0.5, dryRun: false, target: 'prod')
+            }
+        }
+    }
+}
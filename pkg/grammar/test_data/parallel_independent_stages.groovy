@@ -0,0 +1,27 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make dist'
+                stash name: 'dist', includes: 'dist/**'
+            }
+        }
+        stage('Lint') {
+            steps {
+                sh 'make lint'
+            }
+        }
+        stage('Docs') {
+            steps {
+                sh 'make docs'
+            }
+        }
+        stage('Deploy') {
+            steps {
+                unstash 'dist'
+                sh './deploy.sh'
+            }
+        }
+    }
+}
@@ -0,0 +1,19 @@
+pipeline {
+    agent any
+    stages {
+        stage('Test') {
+            steps {
+                script {
+                    parallel unit: {
+                        sh 'make unit'
+                    }, integration: {
+                        sh 'make integration'
+                        junit 'reports/*.xml'
+                    }, deploy: {
+                        build job: 'deploy-staging'
+                    }
+                }
+            }
+        }
+    }
+}
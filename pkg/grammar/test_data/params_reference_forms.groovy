@@ -0,0 +1,20 @@
+pipeline {
+    agent any
+    parameters {
+        string(name: 'VERSION', defaultValue: '1.0.0', description: 'Version')
+    }
+    environment {
+        VERSION = 'from-env'
+        APP_VERSION = params.VERSION
+        TAG = "v${params.VERSION}"
+    }
+    stages {
+        stage('Release') {
+            steps {
+                sh "release ${params.VERSION}"
+                sh "release $params.VERSION"
+                echo "Releasing ${params.VERSION}"
+            }
+        }
+    }
+}
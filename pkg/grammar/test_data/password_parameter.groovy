@@ -0,0 +1,14 @@
+pipeline {
+    agent any
+    parameters {
+        string(name: 'TARGET', defaultValue: 'staging', description: 'Where to deploy')
+        password(name: 'TOKEN', defaultValue: '', description: 'API token')
+    }
+    stages {
+        stage('Deploy') {
+            steps {
+                sh "deploy --target ${params.TARGET} --token ${params.TOKEN}"
+            }
+        }
+    }
+}
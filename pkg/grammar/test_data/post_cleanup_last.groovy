@@ -0,0 +1,21 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make'
+            }
+            post {
+                cleanup {
+                    sh 'rm -rf build'
+                }
+                always {
+                    sh 'make report'
+                }
+                failure {
+                    echo 'Build failed'
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,36 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make build'
+            }
+        }
+    }
+    post {
+        always {
+            sh 'echo always'
+        }
+        success {
+            sh 'echo success'
+        }
+        failure {
+            sh 'echo failure'
+        }
+        aborted {
+            sh 'echo aborted'
+        }
+        unsuccessful {
+            sh 'echo unsuccessful'
+        }
+        changed {
+            sh 'echo changed'
+        }
+        fixed {
+            sh 'echo fixed'
+        }
+        regression {
+            sh 'echo regression'
+        }
+    }
+}
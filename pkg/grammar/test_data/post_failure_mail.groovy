@@ -0,0 +1,18 @@
+pipeline {
+  agent any
+  stages {
+    stage('Build') {
+      steps { sh 'make' }
+      post {
+        failure {
+          mail to: 'team@example.com', subject: 'Build failed', body: 'See the log'
+        }
+      }
+    }
+  }
+  post {
+    failure {
+      mail to: 'team@example.com', subject: 'Pipeline failed', body: 'See the log'
+    }
+  }
+}
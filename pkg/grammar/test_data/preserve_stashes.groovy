@@ -0,0 +1,20 @@
+pipeline {
+    agent any
+    options {
+        preserveStashes(buildCount: 5)
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make dist'
+                stash name: 'dist', includes: 'dist/**'
+            }
+        }
+        stage('Deploy') {
+            steps {
+                unstash 'dist'
+                sh './deploy.sh dist'
+            }
+        }
+    }
+}
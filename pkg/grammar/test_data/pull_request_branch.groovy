@@ -0,0 +1,26 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make'
+            }
+        }
+        stage('Preview') {
+            when {
+                branch 'PR-*'
+            }
+            steps {
+                sh './preview.sh'
+            }
+        }
+        stage('Release') {
+            when {
+                branch 'main'
+            }
+            steps {
+                sh './release.sh'
+            }
+        }
+    }
+}
@@ -0,0 +1,16 @@
+pipeline {
+    agent any
+    environment {
+        VAR = 'value'
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'echo ${VAR} $HOME'
+                sh "echo ${VAR} \$HOME"
+                sh "echo ${params.TARGET}"
+                sh 'echo ${params.TARGET}'
+            }
+        }
+    }
+}
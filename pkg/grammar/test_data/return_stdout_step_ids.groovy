@@ -0,0 +1,21 @@
+pipeline {
+    agent any
+    stages {
+        stage('Version') {
+            steps {
+                sh(script: 'git describe --tags', returnStdout: true)
+                sh(script: 'git rev-parse HEAD', returnStdout: true)
+            }
+            post {
+                always {
+                    sh(script: 'date +%s', returnStdout: true)
+                }
+            }
+        }
+    }
+    post {
+        always {
+            sh(script: 'hostname', returnStdout: true)
+        }
+    }
+}
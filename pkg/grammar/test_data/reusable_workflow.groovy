@@ -0,0 +1,17 @@
+pipeline {
+    agent any
+    parameters {
+        string(name: 'TARGET', defaultValue: 'staging', description: 'Where to deploy')
+        booleanParam(name: 'DRY_RUN', defaultValue: true, description: 'Only print the changes')
+    }
+    environment {
+        DEPLOY_TOKEN = credentials('deploy-token')
+    }
+    stages {
+        stage('Deploy') {
+            steps {
+                sh "deploy --target ${params.TARGET} --dry-run=${params.DRY_RUN} --token \$DEPLOY_TOKEN"
+            }
+        }
+    }
+}
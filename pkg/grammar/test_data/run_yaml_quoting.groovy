@@ -0,0 +1,14 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'echo foo: bar'
+                sh 'make # all targets'
+                sh '-rm -f build.log'
+                sh 'true'
+                sh 'echo plain'
+            }
+        }
+    }
+}
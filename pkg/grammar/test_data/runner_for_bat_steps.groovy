@@ -0,0 +1,27 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make build'
+            }
+        }
+        stage('Package') {
+            steps {
+                bat 'msbuild /p:Configuration=Release'
+            }
+        }
+        stage('Docker') {
+            agent { label 'linux && docker' }
+            steps {
+                sh 'docker build .'
+            }
+        }
+        stage('Farm') {
+            agent { label 'build-farm' }
+            steps {
+                sh 'make farm'
+            }
+        }
+    }
+}
@@ -0,0 +1,18 @@
+pipeline {
+    agent any
+    stages {
+        stage('Test') {
+            steps {
+                sh 'echo testing'
+                sh 'npm ci && npm test'
+                sh 'npm run build'
+            }
+        }
+        stage('Site') {
+            steps {
+                sh 'nvm use $(cat .nvmrc)'
+                sh 'yarn install && yarn build'
+            }
+        }
+    }
+}
@@ -0,0 +1,15 @@
+pipeline {
+    agent any
+    stages {
+        stage('Deploy') {
+            steps {
+                sh 'deploy --build=$BUILD_NUMBER --branch=${BRANCH_NAME}'
+                sh '''
+                    WORKSPACE=/tmp/deploy
+                    cp app.tar $WORKSPACE
+                    echo $GIT_COMMIT
+                '''
+            }
+        }
+    }
+}
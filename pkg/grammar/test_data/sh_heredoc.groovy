@@ -0,0 +1,32 @@
+pipeline {
+    agent any
+    stages {
+        stage('Config') {
+            steps {
+                sh '''
+                    cat > config.yml <<EOF
+server:
+  port: 8080
+    # nested comment
+EOF
+                    cat config.yml
+                '''
+                sh '''cat <<EOF > out.txt
+  indented
+EOF
+'''
+                sh '''
+cat <<'EOF' > script.py
+def main():
+    print("$HOME")
+EOF
+python3 script.py
+'''
+                sh """cat > notes.txt <<EOF
+  build ${env.BUILD_NUMBER}
+EOF
+                """
+            }
+        }
+    }
+}
@@ -0,0 +1,11 @@
+pipeline {
+    agent any
+    stages {
+        stage('Test') {
+            steps {
+                sh(script: 'make test', returnStatus: true, encoding: 'UTF-8', label: 'Tests', foo: 'bar')
+                sh(script: 'git rev-parse HEAD', returnStdout: true, label: 'Commit', encoding: 'ISO-8859-1')
+            }
+        }
+    }
+}
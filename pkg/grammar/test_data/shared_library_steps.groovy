@@ -0,0 +1,12 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                buildApp(target: 'release', skipTests: false)
+                sh 'make package'
+                notifyTeam 'builds'
+            }
+        }
+    }
+}
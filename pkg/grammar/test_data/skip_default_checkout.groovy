@@ -0,0 +1,19 @@
+pipeline {
+    agent any
+    options {
+        skipDefaultCheckout()
+    }
+    stages {
+        stage('Lint') {
+            steps {
+                sh 'echo no sources needed'
+            }
+        }
+        stage('Build') {
+            steps {
+                checkout scm
+                sh 'make build'
+            }
+        }
+    }
+}
@@ -0,0 +1,19 @@
+pipeline {
+    agent any
+    environment {
+        ZONE = 'eu-west-1'
+        APP = 'web'
+        MODE = 'release'
+    }
+    stages {
+        stage('Build') {
+            environment {
+                VERBOSE = 'true'
+                CACHE_DIR = '/tmp/cache'
+            }
+            steps {
+                sh 'make'
+            }
+        }
+    }
+}
@@ -0,0 +1,13 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make && make test'
+                sh 'cd app && (npm ci && npm test) && echo "done && dusted"'
+                sh 'npm ci && (npm test && npm run e2e) && echo "done && dusted"'
+                sh 'make lint || true'
+            }
+        }
+    }
+}
@@ -0,0 +1,22 @@
+pipeline {
+    agent { docker { image 'golang:1.21' } }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'go build ./...'
+            }
+        }
+        stage('Frontend') {
+            agent { docker { image 'node:20' } }
+            steps {
+                sh 'npm ci'
+            }
+        }
+        stage('Lint') {
+            agent { docker { image 'python:3.12' } }
+            steps {
+                sh 'ruff check .'
+            }
+        }
+    }
+}
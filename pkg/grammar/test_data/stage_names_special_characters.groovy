@@ -0,0 +1,20 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build: API') {
+            steps {
+                sh 'make api'
+            }
+        }
+        stage('Build/API') {
+            steps {
+                sh 'make api-image'
+            }
+        }
+        stage("Deploy \"prod\"") {
+            steps {
+                sh './deploy.sh'
+            }
+        }
+    }
+}
@@ -0,0 +1,28 @@
+pipeline {
+    agent any
+    options {
+        timeout(time: 1, unit: 'HOURS')
+    }
+    stages {
+        stage('Build') {
+            options {
+                timeout(time: 10, unit: 'MINUTES')
+                retry(3)
+            }
+            steps {
+                sh 'make'
+                sh 'make test'
+            }
+        }
+        stage('Deploy') {
+            options {
+                timeout(time: 2, unit: 'HOURS')
+                skipDefaultCheckout()
+                disableConcurrentBuilds()
+            }
+            steps {
+                sh './deploy.sh'
+            }
+        }
+    }
+}
@@ -0,0 +1,13 @@
+pipeline {
+    agent any
+    options {
+        timeout(time: 10, unit: 'MINUTES', activity: true)
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make build'
+            }
+        }
+    }
+}
@@ -0,0 +1,15 @@
+pipeline {
+    agent any
+    triggers {
+        cron('H 2 * * 1-5')
+        pollSCM('H/5 * * * *')
+        upstream(upstreamProjects: 'app-build, lib-build', threshold: hudson.model.Result.SUCCESS)
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make'
+            }
+        }
+    }
+}
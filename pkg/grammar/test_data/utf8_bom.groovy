@@ -0,0 +1,10 @@
+﻿pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                echo 'Building'
+            }
+        }
+    }
+}
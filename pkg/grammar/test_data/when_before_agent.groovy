@@ -0,0 +1,21 @@
+pipeline {
+    agent any
+    stages {
+        stage('Deploy') {
+            agent { label 'linux' }
+            when {
+                beforeAgent true
+                branch 'main'
+            }
+            steps {
+                sh './deploy.sh'
+            }
+        }
+        stage('Release') {
+            when { beforeAgent true; branch 'main' }
+            steps {
+                sh './release.sh'
+            }
+        }
+    }
+}
@@ -0,0 +1,11 @@
+pipeline {
+    agent any
+    stages {
+        stage('Frontend') {
+            when { changeset '**/*.js' }
+            steps {
+                sh 'npm test'
+            }
+        }
+    }
+}
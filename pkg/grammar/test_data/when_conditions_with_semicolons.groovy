@@ -0,0 +1,17 @@
+pipeline {
+    agent any
+    stages {
+        stage('Deploy') {
+            when { anyOf { branch 'main'; branch 'develop' } }
+            steps {
+                sh 'make deploy'
+            }
+        }
+        stage('Preview') {
+            when { not { branch 'main'; }; beforeAgent true }
+            steps {
+                sh 'make preview'
+            }
+        }
+    }
+}
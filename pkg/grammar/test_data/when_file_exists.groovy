@@ -0,0 +1,26 @@
+pipeline {
+    agent any
+    stages {
+        stage('Maven') {
+            when {
+                expression { return fileExists('pom.xml') }
+            }
+            steps {
+                sh 'mvn -B verify'
+            }
+            post {
+                always {
+                    junit 'target/surefire-reports/*.xml'
+                }
+            }
+        }
+        stage('Make') {
+            when {
+                expression { !fileExists('pom.xml') }
+            }
+            steps {
+                sh 'make'
+            }
+        }
+    }
+}
@@ -0,0 +1,19 @@
+pipeline {
+    agent any
+    stages {
+        stage('Preview') {
+            when {
+                not { branch 'master' }
+            }
+            steps {
+                sh './preview.sh'
+            }
+        }
+        stage('Release') {
+            when { branch 'master' }
+            steps {
+                sh './release.sh'
+            }
+        }
+    }
+}
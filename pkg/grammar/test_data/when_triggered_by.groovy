@@ -0,0 +1,37 @@
+pipeline {
+    agent any
+    triggers {
+        cron('0 3 * * *')
+    }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make'
+            }
+        }
+        stage('Nightly') {
+            when {
+                triggeredBy 'TimerTrigger'
+            }
+            steps {
+                sh 'make nightly'
+            }
+        }
+        stage('Manual') {
+            when {
+                triggeredBy cause: 'UserIdCause', detail: 'release-manager'
+            }
+            steps {
+                sh 'make release'
+            }
+        }
+        stage('Upstream') {
+            when {
+                triggeredBy 'UpstreamCause'
+            }
+            steps {
+                sh 'make downstream'
+            }
+        }
+    }
+}
@@ -0,0 +1,22 @@
+pipeline {
+    agent none
+    stages {
+        stage('Build') {
+            agent { label 'linux' }
+            steps {
+                sh 'make build'
+            }
+        }
+        stage('Package') {
+            agent { label 'windows' }
+            options {
+                retry(2)
+            }
+            steps {
+                sh './package.sh'
+                bat 'dir dist'
+                powershell 'Get-ChildItem dist'
+            }
+        }
+    }
+}
@@ -0,0 +1,15 @@
+pipeline {
+    agent any
+    stages {
+        stage('Build') {
+            steps {
+                sh 'mkdir -p build && make > build/output.txt'
+            }
+        }
+        stage('Report') {
+            steps {
+                sh 'cat build/output.txt'
+            }
+        }
+    }
+}
@@ -0,0 +1,29 @@
+pipeline {
+    agent { label 'on-prem' }
+    stages {
+        stage('Build') {
+            steps {
+                sh 'make build'
+                dir('out') {
+                    deleteDir()
+                }
+            }
+        }
+        stage('Clean') {
+            steps {
+                cleanWs(patterns: [[pattern: '*.tmp', type: 'INCLUDE']])
+            }
+        }
+        stage('Hosted') {
+            agent { label 'linux' }
+            steps {
+                deleteDir()
+            }
+        }
+    }
+    post {
+        always {
+            cleanWs()
+        }
+    }
+}
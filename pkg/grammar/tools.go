@@ -0,0 +1,290 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Matches `tool` step calls inside a script block, optionally assigned to a variable, in either the positional
+	// (`tool 'maven3'`) or named (`tool name: 'maven3', type: 'maven'`) form.
+	toolCallInScriptRegexp = regexp.MustCompile(`(?:(\w+)\s*=\s*)?\btool\s*\(?\s*(?:name\s*:\s*)?['"]([^'"]+)['"](?:\s*,\s*type\s*:\s*['"]([^'"]+)['"])?`)
+	trailingVersionRegexp  = regexp.MustCompile(`(\d+(\.\d+)*)$`)
+	// Matches the commands of a shell script that need Node.js, like `npm ci` or `yarn test`
+	nodeCommandRegexp = regexp.MustCompile(`(?m)(^|[\s;&|(])(node|npm|npx|yarn|pnpm)(\s|;|\)|$)`)
+	// Matches references to .nvmrc, the file holding the Node.js version of a project, like `nvm use` reads
+	nvmrcRegexp = regexp.MustCompile(`\.nvmrc\b|\bnvm\s+(use|install)\b`)
+)
+
+var (
+	// The commands running Maven and Gradle, and the name of each tool
+	buildToolCommands = map[string]string{
+		"mvn":       "Maven",
+		"mvnw":      "Maven",
+		"./mvnw":    "Maven",
+		"gradle":    "Gradle",
+		"gradlew":   "Gradle",
+		"./gradlew": "Gradle",
+	}
+	// Options of Maven and Gradle whose value is the next argument, which isn't a goal or task
+	buildToolOptionsWithValue = []string{
+		"-f", "--file", "-s", "--settings", "-gs", "--global-settings", "-P", "--activate-profiles", "-pl", "--projects",
+		"-rf", "--resume-from", "-T", "--threads", "-l", "--log-file", "-b", "--build-file", "-c", "--settings-file",
+		"-x", "--exclude-task", "-p", "--project-dir", "-g", "--gradle-user-home", "-I", "--init-script",
+	}
+)
+
+// buildToolStepName names a step running Maven or Gradle after the goals or tasks it runs, like `Maven package` for
+// `mvn -B clean package`. The clean goal is left out unless it's the only one, since it's run before most builds.
+// Commands running anything else, or more than the build tool, have no name.
+func buildToolStepName(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) < 2 || strings.ContainsAny(command, "&|;$`<>") {
+		return ""
+	}
+	tool, ok := buildToolCommands[fields[0]]
+	if !ok {
+		return ""
+	}
+	var goals []string
+	for i := 1; i < len(fields); i++ {
+		switch {
+		case containsString(buildToolOptionsWithValue, fields[i]):
+			i++
+		case strings.HasPrefix(fields[i], "-"):
+		case fields[i] != "clean":
+			goals = append(goals, fields[i])
+		}
+	}
+	if len(goals) == 0 && containsString(fields[1:], "clean") {
+		goals = []string{"clean"}
+	}
+	if len(goals) == 0 {
+		return ""
+	}
+	return tool + " " + strings.Join(goals, " ")
+}
+
+// defaultNodeVersion is the version of Node.js set up when the Jenkinsfile doesn't tell which one it uses
+const defaultNodeVersion = "18"
+
+// jenkinsTool is a tool resolved through the Jenkins `tool` step
+type jenkinsTool struct {
+	Name     string
+	Type     string
+	Variable string
+}
+
+// toolFromStep reads the tool name and type from a `tool` step, in either the positional or named-arg form.
+func toolFromStep(step *ModelStep) jenkinsTool {
+	t := jenkinsTool{
+		Name: step.getNamedArg("name"),
+		Type: step.getNamedArg("type"),
+	}
+	if t.Name == "" {
+		t.Name = step.getArg()
+	}
+	return t
+}
+
+// toolsFromScript finds the `tool` step calls inside the escaped text of a script block.
+func toolsFromScript(escaped string) []jenkinsTool {
+	var tools []jenkinsTool
+	for _, match := range toolCallInScriptRegexp.FindAllStringSubmatch(unescapeMultiline(escaped), -1) {
+		tools = append(tools, jenkinsTool{
+			Variable: match[1],
+			Name:     match[2],
+			Type:     match[3],
+		})
+	}
+	return tools
+}
+
+// kind guesses which kind of tool this is, based on its type if given and its name otherwise.
+func (t jenkinsTool) kind() string {
+	for _, s := range []string{t.Type, t.Name} {
+		s = strings.ToLower(s)
+		switch {
+		case strings.Contains(s, "maven") || strings.Contains(s, "mvn"):
+			return "maven"
+		case strings.Contains(s, "gradle"):
+			return "gradle"
+		case strings.Contains(s, "jdk") || strings.Contains(s, "java"):
+			return "jdk"
+		case strings.Contains(s, "node"):
+			return "nodejs"
+		case strings.Contains(s, "python"):
+			return "python"
+		case s == "go" || strings.Contains(s, "golang"):
+			return "go"
+		}
+	}
+	return ""
+}
+
+// version returns the version number at the end of the tool name (e.g. `jdk11`), if any.
+func (t jenkinsTool) version() string {
+	return trailingVersionRegexp.FindString(t.Name)
+}
+
+// referencedIn checks if the variable the tool home was assigned to is used in the given shell command.
+func (t jenkinsTool) referencedIn(command string) bool {
+	if t.Variable == "" {
+		return false
+	}
+	return regexp.MustCompile(`\$\{?` + regexp.QuoteMeta(t.Variable) + `\b`).MatchString(command)
+}
+
+// linesForToolSetup emits the setup action that puts the equivalent of a Jenkins tool installation on the PATH.
+func linesForToolSetup(t jenkinsTool, indent int, settings conversionSettings) ([]string, bool) {
+	var setupLines []string
+	switch t.kind() {
+	case "maven", "gradle", "jdk":
+		javaVersion := "17"
+		if t.kind() == "jdk" && t.version() != "" {
+			javaVersion = t.version()
+		}
+		cache := ""
+		if t.kind() != "jdk" {
+			cache = t.kind()
+		}
+		setupLines = linesForSetupJava(javaVersion, cache, indent, settings)
+	case "nodejs":
+		nodeVersion := defaultNodeVersion
+		if t.version() != "" {
+			nodeVersion = t.version()
+		}
+		setupLines = append(setupLines, indentLine("uses: "+settings.action("actions/setup-node"), indent+2))
+		setupLines = append(setupLines, indentLine("with:", indent+2))
+		setupLines = append(setupLines, indentLine(fmt.Sprintf("node-version: '%s'", nodeVersion), indent+3))
+	case "python":
+		pythonVersion := "3.x"
+		if t.version() != "" {
+			pythonVersion = t.version()
+		}
+		setupLines = append(setupLines, indentLine("uses: "+settings.action("actions/setup-python"), indent+2))
+		setupLines = append(setupLines, indentLine("with:", indent+2))
+		setupLines = append(setupLines, indentLine(fmt.Sprintf("python-version: '%s'", pythonVersion), indent+3))
+	case "go":
+		setupLines = append(setupLines, indentLine("uses: "+settings.action("actions/setup-go"), indent+2))
+		setupLines = append(setupLines, indentLine("with:", indent+2))
+		setupLines = append(setupLines, indentLine("go-version: 'stable'", indent+3))
+	default:
+		var stepLines []string
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("# The Jenkins tool '%s' has no known setup action on GitHub runners.", t.Name), indent+2))
+		stepLines = append(stepLines, indentLine("# Please install it in a step of your own, or make sure it is available on the runner.", indent+2))
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("run: echo 'Unknown tool %s, failing' && exit 1", t.Name), indent+2))
+		return stepLines, true
+	}
+
+	var stepLines []string
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("# The Jenkins tool '%s' is installed with a setup action. Please check that the version matches your Jenkins tool configuration.", t.Name), indent+2))
+	if t.Variable != "" {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("# The tool home was assigned to '%s' in Jenkins. The setup action puts the tool on the PATH instead, so paths built from it may differ on GitHub runners.", t.Variable), indent+2))
+	}
+	return append(stepLines, setupLines...), false
+}
+
+var (
+	// Build tool wrapper steps, and the setup-java cache they map to
+	buildToolWrappers = map[string]string{
+		"withMaven":  "maven",
+		"withGradle": "gradle",
+	}
+
+	// Arguments of the build tool wrappers that map to setup-java inputs
+	buildToolWrapperMappedArgs = []string{
+		"jdk",
+	}
+)
+
+func isBuildToolWrapper(step *ModelStep) bool {
+	_, ok := buildToolWrappers[step.Name]
+	return ok
+}
+
+// linesForBuildToolWrapper emits the setup-java step replacing a withMaven or withGradle wrapper. The wrapped steps
+// are converted separately.
+func linesForBuildToolWrapper(step *ModelStep, indent int, settings conversionSettings) []string {
+	var stepLines []string
+
+	javaVersion := "17"
+	if jdk := step.getNamedArg("jdk"); jdk != "" {
+		if v := (jenkinsTool{Name: jdk}).version(); v != "" {
+			javaVersion = v
+		} else {
+			stepLines = append(stepLines, indentLine(fmt.Sprintf("# The JDK '%s' has no version in its name, so Java %s is used. Please check that it matches your Jenkins JDK installation.", jdk, javaVersion), indent+2))
+		}
+	}
+	if maven := step.getNamedArg("maven"); maven != "" {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("# The Maven installation '%s' isn't set up, since Maven is preinstalled on GitHub runners. Use the Maven wrapper if you need a specific version.", maven), indent+2))
+	}
+	for _, a := range step.Args {
+		if a.Named == nil || a.Named.Key == "maven" {
+			continue
+		}
+		if !isSupportedField(a.Named.Key, buildToolWrapperMappedArgs, false) {
+			stepLines = append(stepLines, indentLine(fmt.Sprintf("# The argument '%s' of the Jenkins Pipeline step %s has no equivalent in actions/setup-java and is not converted.", a.Named.Key, step.Name), indent+2))
+		}
+	}
+
+	return append(stepLines, linesForSetupJava(javaVersion, buildToolWrappers[step.Name], indent, settings)...)
+}
+
+// linesForSetupJava emits an actions/setup-java step, with dependency caching for the given build tool if any
+func linesForSetupJava(javaVersion string, cache string, indent int, settings conversionSettings) []string {
+	var stepLines []string
+	stepLines = append(stepLines, indentLine("uses: "+settings.action("actions/setup-java"), indent+2))
+	stepLines = append(stepLines, indentLine("with:", indent+2))
+	stepLines = append(stepLines, indentLine("distribution: temurin", indent+3))
+	stepLines = append(stepLines, indentLine(fmt.Sprintf("java-version: '%s'", javaVersion), indent+3))
+	if cache != "" {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("cache: %s", cache), indent+3))
+	}
+	return stepLines
+}
+
+// nodePackageManager returns the package manager the Node.js commands of a shell script use, whose dependencies
+// setup-node can cache, and false if the script runs no Node.js commands. Scripts that only run node have none.
+func nodePackageManager(script string) (string, bool) {
+	packageManager := ""
+	found := false
+	for _, match := range nodeCommandRegexp.FindAllStringSubmatch(script, -1) {
+		found = true
+		command := match[2]
+		if command == "npx" {
+			command = "npm"
+		}
+		if packageManager == "" && command != "node" {
+			packageManager = command
+		}
+	}
+	return packageManager, found
+}
+
+// linesForSetupNode emits an actions/setup-node step for the Node.js commands of the sh steps of a job. The version
+// is read from .nvmrc if the scripts refer to it, and dependencies are cached for the package manager they use.
+func linesForSetupNode(packageManager string, usesNvmrc bool, indent int, settings conversionSettings) []string {
+	var stepLines []string
+	stepLines = append(stepLines, indentLine("# The sh steps run Node.js commands, so Node.js is set up before the first of them.", indent+2))
+	if !usesNvmrc {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("# The Jenkinsfile doesn't tell which version of Node.js it uses, so %s is set up. Please check that it matches yours.", defaultNodeVersion), indent+2))
+	}
+	if packageManager == "pnpm" {
+		stepLines = append(stepLines, indentLine("# setup-node can only cache the dependencies of pnpm once it is installed, like with pnpm/action-setup, so they aren't cached.", indent+2))
+	} else if packageManager != "" {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("# Caching the dependencies of %s needs its lock file in the repository.", packageManager), indent+2))
+	}
+	stepLines = append(stepLines, indentLine("uses: "+settings.action("actions/setup-node"), indent+2))
+	stepLines = append(stepLines, indentLine("with:", indent+2))
+	if usesNvmrc {
+		stepLines = append(stepLines, indentLine("node-version-file: .nvmrc", indent+3))
+	} else {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("node-version: '%s'", defaultNodeVersion), indent+3))
+	}
+	if packageManager == "npm" || packageManager == "yarn" {
+		stepLines = append(stepLines, indentLine(fmt.Sprintf("cache: %s", packageManager), indent+3))
+	}
+	return stepLines
+}
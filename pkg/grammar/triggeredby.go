@@ -0,0 +1,70 @@
+package grammar
+
+import (
+	"fmt"
+)
+
+// The events of a workflow run that stand in for the causes of a Jenkins build, by the names triggeredBy matches
+// causes with
+var triggeredByEvents = map[string]string{
+	"TimerTrigger":      "schedule",
+	"TimerTriggerCause": "schedule",
+	"UserIdCause":       "workflow_dispatch",
+}
+
+// triggeredByCondition is a when condition matching the cause of the build
+type triggeredByCondition struct {
+	Cause string
+	// Detail is the user starting the build, for the UserIdCause
+	Detail string
+}
+
+// getTriggeredBy returns the cause a triggeredBy condition matches, given either as just the cause, like
+// `triggeredBy 'TimerTrigger'`, or as named arguments, like `triggeredBy cause: 'UserIdCause', detail: 'admin'`. It
+// returns false for any other condition.
+func (m *ModelWhen) getTriggeredBy() (triggeredByCondition, bool) {
+	if m == nil || len(m.TriggeredBy) == 0 {
+		return triggeredByCondition{}, false
+	}
+	var c triggeredByCondition
+	for _, a := range m.TriggeredBy {
+		switch {
+		case a.Unnamed != nil && a.Unnamed.String != nil:
+			c.Cause = unescapeArg(removeQuotesAndTrim(*a.Unnamed.String))
+		case a.Named != nil && a.Named.Key == "cause" && a.Named.Value.String != nil:
+			c.Cause = unescapeArg(removeQuotesAndTrim(*a.Named.Value.String))
+		case a.Named != nil && a.Named.Key == "detail" && a.Named.Value.String != nil:
+			c.Detail = unescapeArg(removeQuotesAndTrim(*a.Named.Value.String))
+		default:
+			return triggeredByCondition{}, false
+		}
+	}
+	return c, c.Cause != ""
+}
+
+// event returns the event of a workflow run standing in for the cause, and false if there is none
+func (c triggeredByCondition) event() (string, bool) {
+	event, ok := triggeredByEvents[c.Cause]
+	return event, ok
+}
+
+// condition returns the condition the job of the stage runs on, which checks the event of the workflow run, and the
+// user starting it for a detailed UserIdCause
+func (c triggeredByCondition) condition() string {
+	event, _ := c.event()
+	condition := fmt.Sprintf("github.event_name == '%s'", event)
+	if event == "workflow_dispatch" && c.Detail != "" {
+		condition += fmt.Sprintf(" && github.actor == '%s'", c.Detail)
+	}
+	return condition
+}
+
+// comments describes the condition on the job of the stage, warning if the workflow has no trigger for its event
+func (c triggeredByCondition) comments(triggered bool) []string {
+	event, _ := c.event()
+	comments := []string{fmt.Sprintf("# The Jenkinsfile runs this stage only on builds triggered by %s, which are runs on the %s event here.", c.Cause, event)}
+	if !triggered {
+		comments = append(comments, fmt.Sprintf("# WARNING: The workflow has no %s trigger, so this job doesn't run until one is added.", event))
+	}
+	return comments
+}
@@ -0,0 +1,319 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/participle"
+)
+
+// ModelTrigger represents a trigger of the triggers directive, like `cron('H 4 * * 1-5')`
+type ModelTrigger struct {
+	Type string          `parser:"@Ident" json:"type,omitempty"`
+	Args []*ModelCallArg `parser:"\"(\" ( @@ { \",\" @@ } )? \")\"" json:"args,omitempty"`
+}
+
+// modelTriggers represents the body of the triggers directive
+type modelTriggers struct {
+	Triggers []*ModelTrigger `parser:"{ @@ }"`
+}
+
+var (
+	// The cron aliases Jenkins supports, which GitHub Actions doesn't
+	cronAliases = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+	// The value the hashed H stands for in each field of a cron schedule, the first one the field allows
+	cronHashValues = []string{"0", "0", "1", "1", "0"}
+	// Matches a hashed value within a range, like `H(0-29)`
+	cronHashRangeRegexp = regexp.MustCompile(`H\((\d+)-(\d+)\)`)
+	// Matches a build result constant, like the `hudson.model.Result.SUCCESS` threshold of an upstream trigger, which
+	// is read as the name of the result
+	buildResultConstantRegexp = regexp.MustCompile(`\b(?:hudson\.model\.)?Result\.([A-Z_]+)\b`)
+)
+
+// getTriggerDirectives returns the triggers of the triggers directives the pipeline has, and whether they could all
+// be read. The directive is escaped like unsupported ones, so that triggers the grammar can't parse don't fail the
+// whole Jenkinsfile.
+func (m *Model) getTriggerDirectives() ([]*ModelTrigger, bool) {
+	var triggers []*ModelTrigger
+	for _, u := range m.getUnsupported() {
+		if u.Name != "triggers" {
+			continue
+		}
+		parser, err := participle.Build(&modelTriggers{})
+		if err != nil {
+			return nil, false
+		}
+		model := &modelTriggers{}
+		text := buildResultConstantRegexp.ReplaceAllString(unescapeMultiline(u.Value), "'$1'")
+		if err := parser.ParseString(escapeSingleQuotedOrMultilineStrings(text), model); err != nil {
+			return nil, false
+		}
+		triggers = append(triggers, model.Triggers...)
+	}
+	return triggers, true
+}
+
+// getNamedArg returns the value of the trigger's named argument, if it is a string
+func (m *ModelTrigger) getNamedArg(key string) string {
+	for _, a := range m.Args {
+		if a.Arg != nil && a.Arg.Named != nil && a.Arg.Named.Key == key && a.Arg.Named.Value != nil && a.Arg.Named.Value.String != nil {
+			return unescapeArg(*a.Arg.Named.Value.String)
+		}
+	}
+	return ""
+}
+
+// getUpstreamProjects returns the jobs an upstream trigger waits for, like the `app, lib` of
+// `upstream(upstreamProjects: 'app, lib')`
+func (m *ModelTrigger) getUpstreamProjects() []string {
+	var projects []string
+	for _, p := range strings.Split(m.getNamedArg("upstreamProjects"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			projects = append(projects, p)
+		}
+	}
+	return projects
+}
+
+// getVariableKeys returns the keys of the variables a list argument of a GenericTrigger declares, like the `ref` of
+// `genericVariables: [[key: 'ref', value: '$.ref']]`
+func (m *ModelTrigger) getVariableKeys(arg string) []string {
+	var keys []string
+	for _, a := range m.Args {
+		if a.Arg == nil || a.Arg.Named == nil || a.Arg.Named.Key != arg || a.Arg.Named.Value == nil {
+			continue
+		}
+		for _, variable := range a.Arg.Named.Value.List {
+			if variable.Arg == nil || variable.Arg.Unnamed == nil {
+				continue
+			}
+			for _, field := range variable.Arg.Unnamed.List {
+				if field.Arg != nil && field.Arg.Named != nil && field.Arg.Named.Key == "key" && field.Arg.Named.Value.String != nil {
+					keys = append(keys, unescapeArg(*field.Arg.Named.Value.String))
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// getGenericTriggerEnv returns the environment variables the GenericTrigger triggers of the pipeline set from the
+// content of their webhook's request, read from the payload of the repository_dispatch event instead. Those the
+// pipeline sets itself are left to it.
+func (m *Model) getGenericTriggerEnv() []string {
+	triggers, ok := m.getTriggerDirectives()
+	if !ok {
+		return nil
+	}
+	var lines []string
+	for _, t := range triggers {
+		if t.Type != "GenericTrigger" {
+			continue
+		}
+		for _, key := range t.getVariableKeys("genericVariables") {
+			if !m.definesVariable(key) {
+				lines = append(lines, fmt.Sprintf("- %s: ${{ github.event.client_payload.%s }}", key, key))
+			}
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// getSpec returns the schedule of a cron trigger, like the `H 4 * * 1-5` of `cron('H 4 * * 1-5')`
+func (m *ModelTrigger) getSpec() string {
+	for _, a := range m.Args {
+		if a.Arg == nil {
+			continue
+		}
+		if a.Arg.Unnamed != nil && a.Arg.Unnamed.String != nil {
+			return unescapeArg(*a.Arg.Unnamed.String)
+		}
+		if a.Arg.Named != nil && a.Arg.Named.Key == "spec" && a.Arg.Named.Value != nil && a.Arg.Named.Value.String != nil {
+			return unescapeArg(*a.Arg.Named.Value.String)
+		}
+	}
+	return ""
+}
+
+// toGitHubCron converts a Jenkins cron schedule into one GitHub Actions accepts, replacing aliases and the hashed H,
+// which GitHub Actions doesn't know. It also returns whether H was replaced.
+func toGitHubCron(spec string) (string, bool, bool) {
+	if alias, ok := cronAliases[spec]; ok {
+		return alias, false, true
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return "", false, false
+	}
+	hashed := false
+	for i, f := range fields {
+		if !strings.Contains(f, "H") {
+			continue
+		}
+		hashed = true
+		f = cronHashRangeRegexp.ReplaceAllStringFunc(f, func(r string) string {
+			match := cronHashRangeRegexp.FindStringSubmatch(r)
+			if strings.Contains(f, r+"/") {
+				return match[1] + "-" + match[2]
+			}
+			return match[1]
+		})
+		f = strings.ReplaceAll(f, "H/", "*/")
+		fields[i] = strings.ReplaceAll(f, "H", cronHashValues[i])
+	}
+	return strings.Join(fields, " "), hashed, true
+}
+
+// linesForTriggers converts the pipeline's cron triggers into a schedule the workflow runs on, and its upstream
+// triggers into a workflow_run trigger. Polling isn't needed, since pushes trigger the workflow. Other triggers are
+// noted as not converted.
+func linesForTriggers(triggers []*ModelTrigger, indent int, settings conversionSettings) ([]string, bool) {
+	var lines []string
+	var crons []string
+	var upstreamProjects []string
+	var thresholds []string
+	conversionIssues := false
+	for _, t := range triggers {
+		if t.Type == "pollSCM" {
+			if spec := t.getSpec(); spec != "" {
+				lines = append(lines, indentLine(fmt.Sprintf("# The Jenkins trigger pollSCM polls the repository for changes on the schedule '%s'.", strings.Join(splitLines(spec), "; ")), indent))
+			}
+			lines = append(lines, indentLine("# GitHub triggers the workflow on each push and pull request instead, so no polling is needed.", indent))
+			continue
+		}
+		if t.Type == "upstream" {
+			projects := t.getUpstreamProjects()
+			if len(projects) == 0 {
+				conversionIssues = true
+				settings.addIssue("the trigger upstream, without upstreamProjects")
+				lines = append(lines, indentLine("# The Jenkins trigger upstream has no upstreamProjects to run after, so it is not converted.", indent))
+				continue
+			}
+			for _, p := range projects {
+				upstreamProjects = appendIfMissing(upstreamProjects, p)
+			}
+			if threshold := t.getNamedArg("threshold"); threshold != "" {
+				thresholds = appendIfMissing(thresholds, threshold)
+			}
+			continue
+		}
+		if t.Type == "GenericTrigger" {
+			lines = append(lines, linesForGenericTrigger(t, indent)...)
+			continue
+		}
+		if t.Type != "cron" {
+			conversionIssues = true
+			settings.addIssue("the trigger %s", t.Type)
+			lines = append(lines, indentLine(fmt.Sprintf("# The Jenkins trigger %s is not converted.", t.Type), indent))
+			continue
+		}
+		for _, spec := range splitLines(t.getSpec()) {
+			if strings.HasPrefix(spec, "#") {
+				continue
+			}
+			if strings.HasPrefix(spec, "TZ=") {
+				lines = append(lines, indentLine(fmt.Sprintf("# The Jenkins cron trigger sets the time zone %s, but schedules run in UTC on GitHub Actions.", strings.TrimPrefix(spec, "TZ=")), indent))
+				continue
+			}
+			cron, hashed, ok := toGitHubCron(spec)
+			if !ok {
+				conversionIssues = true
+				settings.addIssue("the cron trigger '%s'", spec)
+				lines = append(lines, indentLine(fmt.Sprintf("# The Jenkins cron trigger '%s' can't be read and is not converted.", spec), indent))
+				continue
+			}
+			if hashed {
+				lines = append(lines, indentLine(fmt.Sprintf("# The Jenkins cron trigger '%s' spreads its time with H, which GitHub Actions doesn't have, so a fixed time is used.", spec), indent))
+			}
+			crons = append(crons, cron)
+		}
+	}
+	if len(crons) > 0 {
+		lines = append(lines, indentLine("schedule:", indent))
+		for _, c := range crons {
+			lines = append(lines, indentLine(fmt.Sprintf("- cron: %s", yamlQuote(c)), indent+1))
+		}
+	}
+	if len(upstreamProjects) > 0 {
+		lines = append(lines, linesForUpstreamTrigger(upstreamProjects, thresholds, indent)...)
+	}
+	return lines, conversionIssues
+}
+
+// linesForGenericTrigger converts a GenericTrigger, which runs the pipeline when its webhook is called, into a
+// repository_dispatch trigger. The variables it takes from the request's JSON body are read from the event's payload
+// instead, while those it takes from the request's parameters and headers have no equivalent.
+func linesForGenericTrigger(trigger *ModelTrigger, indent int) []string {
+	lines := []string{
+		indentLine("# The Jenkins trigger GenericTrigger runs the pipeline when its webhook is called. The repository_dispatch trigger", indent),
+		indentLine("# runs the workflow when the repository's dispatches API is called instead, which is authorized by a GitHub token", indent),
+		indentLine("# rather than the trigger's token. Please update the callers of the webhook.", indent),
+	}
+	if keys := trigger.getVariableKeys("genericVariables"); len(keys) > 0 {
+		lines = append(lines, indentLine(fmt.Sprintf("# The variables %s are read from the client_payload of the event, so the callers have to send them there.", strings.Join(keys, ", ")), indent))
+	}
+	var unmapped []string
+	unmapped = append(unmapped, trigger.getVariableKeys("genericRequestVariables")...)
+	unmapped = append(unmapped, trigger.getVariableKeys("genericHeaderVariables")...)
+	if len(unmapped) > 0 {
+		lines = append(lines, indentLine(fmt.Sprintf("# The variables %s come from the parameters or headers of the request, which the event doesn't have. Please send them in the client_payload too.", strings.Join(unmapped, ", ")), indent))
+	}
+	if filter := trigger.getNamedArg("regexpFilterExpression"); filter != "" {
+		text := trigger.getNamedArg("regexpFilterText")
+		lines = append(lines, indentLine(fmt.Sprintf("# The trigger only runs the pipeline if '%s' matches '%s'. Please check this in the jobs instead.", text, filter), indent))
+		lines = withLiteralDollars(lines)
+	}
+	lines = append(lines, indentLine("repository_dispatch:", indent))
+	return lines
+}
+
+// linesForUpstreamTrigger converts upstream triggers into a workflow_run trigger, which runs the workflow once the
+// workflows of the upstream jobs complete. The workflows are named after the jobs, which only matches if they are
+// converted into workflows of the same repository named like them.
+func linesForUpstreamTrigger(projects []string, thresholds []string, indent int) []string {
+	lines := []string{
+		indentLine(fmt.Sprintf("# The Jenkins trigger upstream runs the pipeline after the jobs %s build. The workflow_run trigger runs the", strings.Join(projects, ", ")), indent),
+		indentLine("# workflow after the workflows named below complete instead, which have to be in this repository. Please rename them", indent),
+		indentLine("# to the workflows those jobs are converted into.", indent),
+	}
+	if len(thresholds) > 0 {
+		lines = append(lines,
+			indentLine(fmt.Sprintf("# Jenkins only triggers the pipeline for upstream builds that are at least %s. workflow_run triggers it however they end,", strings.Join(thresholds, " or ")), indent),
+			indentLine("# so check github.event.workflow_run.conclusion in the jobs to do the same.", indent),
+		)
+	}
+	lines = append(lines, indentLine("workflow_run:", indent))
+	lines = append(lines, indentLine("workflows:", indent+1))
+	for _, p := range projects {
+		lines = append(lines, indentLine(fmt.Sprintf("- %s", toYamlScalar(p)), indent+2))
+	}
+	lines = append(lines, indentLine("types:", indent+1))
+	lines = append(lines, indentLine("- completed", indent+2))
+	return lines
+}
+
+// workflowEvents returns the events the lines of the on section trigger the workflow on, which are its keys at the
+// given indentation
+func workflowEvents(onLines []string, indentCount int) []string {
+	var events []string
+	prefix := strings.Repeat(" ", indentCount*defaultIndentWidth)
+	for _, l := range strings.Split(strings.Join(onLines, "\n"), "\n") {
+		key := strings.TrimPrefix(l, prefix)
+		if key == l || strings.HasPrefix(key, " ") || strings.HasPrefix(key, "#") || !strings.HasSuffix(key, ":") {
+			continue
+		}
+		events = append(events, strings.TrimSuffix(key, ":"))
+	}
+	return events
+}
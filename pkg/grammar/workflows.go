@@ -0,0 +1,66 @@
+package grammar
+
+import "strings"
+
+// Workflow files the stages are split into by ToYamlFiles, for each trigger
+var workflowFileNames = map[string]string{
+	"pull_request": "pr.yml",
+	"push":         "release.yml",
+}
+
+// ToYamlFiles converts the Jenkinsfile model into a workflow file for each trigger, pr.yml for pull requests and
+// release.yml for pushes to branches, keyed by file name. Each workflow only holds the stages running on its trigger.
+func (m *Model) ToYamlFiles(opts ConvertOptions) (map[string]string, bool, error) {
+	sections, conversionIssues, err := m.ToWorkflowFiles(opts)
+	if err != nil {
+		return nil, conversionIssues, err
+	}
+	files := make(map[string]string)
+	for name, s := range sections {
+		files[name] = strings.Join(s.Lines(), "\n")
+	}
+	return files, conversionIssues, nil
+}
+
+// ToWorkflowFiles converts the Jenkinsfile model into the sections of the workflow files ToYamlFiles returns, keyed
+// by file name, so that the summary of each can be told
+func (m *Model) ToWorkflowFiles(opts ConvertOptions) (map[string]*WorkflowSections, bool, error) {
+	files := make(map[string]*WorkflowSections)
+	conversionIssues := false
+	if opts.CompositeAction {
+		// A composite action runs on the triggers of the workflows using it, so there's only the one
+		sections, issues, err := m.workflowSections(nil, false, opts)
+		if err != nil {
+			return nil, issues, err
+		}
+		files[compositeActionFileName] = sections
+		return files, issues, nil
+	}
+	for _, trigger := range m.getTriggers() {
+		sections, issues, err := m.workflowSections([]string{trigger}, true, opts)
+		if err != nil {
+			return nil, conversionIssues, err
+		}
+		if issues {
+			conversionIssues = true
+		}
+		files[workflowFileNames[trigger]] = sections
+	}
+	return files, conversionIssues, nil
+}
+
+func containsStage(stages []*ModelStage, stage *ModelStage) bool {
+	for _, s := range stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+func appendStageIfMissing(stages []*ModelStage, stage *ModelStage) []*ModelStage {
+	if containsStage(stages, stage) {
+		return stages
+	}
+	return append(stages, stage)
+}
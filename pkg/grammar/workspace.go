@@ -0,0 +1,169 @@
+package grammar
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// Matches the files a shell command redirects its output to, like `> build/output.txt` or `>> log.txt`
+	redirectionRegexp = regexp.MustCompile(`>>?\s*([^\s;&|<>()]+)`)
+	// Splits a shell script into simple commands
+	commandSeparatorRegexp = regexp.MustCompile(`&&|\|\||[;|&\n()]`)
+	// The commands whose arguments are all paths they write, and those whose last argument is
+	writingCommands     = []string{"mkdir", "touch", "tee"}
+	copyingCommands     = []string{"cp", "mv", "rsync"}
+	downloadOutputFlags = []string{"-o", "-O", "--output", "--output-document"}
+)
+
+// stageScripts returns the shell commands the stage's steps run, each with the folder it runs in
+func (m *ModelStage) stageScripts() []stepDirAndImage {
+	var scripts []stepDirAndImage
+	for _, step := range m.getSteps() {
+		for _, s := range step.nestedStepsWithDirAndImage("", "") {
+			if s.step.Name == "sh" && len(s.step.Args) == 1 && s.step.Args[0].Unnamed != nil {
+				scripts = append(scripts, s)
+			}
+		}
+	}
+	return scripts
+}
+
+// shellWords splits each simple command of a script into its words, without quotes
+func shellWords(script string) [][]string {
+	var commands [][]string
+	for _, c := range commandSeparatorRegexp.Split(script, -1) {
+		var words []string
+		for _, w := range strings.Fields(c) {
+			words = append(words, strings.Trim(w, `'"`))
+		}
+		if len(words) > 0 {
+			commands = append(commands, words)
+		}
+	}
+	return commands
+}
+
+// workspacePath turns a path a command refers to into a path relative to the workspace, or returns false if it is
+// outside of the workspace or depends on variables
+func workspacePath(dir string, p string) (string, bool) {
+	if p == "" || strings.HasPrefix(p, "-") || strings.HasPrefix(p, "/") || strings.HasPrefix(p, "~") || strings.ContainsAny(p, "$`*?=") {
+		return "", false
+	}
+	p = path.Clean(path.Join(dir, p))
+	if p == "." || strings.HasPrefix(p, "..") {
+		return "", false
+	}
+	return p, true
+}
+
+// writtenPaths returns the paths in the workspace the script writes to, going by redirections and commands that
+// create or copy files
+func writtenPaths(dir string, script string) []string {
+	var written []string
+	add := func(p string) {
+		if wp, ok := workspacePath(dir, strings.Trim(p, `'"`)); ok {
+			written = appendIfMissing(written, wp)
+		}
+	}
+	for _, match := range redirectionRegexp.FindAllStringSubmatch(script, -1) {
+		add(match[1])
+	}
+	for _, words := range shellWords(script) {
+		switch {
+		case containsString(writingCommands, words[0]):
+			for _, w := range words[1:] {
+				add(w)
+			}
+		case containsString(copyingCommands, words[0]) && len(words) > 2:
+			add(words[len(words)-1])
+		}
+		for i, w := range words[:len(words)-1] {
+			if containsString(downloadOutputFlags, w) && (words[0] == "curl" || words[0] == "wget") {
+				add(words[i+1])
+			}
+		}
+	}
+	return written
+}
+
+// readPaths returns the paths the script refers to that are, or are in, any of the given paths
+func readPaths(dir string, script string, paths []string) []string {
+	var read []string
+	for _, words := range shellWords(strings.ReplaceAll(script, "<", " ")) {
+		for _, w := range words[1:] {
+			wp, ok := workspacePath(dir, w)
+			if !ok {
+				continue
+			}
+			for _, p := range paths {
+				if wp == p || strings.HasPrefix(wp, p+"/") {
+					read = appendIfMissing(read, p)
+				}
+			}
+		}
+	}
+	return read
+}
+
+// workspaceWrites keeps track of the stage that first wrote each path of the workspace
+type workspaceWrites map[string]string
+
+// add records the paths the stage writes, unless an earlier stage wrote them already
+func (w workspaceWrites) add(stage *ModelStage) {
+	for _, s := range stage.stageScripts() {
+		for _, p := range writtenPaths(s.dir, unescapeArg(s.step.getArg())) {
+			if _, ok := w[p]; !ok {
+				w[p] = stage.Name
+			}
+		}
+	}
+}
+
+// readBy returns the paths written by earlier stages that the stage reads, unless it writes them itself first
+func (w workspaceWrites) readBy(stage *ModelStage) []string {
+	var paths []string
+	for p := range w {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var read []string
+	var ownWrites []string
+	for _, s := range stage.stageScripts() {
+		script := unescapeArg(s.step.getArg())
+		for _, p := range readPaths(s.dir, script, paths) {
+			if !containsString(ownWrites, p) {
+				read = appendIfMissing(read, p)
+			}
+		}
+		ownWrites = append(ownWrites, writtenPaths(s.dir, script)...)
+	}
+	// Paths in a folder that is read as well go without saying
+	var outermost []string
+	for _, p := range read {
+		nested := false
+		for _, other := range read {
+			nested = nested || strings.HasPrefix(p, other+"/")
+		}
+		if !nested {
+			outermost = append(outermost, p)
+		}
+	}
+	return outermost
+}
+
+// commentsForWorkspaceReads warns that a job may read files an earlier stage wrote. Jenkins runs the stages in one
+// workspace, but each job starts from a fresh checkout.
+func commentsForWorkspaceReads(paths []string, writes workspaceWrites, indent int) []string {
+	var described []string
+	for _, p := range paths {
+		described = append(described, fmt.Sprintf("%s (stage '%s')", p, writes[p]))
+	}
+	return []string{
+		indentLine(fmt.Sprintf("# WARNING: This stage may depend on a previous stage's workspace, reading what it wrote: %s.", strings.Join(described, ", ")), indent),
+		indentLine("# Jobs don't share a workspace, so pass the files on with actions/upload-artifact and actions/download-artifact.", indent),
+	}
+}
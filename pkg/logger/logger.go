@@ -0,0 +1,29 @@
+package logger
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// LevelEnvVar is the environment variable setting the log level: debug, info, warn or error. Defaults to info.
+const LevelEnvVar = "LOG_LEVEL"
+
+// Setup makes a logger writing to stderr, at the level from the LOG_LEVEL environment variable, the default logger.
+func Setup() {
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: levelFromEnv()})
+	slog.SetDefault(slog.New(handler))
+}
+
+func levelFromEnv() slog.Level {
+	switch strings.ToLower(os.Getenv(LevelEnvVar)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
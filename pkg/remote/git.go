@@ -0,0 +1,149 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/inspirit941/convert-jenkinsfile/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+// TokenEnvVar is the environment variable holding the token the command line clones private repositories with
+const TokenEnvVar = "GIT_TOKEN"
+
+// DefaultPath is where the Jenkinsfile of a repository is looked for, unless another path is given
+const DefaultPath = "Jenkinsfile"
+
+// Repository is a Git repository to fetch a Jenkinsfile from
+type Repository struct {
+	// URL is the https URL of the repository
+	URL string
+	// Ref is the branch or tag to fetch. Defaults to the repository's default branch.
+	Ref string
+	// Path is the path of the Jenkinsfile in the repository. Defaults to Jenkinsfile.
+	Path string
+	// Token authenticates the clone of a private repository, if set
+	Token string
+	// AllowedHosts are the hosts the repository may be cloned from, like github.com. Any host is allowed if empty.
+	AllowedHosts []string
+}
+
+// isAllowedHost checks if the repository may be cloned from the host
+func (r Repository) isAllowedHost(host string) bool {
+	if len(r.AllowedHosts) == 0 {
+		return true
+	}
+	for _, h := range r.AllowedHosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that the repository is fetched over https, and that the Jenkinsfile's path stays in it
+func (r Repository) validate() (string, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return "", errors.Errorf("the repository URL '%s' isn't an https URL", r.URL)
+	}
+	if u.User != nil {
+		return "", errors.New("the repository URL can't hold credentials, pass a token instead")
+	}
+	if !r.isAllowedHost(u.Hostname()) {
+		return "", errors.Errorf("repositories on %s can't be cloned", u.Hostname())
+	}
+	if strings.HasPrefix(r.Ref, "-") {
+		return "", errors.Errorf("the ref '%s' isn't a branch or tag", r.Ref)
+	}
+	p := r.Path
+	if p == "" {
+		p = DefaultPath
+	}
+	p = path.Clean(strings.TrimPrefix(p, "/"))
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", errors.Errorf("the path '%s' isn't in the repository", r.Path)
+	}
+	return p, nil
+}
+
+// FetchJenkinsfile shallow clones the repository and reads its Jenkinsfile, which can't be larger than maxBytes. The
+// clone is removed once the Jenkinsfile is read.
+func FetchJenkinsfile(ctx context.Context, r Repository, maxBytes int64) (string, error) {
+	jenkinsfilePath, err := r.validate()
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "jenkinsfile-")
+	if err != nil {
+		return "", errors.Wrap(err, "creating a folder to clone the repository into")
+	}
+	defer os.RemoveAll(dir)
+
+	// Redirects could lead to another host, or to another protocol, which the URL was checked against
+	args := []string{"-c", "http.followRedirects=false", "clone", "--depth", "1", "--single-branch", "--no-tags"}
+	if r.Ref != "" {
+		args = append(args, "--branch", r.Ref)
+	}
+	args = append(args, "--", r.URL, dir)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ALLOW_PROTOCOL=https")
+	if r.Token != "" {
+		// Passed through the environment rather than the arguments or the URL, so that it isn't shown in process
+		// listings or error messages
+		credentials := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + r.Token))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials,
+		)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		// The output of git can tell about the network the repository is cloned from, so it is only logged
+		logger.FromContext(ctx).Warn("Cloning the repository failed", "url", r.URL, "error", err, "stderr", strings.TrimSpace(stderr.String()))
+		return "", errors.Errorf("cloning %s failed, check that the repository and the ref exist and that the token can read them", r.URL)
+	}
+
+	// A symbolic link could point outside of the clone, at a file of the host
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dir, filepath.FromSlash(jenkinsfilePath)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errors.Errorf("the repository has no file %s", jenkinsfilePath)
+		}
+		return "", errors.Wrapf(err, "reading %s", jenkinsfilePath)
+	}
+	cloneDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", errors.Wrap(err, "reading the clone of the repository")
+	}
+	if !strings.HasPrefix(resolved, cloneDir+string(filepath.Separator)) {
+		return "", errors.Errorf("the path %s isn't in the repository", jenkinsfilePath)
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return "", errors.Wrapf(err, "reading %s", jenkinsfilePath)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(io.LimitReader(f, maxBytes+1))
+	if err != nil {
+		return "", errors.Wrapf(err, "reading %s", jenkinsfilePath)
+	}
+	if int64(len(content)) > maxBytes {
+		return "", fmt.Errorf("the Jenkinsfile is larger than %d bytes", maxBytes)
+	}
+	return string(content), nil
+}
@@ -1,29 +1,77 @@
 package router
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/inspirit941/convert-jenkinsfile/docs"
 	"github.com/inspirit941/convert-jenkinsfile/pkg/api"
+	"github.com/inspirit941/convert-jenkinsfile/pkg/logger"
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
 func InitRouter(server *gin.Engine) *gin.Engine {
 	docs.SwaggerInfo.BasePath = "/api/v1"
-	server.Use(CORSMiddleware())
+	server.Use(RequestIDMiddleware(), RecoveryMiddleware(), CORSMiddleware())
 	v1 := server.Group("/api/v1")
 	{
 		v1.POST("/upload", api.ConvertFile)
+		v1.POST("/upload/url", api.ConvertURL)
+		v1.POST("/parse", api.ParseFile)
 	}
 	server.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
+	server.GET("/healthz", api.Healthz)
 
 	return server
 }
+
+// AllowedOriginsEnvVar is the environment variable listing the origins allowed to call the API, separated by
+// commas. Set it to * to allow any origin, e.g. in development, in which case credentials aren't allowed.
+const AllowedOriginsEnvVar = "CORS_ALLOWED_ORIGINS"
+
+const defaultAllowedOrigin = "https://delightful-field-0835ff900.1.azurestaticapps.net"
+
+// allowedOrigins reads the allowed origins from the environment, falling back to the hosted frontend
+func allowedOrigins() []string {
+	var origins []string
+	for _, o := range strings.Split(os.Getenv(AllowedOriginsEnvVar), ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	if len(origins) == 0 {
+		return []string{defaultAllowedOrigin}
+	}
+	return origins
+}
+
 func CORSMiddleware() gin.HandlerFunc {
+	origins := allowedOrigins()
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "https://delightful-field-0835ff900.1.azurestaticapps.net")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		origin := c.GetHeader("Origin")
+		for _, o := range origins {
+			if o == "*" {
+				// Any origin may call the API, but without credentials, so that no site can call it as the user
+				c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+				break
+			}
+			if o == origin {
+				// Only the request's own origin can be echoed back, since credentials are allowed
+				c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+				c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+				c.Writer.Header().Add("Vary", "Origin")
+				break
+			}
+		}
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
 
 		if c.Request.Method == "OPTIONS" {
@@ -34,3 +82,58 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequestIDHeader is the header carrying the id of a request. An id the client sends is kept, and otherwise one is
+// made up. Either way it is echoed in the response and added to the log lines of the request.
+const RequestIDHeader = "X-Request-ID"
+
+// The ids accepted from clients, which are written to the logs as they are
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// newRequestID makes up a random id for a request
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestIDMiddleware gives each request an id, from the X-Request-ID header if the client sends a valid one
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDRegexp.MatchString(id) {
+			id = newRequestID()
+		}
+		if id != "" {
+			c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), id))
+			c.Writer.Header().Set(RequestIDHeader, id)
+		}
+		c.Next()
+	}
+}
+
+// RecoveryMiddleware responds with 500 and the id of the request if handling it panics, so that the failure can be
+// found in the logs, instead of leaving the client without a response
+func RecoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				// The connection is gone, so there is nobody to respond to
+				panic(err)
+			}
+			ctx := c.Request.Context()
+			logger.FromContext(ctx).Error("Panic handling request", "error", err, "path", c.FullPath(), "client", c.ClientIP(), "stack", string(debug.Stack()))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":      "internal server error",
+				"request_id": logger.RequestID(ctx),
+			})
+		}()
+		c.Next()
+	}
+}
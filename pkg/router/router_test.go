@@ -0,0 +1,99 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serve handles the request with the request id and recovery middleware in front of the handler
+func serve(handler gin.HandlerFunc, request *http.Request) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware(), RecoveryMiddleware())
+	router.GET("/", handler)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRequestIDMiddlewareKeepsTheClientsID(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RequestIDHeader, "client-id-1")
+	recorder := serve(func(c *gin.Context) { c.Status(http.StatusOK) }, request)
+
+	if id := recorder.Header().Get(RequestIDHeader); id != "client-id-1" {
+		t.Errorf("expected the request id client-id-1, got %q", id)
+	}
+}
+
+func TestRequestIDMiddlewareMakesUpAnInvalidID(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RequestIDHeader, "not valid\n")
+	recorder := serve(func(c *gin.Context) { c.Status(http.StatusOK) }, request)
+
+	if id := recorder.Header().Get(RequestIDHeader); !requestIDRegexp.MatchString(id) || id == "not valid\n" {
+		t.Errorf("expected a made up request id, got %q", id)
+	}
+}
+
+func TestRecoveryMiddlewareRespondsWithTheRequestID(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RequestIDHeader, "client-id-2")
+	recorder := serve(func(c *gin.Context) { panic("boom") }, request)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, recorder.Code)
+	}
+	var response struct {
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.RequestID != "client-id-2" {
+		t.Errorf("expected the request id client-id-2 in the response, got %q", response.RequestID)
+	}
+}
+
+// corsHeaders returns the CORS headers of the response to a request from the origin
+func corsHeaders(t *testing.T, allowedOrigins string, origin string) http.Header {
+	t.Setenv(AllowedOriginsEnvVar, allowedOrigins)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORSMiddleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Origin", origin)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder.Header()
+}
+
+func TestCORSMiddlewareAllowsAnyOriginWithoutCredentials(t *testing.T) {
+	header := corsHeaders(t, "*", "https://example.com")
+	if got := header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("got Access-Control-Allow-Origin %q, want *", got)
+	}
+	if got := header.Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("credentials are allowed for any origin: %q", got)
+	}
+}
+
+func TestCORSMiddlewareAllowsCredentialsForListedOrigins(t *testing.T) {
+	header := corsHeaders(t, "http://localhost:3000", "http://localhost:3000")
+	if got := header.Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+		t.Errorf("got Access-Control-Allow-Origin %q, want the origin", got)
+	}
+	if got := header.Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("got Access-Control-Allow-Credentials %q, want true", got)
+	}
+
+	header = corsHeaders(t, "http://localhost:3000", "https://example.com")
+	if got := header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("an origin that isn't listed is allowed: %q", got)
+	}
+}